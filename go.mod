@@ -7,6 +7,7 @@ require (
 	github.com/JuulLabs-OSS/cbgo v0.0.2
 	github.com/abiosoft/ishell v2.0.0+incompatible // indirect
 	github.com/abiosoft/ishell/v2 v2.0.2
+	github.com/abiosoft/readline v0.0.0-20180607040430-155bce2042db
 	github.com/fatih/color v1.14.1 // indirect
 	github.com/fatih/structs v1.1.0
 	github.com/joaojeronimo/go-crc16 v0.0.0-20140729130949-59bd0194935e
@@ -28,6 +28,7 @@ import (
 
 	"mynewt.apache.org/newt/util"
 	"mynewt.apache.org/newtmgr/newtmgr/nmutil"
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
 	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
 )
 
@@ -36,6 +37,7 @@ var NewtmgrHelp bool
 
 func Commands() *cobra.Command {
 	logLevelStr := ""
+	nmpVer := 0
 	nmCmd := &cobra.Command{
 		Use:   nmutil.ToolInfo.ExeName,
 		Short: nmutil.ToolInfo.ShortName + " helps you manage remote devices",
@@ -52,6 +54,12 @@ func Commands() *cobra.Command {
 			}
 			nmxutil.SetLogLevel(NewtmgrLogLevel)
 
+			if nmpVer != 1 && nmpVer != 2 {
+				nmUsage(nil, util.FmtNewtError(
+					"invalid NMP version: %d", nmpVer))
+			}
+			nmp.NmpVer = uint8(nmpVer - 1)
+
 			// Set cbgo log level if we're using macOS.
 			OSSpecificInit()
 		},
@@ -96,6 +104,10 @@ func Commands() *cobra.Command {
 	nmCmd.PersistentFlags().StringVar(&nmxutil.OmpRes, "ompres", "/omgr",
 		"Use this CoAP resource instead of /omgr")
 
+	nmCmd.PersistentFlags().IntVar(&nmpVer, "nmpver", 1,
+		"NMP protocol version to use (1 or 2); with 2, falls back to 1 if "+
+			"the device does not support it")
+
 	versCmd := &cobra.Command{
 		Use:     "version",
 		Short:   "Display the " + nmutil.ToolInfo.ShortName + " version number",
@@ -121,9 +133,12 @@ func Commands() *cobra.Command {
 	nmCmd.AddCommand(runCmd())
 	nmCmd.AddCommand(statsCmd())
 	nmCmd.AddCommand(taskStatCmd())
+	nmCmd.AddCommand(topCmd())
 	nmCmd.AddCommand(configCmd())
 	nmCmd.AddCommand(connProfileCmd())
 	nmCmd.AddCommand(echoCmd())
+	nmCmd.AddCommand(exporterCmd())
+	nmCmd.AddCommand(consEchoCtrlCmd())
 	nmCmd.AddCommand(resCmd())
 	nmCmd.AddCommand(interactiveCmd())
 	nmCmd.AddCommand(shellCmd())
@@ -33,6 +33,7 @@ import (
 	"mynewt.apache.org/newtmgr/nmxact/nmcoap"
 	"mynewt.apache.org/newtmgr/nmxact/nmserial"
 	"mynewt.apache.org/newtmgr/nmxact/sesn"
+	"mynewt.apache.org/newtmgr/nmxact/tcp"
 	"mynewt.apache.org/newtmgr/nmxact/udp"
 	"mynewt.apache.org/newtmgr/nmxact/xport"
 )
@@ -104,6 +105,19 @@ func getConnProfile() (*config.ConnProfile, error) {
 	return globalP, nil
 }
 
+// Returns the key under which state about the device, such as cached log
+// names, is saved.  State is kept per connection profile, since different
+// profiles may reach different devices over the same port.  A connection
+// specified entirely on the command line has no profile of its own, so it is
+// keyed by the connection itself.
+func connProfileKey(cp *config.ConnProfile) string {
+	if nmutil.ConnProfile == "" {
+		return config.ConnTypeToString(cp.Type) + ":" + cp.ConnString
+	}
+
+	return cp.Name
+}
+
 func GetXport() (xport.Xport, error) {
 	if globalXport != nil {
 		return globalXport, nil
@@ -149,6 +163,9 @@ func GetXport() (xport.Xport, error) {
 	case config.CONN_TYPE_UDP_PLAIN, config.CONN_TYPE_UDP_OIC:
 		globalXport = udp.NewUdpXport()
 
+	case config.CONN_TYPE_TCP_PLAIN, config.CONN_TYPE_TCP_OIC:
+		globalXport = tcp.NewTcpXport()
+
 	case config.CONN_TYPE_MTECH_LORA_OIC:
 		cfg := mtech_lora.NewXportCfg()
 		globalXport = mtech_lora.NewLoraXport(cfg)
@@ -242,6 +259,18 @@ func buildSesnCfg() (sesn.SesnCfg, error) {
 
 		return sc, nil
 
+	case config.CONN_TYPE_TCP_PLAIN:
+		sc.MgmtProto = sesn.MGMT_PROTO_NMP
+		sc.PeerSpec.Tcp = cp.ConnString
+
+		return sc, nil
+
+	case config.CONN_TYPE_TCP_OIC:
+		sc.MgmtProto = sesn.MGMT_PROTO_OMP
+		sc.PeerSpec.Tcp = cp.ConnString
+
+		return sc, nil
+
 	case config.CONN_TYPE_MTECH_LORA_OIC:
 		mc, err := config.ParseMtechLoraConnString(cp.ConnString)
 		if err != nil {
@@ -0,0 +1,57 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"testing"
+
+	"mynewt.apache.org/newtmgr/newtmgr/config"
+	"mynewt.apache.org/newtmgr/newtmgr/nmutil"
+)
+
+func TestConnProfileKey(t *testing.T) {
+	defer func(name string) { nmutil.ConnProfile = name }(nmutil.ConnProfile)
+
+	board1 := &config.ConnProfile{Name: "board1",
+		Type: config.CONN_TYPE_SERIAL_PLAIN, ConnString: "/dev/ttyUSB0"}
+	board2 := &config.ConnProfile{Name: "board2",
+		Type: config.CONN_TYPE_SERIAL_PLAIN, ConnString: "/dev/ttyUSB0"}
+
+	// Profiles that share a port are kept apart.
+	nmutil.ConnProfile = "board1"
+	k1 := connProfileKey(board1)
+	nmutil.ConnProfile = "board2"
+	k2 := connProfileKey(board2)
+	if k1 == k2 {
+		t.Fatalf("profiles sharing a port have the same key: %s", k1)
+	}
+
+	// Without a profile, the connection identifies the device.
+	nmutil.ConnProfile = ""
+	unnamed := &config.ConnProfile{Name: "unnamed",
+		Type: config.CONN_TYPE_SERIAL_PLAIN}
+	unnamed.ConnString = "/dev/ttyUSB0"
+	k1 = connProfileKey(unnamed)
+	unnamed.ConnString = "/dev/ttyUSB1"
+	k2 = connProfileKey(unnamed)
+	if k1 == k2 {
+		t.Fatalf("different connections have the same key: %s", k1)
+	}
+}
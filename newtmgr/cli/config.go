@@ -26,6 +26,7 @@ import (
 
 	"mynewt.apache.org/newt/util"
 	"mynewt.apache.org/newtmgr/newtmgr/nmutil"
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
 	"mynewt.apache.org/newtmgr/nmxact/sesn"
 	"mynewt.apache.org/newtmgr/nmxact/xact"
 )
@@ -42,7 +43,7 @@ func configRead(s sesn.Sesn, args []string) {
 
 	sres := res.(*xact.ConfigReadResult)
 	if sres.Rsp.Rc != 0 {
-		fmt.Printf("Error: %d\n", sres.Rsp.Rc)
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(sres.Rsp.Rc))
 	} else {
 		fmt.Printf("Value: %s\n", sres.Rsp.Val)
 	}
@@ -61,7 +62,7 @@ func configWrite(s sesn.Sesn, args []string) {
 
 	sres := res.(*xact.ConfigWriteResult)
 	if sres.Rsp.Rc != 0 {
-		fmt.Printf("Error: %d\n", sres.Rsp.Rc)
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(sres.Rsp.Rc))
 	} else {
 		fmt.Printf("Done\n")
 	}
@@ -79,7 +80,7 @@ func configSave(s sesn.Sesn, args []string) {
 
 	sres := res.(*xact.ConfigWriteResult)
 	if sres.Rsp.Rc != 0 {
-		fmt.Printf("Error: %d\n", sres.Rsp.Rc)
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(sres.Rsp.Rc))
 	} else {
 		fmt.Printf("Done\n")
 	}
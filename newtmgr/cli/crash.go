@@ -27,6 +27,7 @@ import (
 
 	"mynewt.apache.org/newt/util"
 	"mynewt.apache.org/newtmgr/newtmgr/nmutil"
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
 	"mynewt.apache.org/newtmgr/nmxact/xact"
 )
 
@@ -56,7 +57,7 @@ func crashRunCmd(cmd *cobra.Command, args []string) {
 
 	sres := res.(*xact.CrashResult)
 	if sres.Rsp.Rc != 0 {
-		fmt.Printf("Error: %d\n", sres.Rsp.Rc)
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(sres.Rsp.Rc))
 	} else {
 		fmt.Printf("Done\n")
 	}
@@ -27,6 +27,7 @@ import (
 
 	"mynewt.apache.org/newt/util"
 	"mynewt.apache.org/newtmgr/newtmgr/nmutil"
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
 	"mynewt.apache.org/newtmgr/nmxact/sesn"
 	"mynewt.apache.org/newtmgr/nmxact/xact"
 )
@@ -64,7 +65,7 @@ func dateTimeWrite(s sesn.Sesn, args []string) error {
 
 	sres := res.(*xact.DateTimeWriteResult)
 	if sres.Rsp.Rc != 0 {
-		fmt.Printf("Error: %d\n", sres.Rsp.Rc)
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(sres.Rsp.Rc))
 	} else {
 		fmt.Printf("Done\n")
 	}
@@ -72,6 +73,67 @@ func dateTimeWrite(s sesn.Sesn, args []string) error {
 	return nil
 }
 
+var (
+	dateTimeSyncRounds int
+	dateTimeSyncDryRun bool
+)
+
+// Describes a clock offset, e.g., "1.5s ahead of".
+func dateTimeFmtOffset(d time.Duration) string {
+	d = d.Round(time.Microsecond)
+	switch {
+	case d > 0:
+		return d.String() + " ahead of"
+	case d < 0:
+		return (-d).String() + " behind"
+	default:
+		return "in sync with"
+	}
+}
+
+func dateTimeSyncRunCmd(cmd *cobra.Command, args []string) {
+	if dateTimeSyncRounds < 1 {
+		nmUsage(cmd, util.NewNewtError("rounds must be at least 1"))
+	}
+
+	s, err := GetSesn()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	c := xact.NewDateTimeSyncCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+	c.Rounds = dateTimeSyncRounds
+	c.DryRun = dateTimeSyncDryRun
+
+	res, err := c.Run(s)
+	if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+
+	sres := res.(*xact.DateTimeSyncResult)
+	if len(sres.Samples) == c.Rounds {
+		fmt.Printf("Round trip time: min %s, median %s (%d rounds)\n",
+			sres.MinRtt.Round(time.Microsecond),
+			sres.MedianRtt.Round(time.Microsecond), len(sres.Samples))
+		fmt.Printf("Device clock is %s host (+/- %s)\n",
+			dateTimeFmtOffset(sres.Offset),
+			(sres.MinRtt / 2).Round(time.Microsecond))
+	}
+	if sres.DateTime != "" {
+		fmt.Printf("Setting time to %s\n", sres.DateTime)
+	}
+	if sres.Rc != 0 {
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(sres.Rc))
+		return
+	}
+	if sres.Verify != nil {
+		fmt.Printf("Residual error: device clock is %s host (+/- %s)\n",
+			dateTimeFmtOffset(sres.Verify.Offset()),
+			(sres.Verify.Rtt() / 2).Round(time.Microsecond))
+	}
+}
+
 func dateTimeRunCmd(cmd *cobra.Command, args []string) {
 	s, err := GetSesn()
 	if err != nil {
@@ -95,6 +157,8 @@ func dateTimeCmd() *cobra.Command {
 	dateTimeHelpText += "to set the datetime on the device.\n\n"
 	dateTimeHelpText += "Must specify datetime-value in RFC 3339 format, "
 	dateTimeHelpText += "or use keyword 'now'.\n"
+	dateTimeHelpText += "Use the sync subcommand to set the datetime to the "
+	dateTimeHelpText += "host's time,\ncompensating for link latency.\n"
 
 	dateTimeEx := nmutil.ToolInfo.ExeName + " datetime -c myserial\n"
 	dateTimeEx += nmutil.ToolInfo.ExeName +
@@ -124,5 +188,30 @@ func dateTimeCmd() *cobra.Command {
 		Run:     dateTimeRunCmd,
 	}
 
+	syncHelpText := "Set the datetime on a device to the host's UTC time, " +
+		"compensating for link\nlatency.\n\n" +
+		"Reads the device's datetime several times to estimate the clock " +
+		"offset and the\nround trip time, then writes the host's time " +
+		"plus half the median round trip\ntime.  A final read reports " +
+		"the residual error."
+
+	syncEx := "  " + nmutil.ToolInfo.ExeName + " datetime sync -c myserial\n"
+	syncEx += "  " + nmutil.ToolInfo.ExeName +
+		" datetime sync --dry-run -c myserial\n"
+
+	syncCmd := &cobra.Command{
+		Use:     "sync -c <conn_profile>",
+		Short:   "Synchronize datetime on a device with the host",
+		Long:    syncHelpText,
+		Example: syncEx,
+		Run:     dateTimeSyncRunCmd,
+	}
+	syncCmd.Flags().IntVar(&dateTimeSyncRounds, "rounds",
+		xact.DATETIME_SYNC_DFLT_ROUNDS,
+		"Number of reads used to estimate the offset and round trip time")
+	syncCmd.Flags().BoolVar(&dateTimeSyncDryRun, "dry-run", false,
+		"Measure the clock offset without setting the datetime")
+	dateTimeCmd.AddCommand(syncCmd)
+
 	return dateTimeCmd
 }
@@ -26,6 +26,7 @@ import (
 
 	"mynewt.apache.org/newt/util"
 	"mynewt.apache.org/newtmgr/newtmgr/nmutil"
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
 	"mynewt.apache.org/newtmgr/nmxact/xact"
 )
 
@@ -49,9 +50,51 @@ func echoRunCmd(cmd *cobra.Command, args []string) {
 	}
 
 	eres := res.(*xact.EchoResult)
+	if eres.Status() != 0 {
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(eres.Status()))
+		return
+	}
+
 	fmt.Println(eres.Rsp.Payload)
 }
 
+func consEchoCtrlRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		nmUsage(cmd, nil)
+	}
+
+	var echo bool
+	switch args[0] {
+	case "on":
+		echo = true
+	case "off":
+		echo = false
+	default:
+		nmUsage(cmd, util.FmtNewtError("Invalid echo setting: %s", args[0]))
+	}
+
+	s, err := GetSesn()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	c := xact.NewConsEchoCtrlCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+	c.Echo = echo
+
+	res, err := c.Run(s)
+	if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+
+	if res.Status() != 0 {
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(res.Status()))
+		return
+	}
+
+	fmt.Printf("Done\n")
+}
+
 func echoCmd() *cobra.Command {
 	echoCmd := &cobra.Command{
 		Use:   "echo <text> -c <conn_profile>",
@@ -61,3 +104,17 @@ func echoCmd() *cobra.Command {
 
 	return echoCmd
 }
+
+func consEchoCtrlCmd() *cobra.Command {
+	consEchoCtrlEx := "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex echo-ctrl off\n"
+
+	consEchoCtrlCmd := &cobra.Command{
+		Use:     "echo-ctrl <on|off> -c <conn_profile>",
+		Short:   "Enable or disable console echo on a device",
+		Example: consEchoCtrlEx,
+		Run:     consEchoCtrlRunCmd,
+	}
+
+	return consEchoCtrlCmd
+}
@@ -0,0 +1,478 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newtmgr/newtmgr/nmutil"
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
+	"mynewt.apache.org/newtmgr/nmxact/xact"
+)
+
+var (
+	exporterListen   string
+	exporterInterval time.Duration
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// $metrics                                                                 //
+//////////////////////////////////////////////////////////////////////////////
+
+type promLabel struct {
+	Name  string
+	Value string
+}
+
+type promSample struct {
+	Labels []promLabel
+	Value  float64
+}
+
+type promFamily struct {
+	Name    string
+	Type    string
+	Help    string
+	Samples []promSample
+}
+
+// A set of metrics, rendered in the Prometheus text exposition format.
+type promRegistry struct {
+	families map[string]*promFamily
+}
+
+func newPromRegistry() *promRegistry {
+	return &promRegistry{
+		families: map[string]*promFamily{},
+	}
+}
+
+func (r *promRegistry) add(name string, typ string, help string,
+	value float64, labels ...promLabel) {
+
+	f := r.families[name]
+	if f == nil {
+		f = &promFamily{
+			Name: name,
+			Type: typ,
+			Help: help,
+		}
+		r.families[name] = f
+	}
+
+	f.Samples = append(f.Samples, promSample{
+		Labels: labels,
+		Value:  value,
+	})
+}
+
+var promLabelEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+)
+
+func (s *promSample) labelText() string {
+	if len(s.Labels) == 0 {
+		return ""
+	}
+
+	parts := make([]string, len(s.Labels))
+	for i, l := range s.Labels {
+		parts[i] = l.Name + `="` + promLabelEscaper.Replace(l.Value) + `"`
+	}
+
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// Writes the metrics in the Prometheus text format, sorted by name so that
+// consecutive scrapes are easy to compare.
+func (r *promRegistry) write(w io.Writer) {
+	names := make([]string, 0, len(r.families))
+	for name, _ := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := r.families[name]
+		fmt.Fprintf(w, "# HELP %s %s\n", f.Name, f.Help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", f.Name, f.Type)
+
+		samples := make([]string, len(f.Samples))
+		for i, s := range f.Samples {
+			samples[i] = f.Name + s.labelText() + " " +
+				strconv.FormatFloat(s.Value, 'g', -1, 64)
+		}
+		sort.Strings(samples)
+
+		for _, s := range samples {
+			fmt.Fprintf(w, "%s\n", s)
+		}
+	}
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $poll                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+// Extracts the NMP status code from the result of a command.  A nonzero
+// status indicates that the device does not support the command (or a
+// similar error); such errors cause only the affected metrics to be omitted.
+// Any other error is returned as is.
+func exporterStatus(res xact.Result, err error) (int, error) {
+	if err != nil {
+		if gerr := nmp.ToNmpGroup(err); gerr != nil {
+			return gerr.Rc, nil
+		}
+		return 0, err
+	}
+
+	return res.Status(), nil
+}
+
+func exporterPollStats(s sesn.Sesn, reg *promRegistry,
+	profile promLabel) error {
+
+	lc := xact.NewStatListCmd()
+	lc.SetTxOptions(nmutil.TxOptions())
+	lres, err := lc.Run(s)
+	rc, err := exporterStatus(lres, err)
+	if err != nil {
+		return err
+	}
+	if rc != 0 {
+		log.Debugf("Exporter: stat list failed: %s", nmp.NmpRcToString(rc))
+		return nil
+	}
+
+	for _, group := range lres.(*xact.StatListResult).Rsp.List {
+		c := xact.NewStatReadCmd()
+		c.SetTxOptions(nmutil.TxOptions())
+		c.Name = group
+		rres, err := c.Run(s)
+		status, err := exporterStatus(rres, err)
+		if err != nil {
+			return err
+		}
+		if status != 0 {
+			log.Debugf("Exporter: stat read %s failed: %s", group,
+				nmp.NmpRcToString(status))
+			continue
+		}
+
+		rsp := rres.(*xact.StatReadResult).Rsp
+		for field, _ := range rsp.Fields {
+			val, ok := rsp.FieldUint64(field)
+			if !ok {
+				continue
+			}
+
+			reg.add("newtmgr_stat", "untyped",
+				"Value of a statistic on the device.", float64(val),
+				profile,
+				promLabel{"group", group},
+				promLabel{"stat", field})
+		}
+	}
+
+	return nil
+}
+
+func exporterPollMempools(s sesn.Sesn, reg *promRegistry,
+	profile promLabel) error {
+
+	c := xact.NewMempoolStatCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+	res, err := c.Run(s)
+	rc, err := exporterStatus(res, err)
+	if err != nil {
+		return err
+	}
+	if rc != 0 {
+		log.Debugf("Exporter: mpstat failed: %s", nmp.NmpRcToString(rc))
+		return nil
+	}
+
+	for name, mp := range res.(*xact.MempoolStatResult).Rsp.Mpools {
+		pool := promLabel{"pool", name}
+
+		reg.add("newtmgr_mempool_block_size_bytes", "gauge",
+			"Size of each block in a memory pool.",
+			float64(mp["blksiz"]), profile, pool)
+		reg.add("newtmgr_mempool_blocks", "gauge",
+			"Number of blocks in a memory pool.",
+			float64(mp["nblks"]), profile, pool)
+		reg.add("newtmgr_mempool_free_blocks", "gauge",
+			"Number of free blocks in a memory pool.",
+			float64(mp["nfree"]), profile, pool)
+		reg.add("newtmgr_mempool_min_free_blocks", "gauge",
+			"Lowest number of free blocks in a memory pool since boot.",
+			float64(mp["min"]), profile, pool)
+	}
+
+	return nil
+}
+
+func exporterPollTasks(s sesn.Sesn, reg *promRegistry,
+	profile promLabel) error {
+
+	c := xact.NewTaskStatCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+	res, err := c.Run(s)
+	rc, err := exporterStatus(res, err)
+	if err != nil {
+		return err
+	}
+	if rc != 0 {
+		log.Debugf("Exporter: taskstat failed: %s", nmp.NmpRcToString(rc))
+		return nil
+	}
+
+	for name, t := range res.(*xact.TaskStatResult).Rsp.Tasks {
+		task := promLabel{"task", name}
+
+		reg.add("newtmgr_task_priority", "gauge",
+			"Priority of a task.",
+			float64(t["prio"]), profile, task)
+		reg.add("newtmgr_task_runtime_total", "counter",
+			"Total run time of a task, in device ticks.",
+			float64(t["runtime"]), profile, task)
+		reg.add("newtmgr_task_context_switches_total", "counter",
+			"Number of times a task has been switched in.",
+			float64(t["cswcnt"]), profile, task)
+		reg.add("newtmgr_task_stack_size", "gauge",
+			"Size of a task's stack, in stack units.",
+			float64(t["stksiz"]), profile, task)
+		reg.add("newtmgr_task_stack_used", "gauge",
+			"High-water mark of a task's stack usage, in stack units.",
+			float64(t["stkuse"]), profile, task)
+		reg.add("newtmgr_task_last_checkin", "gauge",
+			"Time of a task's last watchdog check-in, in device ticks.",
+			float64(t["last_checkin"]), profile, task)
+		reg.add("newtmgr_task_next_checkin", "gauge",
+			"Time of a task's next watchdog check-in, in device ticks.",
+			float64(t["next_checkin"]), profile, task)
+	}
+
+	return nil
+}
+
+// Reads all metrics from the device.  An error is returned if the device
+// could not be reached.
+func exporterPoll(s sesn.Sesn, profile promLabel) (*promRegistry, error) {
+	if !s.IsOpen() {
+		if err := s.Open(); err != nil {
+			return nil, err
+		}
+	}
+
+	reg := newPromRegistry()
+
+	if err := exporterPollStats(s, reg, profile); err != nil {
+		return nil, err
+	}
+	if err := exporterPollMempools(s, reg, profile); err != nil {
+		return nil, err
+	}
+	if err := exporterPollTasks(s, reg, profile); err != nil {
+		return nil, err
+	}
+
+	return reg, nil
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $server                                                                  //
+//////////////////////////////////////////////////////////////////////////////
+
+// Holds the results of the most recent poll.
+type exporterState struct {
+	mtx sync.Mutex
+
+	profile     promLabel
+	device      *promRegistry
+	up          bool
+	polls       int
+	failures    int
+	lastSuccess time.Time
+	duration    time.Duration
+}
+
+func (st *exporterState) update(reg *promRegistry, duration time.Duration) {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+
+	st.polls++
+	st.duration = duration
+	if reg == nil {
+		// Don't serve stale device metrics.
+		st.up = false
+		st.device = nil
+		st.failures++
+	} else {
+		st.up = true
+		st.device = reg
+		st.lastSuccess = time.Now()
+	}
+}
+
+func (st *exporterState) write(w io.Writer) {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+
+	reg := newPromRegistry()
+	if st.device != nil {
+		for name, f := range st.device.families {
+			reg.families[name] = f
+		}
+	}
+
+	up := 0.0
+	if st.up {
+		up = 1.0
+	}
+	reg.add("newtmgr_up", "gauge",
+		"Whether the most recent poll of the device succeeded.",
+		up, st.profile)
+	reg.add("newtmgr_polls_total", "counter",
+		"Number of times the device has been polled.",
+		float64(st.polls), st.profile)
+	reg.add("newtmgr_poll_failures_total", "counter",
+		"Number of polls that failed to reach the device.",
+		float64(st.failures), st.profile)
+	reg.add("newtmgr_poll_duration_seconds", "gauge",
+		"Duration of the most recent poll.",
+		st.duration.Seconds(), st.profile)
+	if !st.lastSuccess.IsZero() {
+		reg.add("newtmgr_last_success_timestamp_seconds", "gauge",
+			"Time of the most recent successful poll.",
+			float64(st.lastSuccess.UnixNano())/1e9, st.profile)
+	}
+
+	reg.write(w)
+}
+
+func (st *exporterState) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	st.write(&buf)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(buf.Bytes())
+}
+
+func exporterRunCmd(cmd *cobra.Command, args []string) {
+	if exporterInterval <= 0 {
+		nmUsage(cmd, util.NewNewtError("interval must be positive"))
+	}
+
+	cp, err := getConnProfile()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	st := &exporterState{
+		profile: promLabel{"profile", cp.Name},
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", st)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "%s exporter; metrics are at /metrics\n",
+			nmutil.ToolInfo.LongName)
+	})
+
+	go func() {
+		var s sesn.Sesn
+
+		for {
+			start := time.Now()
+
+			// The device may not be reachable when the exporter starts;
+			// keep trying to connect.
+			var reg *promRegistry
+			var err error
+			if s == nil {
+				s, err = GetSesn()
+			}
+			if s != nil {
+				reg, err = exporterPoll(s, st.profile)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: poll failed: %s\n",
+					err.Error())
+			}
+			st.update(reg, time.Since(start))
+
+			time.Sleep(exporterInterval)
+		}
+	}()
+
+	fmt.Printf("Serving metrics on %s/metrics\n", exporterListen)
+	if err := http.ListenAndServe(exporterListen, mux); err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+}
+
+func exporterCmd() *cobra.Command {
+	exporterHelpText := "Periodically read statistics, memory pool " +
+		"statistics, and task statistics from\na device and serve them " +
+		"as Prometheus metrics.  The session to the device is\nkept " +
+		"open between polls.  If a poll fails, the newtmgr_up metric is " +
+		"set to 0\nand the device metrics are omitted until the device " +
+		"can be reached again."
+
+	exporterEx := "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex exporter\n"
+	exporterEx += "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex exporter --listen 127.0.0.1:9300 --interval 30s\n"
+
+	exporterCmd := &cobra.Command{
+		Use:     "exporter -c <conn_profile>",
+		Short:   "Serve device statistics as Prometheus metrics",
+		Long:    exporterHelpText,
+		Example: exporterEx,
+		Run:     exporterRunCmd,
+	}
+	exporterCmd.Flags().StringVar(&exporterListen, "listen", ":9300",
+		"Address to serve metrics on")
+	exporterCmd.Flags().DurationVar(&exporterInterval, "interval",
+		15*time.Second, "Time between polls of the device")
+
+	return exporterCmd
+}
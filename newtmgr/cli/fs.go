@@ -20,24 +20,67 @@
 package cli
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"io/ioutil"
+	"hash"
+	"hash/crc32"
+	"io"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
 
 	"github.com/spf13/cobra"
+	pb "gopkg.in/cheggaaa/pb.v1"
 
 	"mynewt.apache.org/newt/util"
 	"mynewt.apache.org/newtmgr/newtmgr/nmutil"
 	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
 	"mynewt.apache.org/newtmgr/nmxact/xact"
 )
 
+var (
+	fsDownloadOff    uint32
+	fsDownloadLen    uint32
+	fsDownloadResume bool
+	fsHashType       string
+	fsHashOff        uint32
+	fsHashLen        uint32
+	fsSyncDryRun     bool
+)
+
+// errFsNoLs indicates that the device doesn't implement the directory
+// listing extension.
+var errFsNoLs = util.NewNewtError(
+	"device does not support directory listing")
+
+// fsRc extracts the NMP status code from the outcome of an fs command,
+// whether the device reported it in the response or as a group error.
+func fsRc(res xact.Result, err error) (int, error) {
+	if err != nil {
+		if gerr := nmp.ToNmpGroup(err); gerr != nil {
+			return gerr.Rc, nil
+		}
+		return 0, err
+	}
+
+	return res.Status(), nil
+}
+
 func fsDownloadRunCmd(cmd *cobra.Command, args []string) {
 	if len(args) < 2 {
 		nmUsage(cmd, nil)
 	}
 
-	file, err := os.OpenFile(args[1], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0660)
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if fsDownloadResume {
+		flags = os.O_RDWR | os.O_CREATE | os.O_APPEND
+	}
+
+	file, err := os.OpenFile(args[1], flags, 0660)
 	if err != nil {
 		nmUsage(cmd, util.FmtNewtError(
 			"Cannot open file %s - %s", args[1], err.Error()))
@@ -49,14 +92,39 @@ func fsDownloadRunCmd(cmd *cobra.Command, args []string) {
 		nmUsage(nil, err)
 	}
 
+	off := int(fsDownloadOff)
+	length := int(fsDownloadLen)
+
+	// When resuming, the local file holds the start of the requested range;
+	// continue from where it ends.
+	if fsDownloadResume {
+		have, err := fsResumeSize(s, args[0], off, length, file)
+		if err != nil {
+			nmUsage(nil, util.ChildNewtError(err))
+		}
+
+		if length > 0 {
+			if have == length {
+				fmt.Printf("Done\n")
+				return
+			}
+			length -= have
+		}
+		off += have
+
+		if have > 0 {
+			fmt.Printf("Resuming at offset %d\n", off)
+		}
+	}
+
 	c := xact.NewFsDownloadCmd()
 	c.SetTxOptions(nmutil.TxOptions())
 	c.Name = args[0]
+	c.Off = off
+	c.Len = length
+	c.Writer = file
 	c.ProgressCb = func(c *xact.FsDownloadCmd, rsp *nmp.FsDownloadRsp) {
 		fmt.Printf("%d\n", rsp.Off)
-		if _, err := file.Write(rsp.Data); err != nil {
-			nmUsage(nil, util.ChildNewtError(err))
-		}
 	}
 
 	res, err := c.Run(s)
@@ -67,19 +135,68 @@ func fsDownloadRunCmd(cmd *cobra.Command, args []string) {
 	sres := res.(*xact.FsDownloadResult)
 	rsp := sres.Rsps[len(sres.Rsps)-1]
 	if rsp.Rc != 0 {
-		fmt.Printf("Error: %d\n", rsp.Rc)
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(rsp.Rc))
 		return
 	}
 
 	fmt.Printf("Done\n")
 }
 
+// fsResumeSize determines how much of a partial download can be kept.  The
+// local file must hold the start of the requested range of the remote file;
+// if the device's copy of that data differs, or can't be checked, the local
+// file is truncated so that the download starts over.
+func fsResumeSize(s sesn.Sesn, name string, off int, length int,
+	file *os.File) (int, error) {
+
+	fi, err := file.Stat()
+	if err != nil {
+		return 0, util.ChildNewtError(err)
+	}
+	have := fi.Size()
+	if have == 0 {
+		return 0, nil
+	}
+
+	var reason string
+	if length > 0 && have > int64(length) {
+		reason = "partial file is larger than the requested range"
+	} else {
+		match, rc, err := fsCompareHash(s, name, off, file, have)
+		if err != nil {
+			return 0, err
+		}
+		if rc != 0 {
+			reason = "unable to verify partial file: " +
+				nmp.NmpRcToString(rc)
+		} else if !match {
+			reason = "partial file does not match the device's copy"
+		}
+	}
+
+	if reason != "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s; starting over\n", reason)
+		if err := file.Truncate(0); err != nil {
+			return 0, util.ChildNewtError(err)
+		}
+		return 0, nil
+	}
+
+	return int(have), nil
+}
+
 func fsUploadRunCmd(cmd *cobra.Command, args []string) {
 	if len(args) < 2 {
 		nmUsage(cmd, nil)
 	}
 
-	data, err := ioutil.ReadFile(args[0])
+	file, err := os.Open(args[0])
+	if err != nil {
+		nmUsage(cmd, util.ChildNewtError(err))
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
 	if err != nil {
 		nmUsage(cmd, util.ChildNewtError(err))
 	}
@@ -92,7 +209,8 @@ func fsUploadRunCmd(cmd *cobra.Command, args []string) {
 	c := xact.NewFsUploadCmd()
 	c.SetTxOptions(nmutil.TxOptions())
 	c.Name = args[1]
-	c.Data = data
+	c.Reader = file
+	c.Size = int(fi.Size())
 	c.ProgressCb = func(c *xact.FsUploadCmd, rsp *nmp.FsUploadRsp) {
 		fmt.Printf("%d\n", rsp.Off)
 	}
@@ -105,13 +223,697 @@ func fsUploadRunCmd(cmd *cobra.Command, args []string) {
 	sres := res.(*xact.FsUploadResult)
 	rsp := sres.Rsps[len(sres.Rsps)-1]
 	if rsp.Rc != 0 {
-		fmt.Printf("Error: %d\n", rsp.Rc)
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(rsp.Rc))
+		return
+	}
+
+	fsVerifyUpload(s, file, fi.Size(), args[1])
+
+	fmt.Printf("Done\n")
+}
+
+// fsLocalHash calculates a hash or checksum of local data in the same form
+// that a device reports it.
+func fsLocalHash(r io.ReaderAt, size int64, typ string) ([]byte, error) {
+	var h hash.Hash
+	switch typ {
+	case nmp.FS_HASH_CRC32:
+		h = crc32.NewIEEE()
+	case nmp.FS_HASH_SHA256:
+		h = sha256.New()
+	default:
+		return nil, util.FmtNewtError("Unsupported hash type: %s", typ)
+	}
+
+	if _, err := io.Copy(h, io.NewSectionReader(r, 0, size)); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return h.Sum(nil), nil
+}
+
+// fsDeviceHash retrieves a hash or checksum of part of a file on the device;
+// a length of 0 covers the rest of the file.  If the device rejects the
+// request, the NMP status code is returned.
+func fsDeviceHash(s sesn.Sesn, name string, typ string, off int,
+	length int) ([]byte, int, error) {
+
+	c := xact.NewFsHashCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+	c.Name = name
+	c.Type = typ
+	c.Off = off
+	c.Len = length
+
+	res, err := c.Run(s)
+	if err != nil {
+		if gerr := nmp.ToNmpGroup(err); gerr != nil {
+			return nil, gerr.Rc, nil
+		}
+		return nil, 0, err
+	}
+
+	sres := res.(*xact.FsHashResult)
+	if sres.Status() != 0 {
+		return nil, sres.Status(), nil
+	}
+
+	sum, err := sres.Rsp.Sum()
+	if err != nil {
+		return nil, 0, util.ChildNewtError(err)
+	}
+
+	return sum, 0, nil
+}
+
+// fsCompareHash compares the hash of part of a file on the device, starting
+// at the specified offset, with that of the local data.  SHA256 is preferred;
+// CRC32 is used if the device doesn't support it.  If the device can't hash
+// the file, the NMP status code is returned.
+func fsCompareHash(s sesn.Sesn, name string, off int, r io.ReaderAt,
+	size int64) (bool, int, error) {
+
+	for _, typ := range []string{nmp.FS_HASH_SHA256, nmp.FS_HASH_CRC32} {
+		sum, rc, err := fsDeviceHash(s, name, typ, off, int(size))
+		if err != nil {
+			return false, 0, err
+		}
+		if rc == nmp.NMP_ERR_ENOTSUP {
+			continue
+		}
+		if rc != 0 {
+			return false, rc, nil
+		}
+
+		local, err := fsLocalHash(r, size, typ)
+		if err != nil {
+			return false, 0, err
+		}
+
+		return bytes.Equal(sum, local), 0, nil
+	}
+
+	return false, nmp.NMP_ERR_ENOTSUP, nil
+}
+
+// fsVerifyUpload compares the hash of an uploaded file with that of the local
+// copy.
+func fsVerifyUpload(s sesn.Sesn, r io.ReaderAt, size int64, name string) {
+	match, rc, err := fsCompareHash(s, name, 0, r, size)
+	if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+	if rc != 0 {
+		fmt.Printf("Warning: unable to verify upload of %s: %s\n", name,
+			nmp.NmpRcToString(rc))
+		return
+	}
+
+	if !match {
+		nmUsage(nil, util.FmtNewtError(
+			"Upload verification of %s failed; hash mismatch", name))
+	}
+}
+
+func fsStatRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		nmUsage(cmd, nil)
+	}
+
+	s, err := GetSesn()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	c := xact.NewFsStatCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+	c.Name = args[0]
+
+	res, err := c.Run(s)
+	if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+
+	sres := res.(*xact.FsStatResult)
+	if sres.Status() != 0 {
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(sres.Status()))
+		return
+	}
+
+	fmt.Printf("%s: %d bytes\n", args[0], sres.Rsp.Len)
+}
+
+func fsHashRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		nmUsage(cmd, nil)
+	}
+
+	if fsHashType != nmp.FS_HASH_CRC32 && fsHashType != nmp.FS_HASH_SHA256 {
+		nmUsage(cmd, util.FmtNewtError("Invalid hash type: %s", fsHashType))
+	}
+
+	s, err := GetSesn()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	c := xact.NewFsHashCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+	c.Name = args[0]
+	c.Type = fsHashType
+	c.Off = int(fsHashOff)
+	c.Len = int(fsHashLen)
+
+	res, err := c.Run(s)
+	if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+
+	sres := res.(*xact.FsHashResult)
+	if sres.Status() != 0 {
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(sres.Status()))
+		return
+	}
+
+	sum, err := sres.Rsp.Sum()
+	if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+
+	fmt.Printf("%s (off=%d len=%d): %s\n", sres.Rsp.Type, sres.Rsp.Off,
+		sres.Rsp.Len, hex.EncodeToString(sum))
+}
+
+func fsLsRunCmd(cmd *cobra.Command, args []string) {
+	dir := "/"
+	if len(args) >= 1 {
+		dir = args[0]
+	}
+
+	s, err := GetSesn()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	c := xact.NewFsLsCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+	c.Name = dir
+
+	res, err := c.Run(s)
+	rc, err := fsRc(res, err)
+	if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+	if rc == nmp.NMP_ERR_ENOTSUP {
+		nmUsage(nil, errFsNoLs)
+	}
+	if rc != 0 {
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(rc))
+		return
+	}
+
+	sres := res.(*xact.FsLsResult)
+	for _, e := range sres.Entries {
+		if e.Type == nmp.FS_ENTRY_TYPE_DIR {
+			fmt.Printf("%10s %s/\n", "<dir>", e.Name)
+		} else {
+			fmt.Printf("%10d %s\n", e.Len, e.Name)
+		}
+	}
+}
+
+func fsRmRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		nmUsage(cmd, nil)
+	}
+
+	s, err := GetSesn()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	c := xact.NewFsUnlinkCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+	c.Name = args[0]
+
+	res, err := c.Run(s)
+	if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+
+	sres := res.(*xact.FsUnlinkResult)
+	if sres.Status() != 0 {
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(sres.Status()))
 		return
 	}
 
 	fmt.Printf("Done\n")
 }
 
+func fsMkdirRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		nmUsage(cmd, nil)
+	}
+
+	s, err := GetSesn()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	c := xact.NewFsMkdirCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+	c.Name = args[0]
+
+	res, err := c.Run(s)
+	if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+
+	sres := res.(*xact.FsMkdirResult)
+	if sres.Status() != 0 {
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(sres.Status()))
+		return
+	}
+
+	fmt.Printf("Done\n")
+}
+
+// fsSyncFile is a file that fs push or fs pull may transfer.
+type fsSyncFile struct {
+	rel    string // Path relative to the synchronized directories.
+	local  string
+	remote string
+	size   int64
+}
+
+// fsRemoteTree lists the files and directories under a remote directory,
+// keyed by their paths relative to it.  It returns nil if the directory
+// doesn't exist, and errFsNoLs if the device can't list directories.
+func fsRemoteTree(s sesn.Sesn, dir string) (map[string]nmp.FsEntry, error) {
+	tree := map[string]nmp.FsEntry{}
+
+	var walk func(rel string) (bool, error)
+	walk = func(rel string) (bool, error) {
+		c := xact.NewFsLsCmd()
+		c.SetTxOptions(nmutil.TxOptions())
+		c.Name = path.Join(dir, rel)
+
+		res, err := c.Run(s)
+		rc, err := fsRc(res, err)
+		if err != nil {
+			return false, err
+		}
+		switch rc {
+		case 0:
+		case nmp.NMP_ERR_ENOENT:
+			return false, nil
+		case nmp.NMP_ERR_ENOTSUP:
+			return false, errFsNoLs
+		default:
+			return false, util.FmtNewtError("Cannot list %s: %s", c.Name,
+				nmp.NmpRcToString(rc))
+		}
+
+		sres := res.(*xact.FsLsResult)
+		for _, e := range sres.Entries {
+			erel := path.Join(rel, e.Name)
+			tree[erel] = e
+			if e.Type == nmp.FS_ENTRY_TYPE_DIR {
+				if _, err := walk(erel); err != nil {
+					return false, err
+				}
+			}
+		}
+
+		return true, nil
+	}
+
+	exists, err := walk("")
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	return tree, nil
+}
+
+// fsRemoteSize retrieves the size of a file on the device.  If the device
+// rejects the request, the NMP status code is returned.
+func fsRemoteSize(s sesn.Sesn, name string) (int64, int, error) {
+	c := xact.NewFsStatCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+	c.Name = name
+
+	res, err := c.Run(s)
+	rc, err := fsRc(res, err)
+	if err != nil || rc != 0 {
+		return 0, rc, err
+	}
+
+	return int64(res.(*xact.FsStatResult).Rsp.Len), 0, nil
+}
+
+// fsUpToDate indicates whether a remote file has the same contents as a local
+// one.  The caller has already determined that both files have the same size.
+func fsUpToDate(s sesn.Sesn, f fsSyncFile) (bool, error) {
+	file, err := os.Open(f.local)
+	if err != nil {
+		return false, util.ChildNewtError(err)
+	}
+	defer file.Close()
+
+	match, rc, err := fsCompareHash(s, f.remote, 0, file, f.size)
+	if err != nil {
+		return false, err
+	}
+
+	// If the device can't hash the file, transfer it to be safe.
+	return rc == 0 && match, nil
+}
+
+// fsSyncBar creates a progress bar that tracks the transfer of all the
+// specified files.
+func fsSyncBar(files []fsSyncFile) *pb.ProgressBar {
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+
+	bar := pb.New64(total)
+	bar.SetUnits(pb.U_BYTES)
+	bar.ShowSpeed = true
+	return bar.Start()
+}
+
+func fsPushRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		nmUsage(cmd, nil)
+	}
+	localDir := args[0]
+	remoteDir := path.Clean(args[1])
+
+	var files []fsSyncFile
+	var dirs []string
+	err := filepath.Walk(localDir,
+		func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(localDir, p)
+			if err != nil {
+				return err
+			}
+			if rel == "." {
+				return nil
+			}
+			rel = filepath.ToSlash(rel)
+
+			if info.IsDir() {
+				dirs = append(dirs, rel)
+			} else if info.Mode().IsRegular() {
+				files = append(files, fsSyncFile{
+					rel:    rel,
+					local:  p,
+					remote: path.Join(remoteDir, rel),
+					size:   info.Size(),
+				})
+			}
+			return nil
+		})
+	if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+
+	s, err := GetSesn()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	// Without directory listing, examine each file individually and create
+	// every directory, as it is unknown which ones already exist.
+	listed := true
+	tree, err := fsRemoteTree(s, remoteDir)
+	if err == errFsNoLs {
+		fmt.Fprintf(os.Stderr, "Warning: %s; checking files individually\n",
+			err.Error())
+		listed = false
+	} else if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+
+	// Determine which directories need to be created.
+	var mkdirs []string
+	if tree == nil {
+		mkdirs = append(mkdirs, remoteDir)
+	}
+	for _, d := range dirs {
+		if _, ok := tree[d]; !ok {
+			mkdirs = append(mkdirs, path.Join(remoteDir, d))
+		}
+	}
+
+	// Determine which files need to be uploaded.
+	var xfers []fsSyncFile
+	for _, f := range files {
+		var size int64 = -1
+		if listed {
+			e, ok := tree[f.rel]
+			if ok && e.Type == nmp.FS_ENTRY_TYPE_FILE {
+				size = int64(e.Len)
+			}
+		} else {
+			sz, rc, err := fsRemoteSize(s, f.remote)
+			if err != nil {
+				nmUsage(nil, util.ChildNewtError(err))
+			}
+			if rc == 0 {
+				size = sz
+			}
+		}
+
+		same := false
+		if size == f.size {
+			same, err = fsUpToDate(s, f)
+			if err != nil {
+				nmUsage(nil, util.ChildNewtError(err))
+			}
+		}
+		if same {
+			fmt.Printf("skip   %s (up to date)\n", f.remote)
+		} else {
+			xfers = append(xfers, f)
+		}
+	}
+
+	if fsSyncDryRun {
+		for _, d := range mkdirs {
+			if listed {
+				fmt.Printf("mkdir  %s\n", d)
+			} else {
+				fmt.Printf("mkdir  %s (if missing)\n", d)
+			}
+		}
+		for _, f := range xfers {
+			fmt.Printf("upload %s -> %s (%d bytes)\n", f.local, f.remote,
+				f.size)
+		}
+		return
+	}
+
+	for _, d := range mkdirs {
+		c := xact.NewFsMkdirCmd()
+		c.SetTxOptions(nmutil.TxOptions())
+		c.Name = d
+
+		res, err := c.Run(s)
+		rc, err := fsRc(res, err)
+		if err != nil {
+			nmUsage(nil, util.ChildNewtError(err))
+		}
+
+		// Directory creation is also an extension.  If the device lacks
+		// it, the directories must already exist.
+		if rc == nmp.NMP_ERR_ENOTSUP {
+			if listed {
+				nmUsage(nil, util.FmtNewtError(
+					"Cannot create %s: device does not support creating "+
+						"directories", d))
+			}
+			fmt.Fprintf(os.Stderr, "Warning: device does not support "+
+				"creating directories; assuming they exist\n")
+			break
+		}
+
+		// Unless the directory was known to be missing, a failure most
+		// likely means that it already exists.
+		if rc != 0 && listed {
+			fmt.Printf("Error: %s: %s\n", d, nmp.NmpRcToString(rc))
+			return
+		}
+	}
+
+	bar := fsSyncBar(xfers)
+	for _, f := range xfers {
+		file, err := os.Open(f.local)
+		if err != nil {
+			nmUsage(nil, util.ChildNewtError(err))
+		}
+
+		var last uint32
+		c := xact.NewFsUploadCmd()
+		c.SetTxOptions(nmutil.TxOptions())
+		c.Name = f.remote
+		c.Reader = file
+		c.Size = int(f.size)
+		c.ProgressCb = func(c *xact.FsUploadCmd, rsp *nmp.FsUploadRsp) {
+			if rsp.Off > last {
+				bar.Add(int(rsp.Off - last))
+				last = rsp.Off
+			}
+		}
+
+		res, err := c.Run(s)
+		if err != nil {
+			nmUsage(nil, util.ChildNewtError(err))
+		}
+		if res.Status() != 0 {
+			bar.Finish()
+			fmt.Printf("Error: %s: %s\n", f.remote,
+				nmp.NmpRcToString(res.Status()))
+			return
+		}
+
+		fsVerifyUpload(s, file, f.size, f.remote)
+		file.Close()
+	}
+	bar.Finish()
+
+	fmt.Printf("Done; uploaded %d file(s), %d up to date\n",
+		len(xfers), len(files)-len(xfers))
+}
+
+func fsPullRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		nmUsage(cmd, nil)
+	}
+	remoteDir := path.Clean(args[0])
+	localDir := args[1]
+
+	s, err := GetSesn()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	tree, err := fsRemoteTree(s, remoteDir)
+	if err == errFsNoLs {
+		nmUsage(nil, util.FmtNewtError("Cannot pull %s: %s", remoteDir,
+			err.Error()))
+	} else if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+	if tree == nil {
+		nmUsage(nil, util.FmtNewtError("No such directory: %s", remoteDir))
+	}
+
+	rels := make([]string, 0, len(tree))
+	for rel := range tree {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+
+	var dirs []string
+	var files []fsSyncFile
+	var xfers []fsSyncFile
+	for _, rel := range rels {
+		e := tree[rel]
+		local := filepath.Join(localDir, filepath.FromSlash(rel))
+		if e.Type == nmp.FS_ENTRY_TYPE_DIR {
+			dirs = append(dirs, local)
+			continue
+		}
+
+		f := fsSyncFile{
+			rel:    rel,
+			local:  local,
+			remote: path.Join(remoteDir, rel),
+			size:   int64(e.Len),
+		}
+		files = append(files, f)
+
+		same := false
+		info, err := os.Stat(local)
+		if err == nil && info.Mode().IsRegular() && info.Size() == f.size {
+			same, err = fsUpToDate(s, f)
+			if err != nil {
+				nmUsage(nil, util.ChildNewtError(err))
+			}
+		}
+		if same {
+			fmt.Printf("skip     %s (up to date)\n", f.local)
+		} else {
+			xfers = append(xfers, f)
+		}
+	}
+
+	if fsSyncDryRun {
+		for _, f := range xfers {
+			fmt.Printf("download %s -> %s (%d bytes)\n", f.remote, f.local,
+				f.size)
+		}
+		return
+	}
+
+	for _, d := range append([]string{localDir}, dirs...) {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			nmUsage(nil, util.ChildNewtError(err))
+		}
+	}
+
+	bar := fsSyncBar(xfers)
+	for _, f := range xfers {
+		// Download to a temporary file so that a failed transfer doesn't
+		// clobber the existing copy.
+		tmpName := f.local + ".tmp"
+		file, err := os.Create(tmpName)
+		if err != nil {
+			nmUsage(nil, util.ChildNewtError(err))
+		}
+
+		c := xact.NewFsDownloadCmd()
+		c.SetTxOptions(nmutil.TxOptions())
+		c.Name = f.remote
+		c.Writer = file
+		c.ProgressCb = func(c *xact.FsDownloadCmd, rsp *nmp.FsDownloadRsp) {
+			bar.Add(len(rsp.Data))
+		}
+
+		res, err := c.Run(s)
+		file.Close()
+		if err != nil {
+			os.Remove(tmpName)
+			nmUsage(nil, util.ChildNewtError(err))
+		}
+		if res.Status() != 0 {
+			os.Remove(tmpName)
+			bar.Finish()
+			fmt.Printf("Error: %s: %s\n", f.remote,
+				nmp.NmpRcToString(res.Status()))
+			return
+		}
+
+		if err := os.Rename(tmpName, f.local); err != nil {
+			nmUsage(nil, util.ChildNewtError(err))
+		}
+	}
+	bar.Finish()
+
+	fmt.Printf("Done; downloaded %d file(s), %d up to date\n",
+		len(xfers), len(files)-len(xfers))
+}
+
 func fsCmd() *cobra.Command {
 	fsCmd := &cobra.Command{
 		Use:   "fs",
@@ -133,15 +935,134 @@ func fsCmd() *cobra.Command {
 	fsCmd.AddCommand(uploadCmd)
 
 	downloadEx := "  " + nmutil.ToolInfo.ExeName +
-		" -c olimex image download /cfg/mfg mfg.txt\n"
+		" -c olimex fs download /cfg/mfg mfg.txt\n"
+	downloadEx += "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex fs download --off 4096 --len 1024 /log/boot boot.txt\n"
+	downloadEx += "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex fs download --resume /log/boot boot.txt\n"
 
 	downloadCmd := &cobra.Command{
-		Use:     "download <src-filename> <dst-filename> -c <conn_profile>",
-		Short:   "Download file from a device",
+		Use:   "download <src-filename> <dst-filename> -c <conn_profile>",
+		Short: "Download file from a device",
+		Long: "Download a file from a device.  Data is written to the " +
+			"destination file as it arrives.\n\n" +
+			"With --off and --len, only the specified range of the file is " +
+			"downloaded.  With --resume, an interrupted download continues " +
+			"from the end of the partial destination file rather than " +
+			"starting over, provided that the device's copy of the data " +
+			"it holds is unchanged.",
 		Example: downloadEx,
 		Run:     fsDownloadRunCmd,
 	}
+	downloadCmd.Flags().Uint32Var(&fsDownloadOff, "off", 0,
+		"Offset of the first byte to download")
+	downloadCmd.Flags().Uint32Var(&fsDownloadLen, "len", 0,
+		"Number of bytes to download (0 for the rest of the file)")
+	downloadCmd.Flags().BoolVar(&fsDownloadResume, "resume", false,
+		"Continue an interrupted download from the size of the "+
+			"destination file if its contents match the device's")
 	fsCmd.AddCommand(downloadCmd)
 
+	statEx := "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex fs stat /cfg/mfg\n"
+
+	statCmd := &cobra.Command{
+		Use:     "stat <filename> -c <conn_profile>",
+		Short:   "Display the size of a file on a device",
+		Example: statEx,
+		Run:     fsStatRunCmd,
+	}
+	fsCmd.AddCommand(statCmd)
+
+	hashEx := "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex fs hash /cfg/mfg\n"
+	hashEx += "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex fs hash --type crc32 --off 512 --len 1024 /cfg/mfg\n"
+
+	hashCmd := &cobra.Command{
+		Use:     "hash <filename> -c <conn_profile>",
+		Short:   "Calculate a hash or checksum of a file on a device",
+		Example: hashEx,
+		Run:     fsHashRunCmd,
+	}
+	hashCmd.Flags().StringVar(&fsHashType, "type", nmp.FS_HASH_SHA256,
+		"Hash type (crc32 or sha256)")
+	hashCmd.Flags().Uint32Var(&fsHashOff, "off", 0,
+		"Offset of the first byte to hash")
+	hashCmd.Flags().Uint32Var(&fsHashLen, "len", 0,
+		"Number of bytes to hash (0 for the rest of the file)")
+	fsCmd.AddCommand(hashCmd)
+
+	lsEx := "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex fs ls /cfg\n"
+
+	lsCmd := &cobra.Command{
+		Use:     "ls [directory] -c <conn_profile>",
+		Short:   "List the contents of a directory on a device",
+		Example: lsEx,
+		Run:     fsLsRunCmd,
+	}
+	fsCmd.AddCommand(lsCmd)
+
+	rmEx := "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex fs rm /cfg/mfg\n"
+
+	rmCmd := &cobra.Command{
+		Use:     "rm <filename> -c <conn_profile>",
+		Short:   "Delete a file or an empty directory on a device",
+		Example: rmEx,
+		Run:     fsRmRunCmd,
+	}
+	fsCmd.AddCommand(rmCmd)
+
+	mkdirEx := "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex fs mkdir /cfg\n"
+
+	mkdirCmd := &cobra.Command{
+		Use:     "mkdir <directory> -c <conn_profile>",
+		Short:   "Create a directory on a device",
+		Example: mkdirEx,
+		Run:     fsMkdirRunCmd,
+	}
+	fsCmd.AddCommand(mkdirCmd)
+
+	pushEx := "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex fs push cfg-bundle /cfg\n"
+	pushEx += "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex fs push --dry-run cfg-bundle /cfg\n"
+
+	pushCmd := &cobra.Command{
+		Use:   "push <local-dir> <remote-dir> -c <conn_profile>",
+		Short: "Upload the contents of a directory to a device",
+		Long: "Upload the contents of a local directory, including its " +
+			"subdirectories, to a directory on a device.  Files that " +
+			"are already present on the device with the same size and " +
+			"hash are skipped.",
+		Example: pushEx,
+		Run:     fsPushRunCmd,
+	}
+	pushCmd.Flags().BoolVar(&fsSyncDryRun, "dry-run", false,
+		"Only display the planned transfers")
+	fsCmd.AddCommand(pushCmd)
+
+	pullEx := "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex fs pull /cfg cfg-bundle\n"
+	pullEx += "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex fs pull --dry-run /cfg cfg-bundle\n"
+
+	pullCmd := &cobra.Command{
+		Use:   "pull <remote-dir> <local-dir> -c <conn_profile>",
+		Short: "Download the contents of a directory from a device",
+		Long: "Download the contents of a directory on a device, including " +
+			"its subdirectories, to a local directory.  Files that are " +
+			"already present locally with the same size and hash are " +
+			"skipped.",
+		Example: pullEx,
+		Run:     fsPullRunCmd,
+	}
+	pullCmd.Flags().BoolVar(&fsSyncDryRun, "dry-run", false,
+		"Only display the planned transfers")
+	fsCmd.AddCommand(pullCmd)
+
 	return fsCmd
 }
@@ -20,19 +20,27 @@
 package cli
 
 import (
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	pb "gopkg.in/cheggaaa/pb.v1"
 
 	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newtmgr/newtmgr/config"
 	"mynewt.apache.org/newtmgr/newtmgr/core"
 	"mynewt.apache.org/newtmgr/newtmgr/nmutil"
+	"mynewt.apache.org/newtmgr/nmxact/nmimage"
 	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
 	"mynewt.apache.org/newtmgr/nmxact/xact"
 )
 
@@ -46,6 +54,17 @@ var noerase bool
 var upgrade bool
 var imageNum int
 var maxWinSz int
+var uploadForce bool
+var uploadVerifyKey string
+var uploadResume bool
+
+var (
+	deployVerifyKey  string
+	deployResetWait  float64
+	deployCheckEcho  bool
+	deployCheckStats []string
+	deployCheckTest  string
+)
 
 func imageFlagsStr(image nmp.ImageStateEntry) string {
 	strs := []string{}
@@ -68,7 +87,7 @@ func imageFlagsStr(image nmp.ImageStateEntry) string {
 
 func imageStatePrintRsp(rsp *nmp.ImageStateRsp) error {
 	if rsp.Rc != 0 {
-		fmt.Printf("Error: %d\n", rsp.Rc)
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(rsp.Rc))
 		return nil
 	}
 	fmt.Println("Images:")
@@ -107,6 +126,27 @@ func imageStateListCmd(cmd *cobra.Command, args []string) {
 	if err := imageStatePrintRsp(ires.Rsp); err != nil {
 		nmUsage(nil, err)
 	}
+
+	if ires.Rsp.Rc == 0 {
+		imageSplitModePrint(s)
+	}
+}
+
+// imageSplitModePrint shows the split image mode alongside the image list.
+// Devices without split image support are not an error; the mode is simply
+// omitted.
+func imageSplitModePrint(s sesn.Sesn) {
+	c := xact.NewSplitReadCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+
+	res, err := c.Run(s)
+	if err != nil || res.Status() != 0 {
+		return
+	}
+	sres := res.(*xact.SplitReadResult)
+
+	fmt.Printf("Split mode: %s (%d)\n", sres.Rsp.Mode.String(),
+		sres.Rsp.Mode)
 }
 
 func imageStateTestCmd(cmd *cobra.Command, args []string) {
@@ -171,14 +211,294 @@ func imageStateConfirmCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+func splitPrintRsp(rsp *nmp.SplitReadRsp) {
+	if rsp.Rc != 0 {
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(rsp.Rc))
+		return
+	}
+
+	fmt.Printf("Split mode: %s (%d)\n", rsp.Mode.String(), rsp.Mode)
+	fmt.Printf("Split status: %s (%d)\n", rsp.Status.String(), rsp.Status)
+}
+
+func imageSplitCmd(cmd *cobra.Command, args []string) {
+	if len(args) > 1 {
+		nmUsage(cmd, nil)
+	}
+
+	var mode nmp.SplitMode
+	if len(args) == 1 {
+		var err error
+		mode, err = nmp.SplitModeFromString(args[0])
+		if err != nil {
+			nmUsage(cmd, util.ChildNewtError(err))
+		}
+	}
+
+	s, err := GetSesn()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	if len(args) == 1 {
+		c := xact.NewSplitWriteCmd()
+		c.SetTxOptions(nmutil.TxOptions())
+		c.Mode = mode
+
+		res, err := c.Run(s)
+		if err != nil {
+			nmUsage(nil, util.ChildNewtError(err))
+		}
+
+		if res.Status() != 0 {
+			fmt.Printf("Error: %s\n", nmp.NmpRcToString(res.Status()))
+			return
+		}
+	}
+
+	c := xact.NewSplitReadCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+
+	res, err := c.Run(s)
+	if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+	sres := res.(*xact.SplitReadResult)
+
+	splitPrintRsp(sres.Rsp)
+}
+
+// parseImageFile decodes an image and verifies its hash.
+func parseImageFile(data []byte) (*nmimage.Image, error) {
+	img, err := nmimage.ParseImage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := img.VerifyHash(); err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+func imageInspectCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		nmUsage(cmd, util.NewNewtError("Need to specify image to inspect"))
+	}
+
+	imageFile, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+
+	img, err := parseImageFile(imageFile)
+	if err != nil {
+		nmUsage(nil, util.FmtNewtError("Malformed image %s: %s", args[0],
+			err.Error()))
+	}
+
+	hash, _ := img.Hash()
+	hdr := img.Header
+
+	fmt.Printf("Version: %s\n", hdr.Vers)
+	fmt.Printf("Hash: %s\n", hex.EncodeToString(hash))
+	fmt.Printf("Header size: %d\n", hdr.HdrSz)
+	fmt.Printf("Image size: %d\n", hdr.ImgSz)
+	if hdr.Flags == 0 {
+		fmt.Printf("Flags: 0x%08x\n", hdr.Flags)
+	} else {
+		fmt.Printf("Flags: 0x%08x (%s)\n", hdr.Flags,
+			nmimage.ImageFlagsString(hdr.Flags))
+	}
+	if hdr.Flags&nmimage.IMAGE_F_RAM_LOAD != 0 {
+		fmt.Printf("Load address: 0x%08x\n", hdr.LoadAddr)
+	}
+
+	fmt.Printf("TLVs:\n")
+	for _, t := range img.Tlvs {
+		prot := ""
+		if t.Protected {
+			prot = " (protected)"
+		}
+		fmt.Printf("    %s%s (%d bytes)", nmimage.ImageTlvTypeName(t.Type),
+			prot, len(t.Data))
+
+		switch t.Type {
+		case nmimage.IMAGE_TLV_SHA256, nmimage.IMAGE_TLV_KEYHASH:
+			fmt.Printf(": %s", hex.EncodeToString(t.Data))
+		}
+		fmt.Printf("\n")
+	}
+
+	if img.PadSz > 0 {
+		fmt.Printf("Padding: %d bytes after TLVs\n", img.PadSz)
+	}
+}
+
+// readImageFile reads an image from a local file.  If keyFilename is not
+// empty, the image must be signed with the key in that file.  The returned
+// error indicates that the file is not a well-formed image.
+func readImageFile(filename string, keyFilename string) ([]byte, error) {
+	imageFile, err := ioutil.ReadFile(filename)
+	if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+
+	img, err := parseImageFile(imageFile)
+	if err != nil {
+		if keyFilename != "" {
+			nmUsage(nil, util.FmtNewtError("Malformed image %s: %s",
+				filename, err.Error()))
+		}
+		return imageFile, err
+	}
+
+	if keyFilename != "" {
+		keyFile, err := ioutil.ReadFile(keyFilename)
+		if err != nil {
+			nmUsage(nil, util.ChildNewtError(err))
+		}
+
+		pub, err := nmimage.ParsePubKeyPem(keyFile)
+		if err != nil {
+			nmUsage(nil, util.FmtNewtError("Invalid key %s: %s",
+				keyFilename, err.Error()))
+		}
+
+		if err := img.VerifySig(pub); err != nil {
+			nmUsage(nil, util.FmtNewtError("Image %s failed verification: %s",
+				filename, err.Error()))
+		}
+	}
+
+	return imageFile, nil
+}
+
+// imageUploadResume determines where an interrupted upload of imageFile can
+// be continued from.  It returns 0 if there is nothing to resume.
+func imageUploadResume(s sesn.Sesn, us *config.UploadState,
+	imageFile []byte) int {
+
+	if us == nil {
+		fmt.Printf("No interrupted upload to resume; starting from the " +
+			"beginning\n")
+		return 0
+	}
+
+	c := xact.NewImageResumeCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+	c.Data = imageFile
+	c.Off = us.Off
+	c.Upgrade = upgrade
+	c.ImageNum = imageNum
+
+	res, err := c.Run(s)
+	if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+
+	if res.Status() != 0 {
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(res.Status()))
+		NmExit(1)
+	}
+
+	rres := res.(*xact.ImageResumeResult)
+	if rres.Resumed {
+		fmt.Printf("Resuming upload at offset %d\n", rres.Off)
+	} else {
+		fmt.Printf("Device no longer has the partial upload; starting " +
+			"from the beginning\n")
+	}
+
+	return rres.Off
+}
+
+// An upload's progress is saved once it has advanced by this many bytes or
+// this much time has passed, rather than after every chunk.
+const IMAGE_UPLOAD_STATE_SAVE_BYTES = 32 * 1024
+const IMAGE_UPLOAD_STATE_SAVE_INTERVAL = 2 * time.Second
+
+// uploadStateSaver records the progress of an upload so that it can be
+// resumed.  Progress updates arrive from concurrent response handlers.
+type uploadStateSaver struct {
+	usm *config.UploadStateMgr
+	key string
+	us  *config.UploadState
+
+	savedOff  int
+	savedTime time.Time
+	mtx       sync.Mutex
+}
+
+func newUploadStateSaver(usm *config.UploadStateMgr, key string,
+	us *config.UploadState) *uploadStateSaver {
+
+	return &uploadStateSaver{
+		usm:       usm,
+		key:       key,
+		us:        us,
+		savedOff:  us.Off,
+		savedTime: time.Now(),
+	}
+}
+
+// update records the device's new offset.  The state file is only written if
+// enough progress has been made since it was last written.
+func (uss *uploadStateSaver) update(off int) {
+	uss.mtx.Lock()
+	defer uss.mtx.Unlock()
+
+	if off > uss.us.Off {
+		uss.us.Off = off
+	}
+
+	if uss.us.Off-uss.savedOff < IMAGE_UPLOAD_STATE_SAVE_BYTES &&
+		time.Since(uss.savedTime) < IMAGE_UPLOAD_STATE_SAVE_INTERVAL {
+
+		return
+	}
+
+	uss.save()
+}
+
+// flush writes any unsaved progress to the state file.
+func (uss *uploadStateSaver) flush() {
+	uss.mtx.Lock()
+	defer uss.mtx.Unlock()
+
+	if uss.us.Off != uss.savedOff {
+		uss.save()
+	}
+}
+
+func (uss *uploadStateSaver) save() {
+	if err := uss.usm.SetUploadState(uss.key, uss.us); err != nil {
+		log.Debugf("failed to record upload state: %s", err.Error())
+		return
+	}
+
+	uss.savedOff = uss.us.Off
+	uss.savedTime = time.Now()
+}
+
 func imageUploadCmd(cmd *cobra.Command, args []string) {
 	if len(args) < 1 {
 		nmUsage(cmd, util.NewNewtError("Need to specify image to upload"))
 	}
 
-	imageFile, err := ioutil.ReadFile(args[0])
+	imageFile, err := readImageFile(args[0], uploadVerifyKey)
 	if err != nil {
-		nmUsage(cmd, util.NewNewtError(err.Error()))
+		if !uploadForce {
+			nmUsage(nil, util.FmtNewtError("Malformed image %s: %s; use "+
+				"--force to upload it anyway", args[0], err.Error()))
+		}
+		fmt.Fprintf(os.Stderr, "Warning: malformed image %s: %s\n",
+			args[0], err.Error())
+	}
+
+	if imageNum < 0 {
+		nmUsage(cmd, util.NewNewtError("Invalid image number"))
 	}
 
 	s, err := GetSesn()
@@ -186,43 +506,211 @@ func imageUploadCmd(cmd *cobra.Command, args []string) {
 		nmUsage(nil, err)
 	}
 
+	// Keep track of the upload's progress so that it can be resumed if it
+	// gets interrupted.
+	cp, err := getConnProfile()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+	usm, err := config.NewUploadStateMgr()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+	key := connProfileKey(cp)
+
+	sha := sha256.Sum256(imageFile)
+	us := &config.UploadState{
+		Filename: args[0],
+		Hash:     hex.EncodeToString(sha[:]),
+		ImageNum: imageNum,
+	}
+
+	if uploadResume {
+		prev := usm.GetUploadState(key)
+		if prev != nil &&
+			(prev.Hash != us.Hash || prev.ImageNum != us.ImageNum) {
+
+			prev = nil
+		}
+		us.Off = imageUploadResume(s, prev, imageFile)
+	}
+
+	if us.Off >= len(imageFile) {
+		// The final chunk was sent while resuming.
+		if err := usm.DeleteUploadState(key); err != nil {
+			nmUsage(nil, err)
+		}
+		fmt.Printf("Done\n")
+		return
+	}
+
+	if err := usm.SetUploadState(key, us); err != nil {
+		nmUsage(nil, err)
+	}
+
 	c := xact.NewImageUpgradeCmd()
 	c.SetTxOptions(nmutil.TxOptions())
 	c.Data = imageFile
 	if noerase == true {
 		c.NoErase = true
 	}
-	if imageNum < 0 {
-		nmUsage(cmd, util.NewNewtError("Invalid image number"))
-	}
 	c.ImageNum = imageNum
 	c.Upgrade = upgrade
+	c.StartOff = us.Off
 	c.ProgressBar = pb.StartNew(len(imageFile))
 	c.ProgressBar.SetUnits(pb.U_BYTES)
 	c.ProgressBar.ShowSpeed = true
-	c.LastOff = 0
+	c.ProgressBar.Set(us.Off)
+	c.LastOff = uint32(us.Off)
 	c.MaxWinSz = maxWinSz
+
+	uss := newUploadStateSaver(usm, key, us)
 	c.ProgressCb = func(cmd *xact.ImageUploadCmd, rsp *nmp.ImageUploadRsp) {
 		if rsp.Off > c.LastOff {
 			c.ProgressBar.Add(int(rsp.Off - c.LastOff))
 			c.LastOff = rsp.Off
+
+			uss.update(int(rsp.Off))
 		}
 	}
 
+	// Save the latest progress before exiting on Ctrl-C.
+	SetOnInterrupt(func() {
+		uss.flush()
+		SilenceErrors()
+		NmExit(1)
+	})
+	defer SetOnInterrupt(nil)
+
 	res, err := c.Run(s)
 	if err != nil {
+		uss.flush()
 		nmUsage(nil, util.ChildNewtError(err))
 	}
 
 	if res.Status() != 0 {
-		fmt.Printf("Error: %d\n", res.Status())
+		uss.flush()
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(res.Status()))
 		return
 	}
 
+	if err := usm.DeleteUploadState(key); err != nil {
+		nmUsage(nil, err)
+	}
+
 	c.ProgressBar.Finish()
 	fmt.Printf("Done\n")
 }
 
+// parseStatCheck parses a health check of the form <group>:<field>:<max>.
+func parseStatCheck(str string) (xact.ImageDeployStatCheck, error) {
+	sc := xact.ImageDeployStatCheck{}
+
+	parts := strings.Split(str, ":")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		return sc, util.FmtNewtError("Invalid stat check \"%s\"; expected "+
+			"<group>:<field>:<max>", str)
+	}
+
+	max, err := strconv.ParseUint(parts[2], 0, 64)
+	if err != nil {
+		return sc, util.FmtNewtError("Invalid stat check \"%s\": %s", str,
+			err.Error())
+	}
+
+	sc.Group = parts[0]
+	sc.Field = parts[1]
+	sc.Max = max
+	return sc, nil
+}
+
+func imageDeployCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		nmUsage(cmd, util.NewNewtError("Need to specify image to deploy"))
+	}
+
+	imageFile, err := readImageFile(args[0], deployVerifyKey)
+	if err != nil {
+		nmUsage(nil, util.FmtNewtError("Malformed image %s: %s", args[0],
+			err.Error()))
+	}
+
+	c := xact.NewImageDeployCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+	c.Data = imageFile
+	if imageNum < 0 {
+		nmUsage(cmd, util.NewNewtError("Invalid image number"))
+	}
+	c.ImageNum = imageNum
+	c.MaxWinSz = maxWinSz
+	c.ResetWait = time.Duration(deployResetWait * float64(time.Second))
+	c.CheckEcho = deployCheckEcho
+	c.CheckTest = deployCheckTest
+	for _, str := range deployCheckStats {
+		sc, err := parseStatCheck(str)
+		if err != nil {
+			nmUsage(cmd, err)
+		}
+		c.CheckStats = append(c.CheckStats, sc)
+	}
+
+	s, err := GetSesn()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	var bar *pb.ProgressBar
+	var lastOff uint32
+	c.ProgressCb = func(uc *xact.ImageUploadCmd, rsp *nmp.ImageUploadRsp) {
+		if rsp.Off > lastOff {
+			bar.Add(int(rsp.Off - lastOff))
+			lastOff = rsp.Off
+		}
+	}
+	c.StageCb = func(dc *xact.ImageDeployCmd, stage xact.ImageDeployStage) {
+		if bar != nil {
+			bar.Finish()
+			bar = nil
+		}
+
+		switch stage {
+		case xact.IMAGE_DEPLOY_STAGE_UPLOAD:
+			fmt.Printf("Uploading %s\n", args[0])
+			bar = pb.StartNew(len(imageFile))
+			bar.SetUnits(pb.U_BYTES)
+			bar.ShowSpeed = true
+		case xact.IMAGE_DEPLOY_STAGE_TEST:
+			fmt.Printf("Marking image for test\n")
+		case xact.IMAGE_DEPLOY_STAGE_RESET:
+			fmt.Printf("Resetting device\n")
+		case xact.IMAGE_DEPLOY_STAGE_CHECK:
+			fmt.Printf("Running health checks\n")
+		case xact.IMAGE_DEPLOY_STAGE_CONFIRM:
+			fmt.Printf("Confirming image\n")
+		case xact.IMAGE_DEPLOY_STAGE_REVERT:
+			fmt.Printf("Reverting to previous image\n")
+		}
+	}
+
+	res, err := c.Run(s)
+	if err != nil {
+		if dres, ok := res.(*xact.ImageDeployResult); ok && dres.Reverted {
+			fmt.Printf("Device reverted to image %s\n",
+				hex.EncodeToString(dres.PrevHash))
+		}
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+
+	if res.Status() != 0 {
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(res.Status()))
+		return
+	}
+
+	dres := res.(*xact.ImageDeployResult)
+	fmt.Printf("Done; device is running image %s\n",
+		hex.EncodeToString(dres.Hash))
+}
+
 func coreListCmd(cmd *cobra.Command, args []string) {
 	s, err := GetSesn()
 	if err != nil {
@@ -244,7 +732,7 @@ func coreListCmd(cmd *cobra.Command, args []string) {
 	case nmp.NMP_ERR_ENOENT:
 		fmt.Printf("No corefiles\n")
 	default:
-		fmt.Printf("Error: %d\n", ires.Status())
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(ires.Status()))
 	}
 }
 
@@ -269,11 +757,9 @@ func coreDownloadCmd(cmd *cobra.Command, args []string) {
 
 	c := xact.NewCoreLoadCmd()
 	c.SetTxOptions(nmutil.TxOptions())
+	c.Writer = file
 	c.ProgressCb = func(c *xact.CoreLoadCmd, rsp *nmp.CoreLoadRsp) {
 		fmt.Printf("%d\n", rsp.Off)
-		if _, err := file.Write(rsp.Data); err != nil {
-			nmUsage(nil, util.ChildNewtError(err))
-		}
 	}
 
 	res, err := c.Run(s)
@@ -283,7 +769,7 @@ func coreDownloadCmd(cmd *cobra.Command, args []string) {
 
 	sres := res.(*xact.CoreLoadResult)
 	if sres.Status() != 0 {
-		fmt.Printf("Error: %d\n", sres.Status())
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(sres.Status()))
 		return
 	}
 
@@ -318,7 +804,7 @@ func coreEraseCmd(cmd *cobra.Command, args []string) {
 	ires := res.(*xact.CoreEraseResult)
 
 	if ires.Status() != 0 {
-		fmt.Printf("Error: %d\n", ires.Status())
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(ires.Status()))
 		return
 	}
 
@@ -341,7 +827,7 @@ func imageEraseCmd(cmd *cobra.Command, args []string) {
 	ires := res.(*xact.ImageEraseResult)
 
 	if ires.Status() != 0 {
-		fmt.Printf("Error: %d\n", ires.Status())
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(ires.Status()))
 		return
 	}
 
@@ -396,8 +882,30 @@ func imageCmd() *cobra.Command {
 	}
 	imageCmd.AddCommand(confirmCmd)
 
+	splitEx := "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex image split\n"
+	splitEx += "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex image split test\n"
+
+	splitCmd := &cobra.Command{
+		Use:   "split [none|test|run] -c <conn_profile>",
+		Short: "Show or set the split image mode on a device",
+		Long: "If a mode is specified, set the split image mode; \"test\" " +
+			"runs the split application on the next reboot only, \"run\" " +
+			"runs it on every reboot.  The resulting mode and split " +
+			"status are then displayed.",
+		Example: splitEx,
+		Run:     imageSplitCmd,
+	}
+	imageCmd.AddCommand(splitCmd)
+
 	uploadEx := "  " + nmutil.ToolInfo.ExeName +
 		" -c olimex image upload bin/slinky_zero/apps/slinky.img\n"
+	uploadEx += "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex image upload --verify-key root-ec-p256.pem " +
+		"bin/slinky_zero/apps/slinky.img\n"
+	uploadEx += "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex image upload --resume bin/slinky_zero/apps/slinky.img\n"
 
 	uploadCmd := &cobra.Command{
 		Use:     "upload <image-file> -c <conn_profile>",
@@ -419,8 +927,73 @@ func imageCmd() *cobra.Command {
 		"maxwinsize", "w", xact.IMAGE_UPLOAD_DEF_MAX_WS,
 		"Set the maximum size for the window of outstanding chunks in transit. "+
 			"caution:higher num may not translate to better perf and may result in errors")
+	uploadCmd.PersistentFlags().BoolVarP(&uploadForce,
+		"force", "f", false,
+		"Upload the file even if it is not a well-formed image")
+	uploadCmd.PersistentFlags().StringVar(&uploadVerifyKey,
+		"verify-key", "",
+		"Refuse to upload the image unless it is signed with the key in "+
+			"this PEM file")
+	uploadCmd.PersistentFlags().BoolVar(&uploadResume,
+		"resume", false,
+		"Continue an interrupted upload of the same image from where it "+
+			"left off")
 	imageCmd.AddCommand(uploadCmd)
 
+	deployEx := "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex image deploy bin/slinky_zero/apps/slinky.img\n"
+	deployEx += "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex image deploy --check-echo --check-stat mgmt:err:0 " +
+		"--check-test all bin/slinky_zero/apps/slinky.img\n"
+
+	deployCmd := &cobra.Command{
+		Use:   "deploy <image-file> -c <conn_profile>",
+		Short: "Upload, test, and confirm an image on a device",
+		Long: "Upload an image, mark it for test, and reset the device.  " +
+			"Once the device is running the new image, run the specified " +
+			"health checks.  If they pass, the image is confirmed; " +
+			"otherwise the device is reset again so that it reverts to the " +
+			"previous image.",
+		Example: deployEx,
+		Run:     imageDeployCmd,
+	}
+	deployCmd.Flags().IntVarP(&imageNum,
+		"image", "n", 0,
+		"In a multi-image system, which image should be deployed")
+	deployCmd.Flags().IntVarP(&maxWinSz,
+		"maxwinsize", "w", xact.IMAGE_UPLOAD_DEF_MAX_WS,
+		"Set the maximum size for the window of outstanding chunks in "+
+			"transit")
+	deployCmd.Flags().StringVar(&deployVerifyKey, "verify-key", "",
+		"Refuse to deploy the image unless it is signed with the key in "+
+			"this PEM file")
+	deployCmd.Flags().Float64Var(&deployResetWait, "reset-wait",
+		xact.IMAGE_DEPLOY_DEF_RESET_WAIT.Seconds(),
+		"Maximum time, in seconds, to wait for the device to come back "+
+			"after a reset")
+	deployCmd.Flags().BoolVar(&deployCheckEcho, "check-echo", false,
+		"Health check: the device must respond to an echo request")
+	deployCmd.Flags().StringArrayVar(&deployCheckStats, "check-stat", nil,
+		"Health check: <group>:<field>:<max>; the statistic must not "+
+			"exceed <max> (repeatable)")
+	deployCmd.Flags().StringVar(&deployCheckTest, "check-test", "",
+		"Health check: the named test must run successfully")
+	imageCmd.AddCommand(deployCmd)
+
+	inspectEx := "  " + nmutil.ToolInfo.ExeName +
+		" image inspect bin/slinky_zero/apps/slinky.img\n"
+
+	inspectCmd := &cobra.Command{
+		Use:   "inspect <image-file>",
+		Short: "Display the contents of a local image file",
+		Long: "Display the header and trailer of a local image file.  The " +
+			"command fails if the file is not a well-formed image or its " +
+			"hash does not match its contents.",
+		Example: inspectEx,
+		Run:     imageInspectCmd,
+	}
+	imageCmd.AddCommand(inspectCmd)
+
 	coreListCmd := &cobra.Command{
 		Use:     "corelist -c <conn_profile>",
 		Short:   "List core(s) on a device",
@@ -20,15 +20,20 @@
 package cli
 
 import (
+	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"os"
 	"sort"
 	"strconv"
+	"time"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newtmgr/newtmgr/config"
 	"mynewt.apache.org/newtmgr/newtmgr/nmutil"
 	"mynewt.apache.org/newtmgr/nmxact/nmp"
 	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
@@ -37,6 +42,15 @@ import (
 )
 
 var optLogShowFull bool
+var optLogShowFormat string
+var optLogShowModules []string
+var optLogShowLevel string
+var optLogShowMinIndex uint32
+var optLogShowMaxIndex uint32
+var optLogTailIndex uint32
+var optLogNamesFile string
+var optLogRefreshNames bool
+var optLogTailInterval float64
 
 // Converts the provided CBOR map to a JSON string.
 func logCborMsgText(cborMap []byte) (string, error) {
@@ -53,11 +67,284 @@ func logCborMsgText(cborMap []byte) (string, error) {
 	return string(msg), nil
 }
 
+// Converts the message of the provided log entry to text.  CBOR messages are
+// converted to JSON; binary messages are hex encoded.  If the message cannot
+// be decoded, its hex encoding is returned along with an error describing
+// the problem.
+func logEntryMsgText(entry nmp.LogEntry) (string, error) {
+	switch entry.Type {
+	case nmp.LOG_ENTRY_TYPE_STRING:
+		return string(entry.Msg), nil
+
+	case nmp.LOG_ENTRY_TYPE_CBOR:
+		msgText, err := logCborMsgText(entry.Msg)
+		if err != nil {
+			return hex.EncodeToString(entry.Msg), util.FmtNewtError(
+				"Error decoding CBOR entry: %s; idx=%d",
+				err.Error(), entry.Index)
+		}
+		return msgText, nil
+
+	case nmp.LOG_ENTRY_TYPE_BINARY:
+		return hex.EncodeToString(entry.Msg), nil
+
+	default:
+		return hex.EncodeToString(entry.Msg), util.FmtNewtError(
+			"Error decoding entry: unknown entry type (%d); idx=%d",
+			int(entry.Type), entry.Index)
+	}
+}
+
+// Creates a name registry that holds the built-in names as well as the
+// provided module and level names.
+func logNameRegistry(ln *config.LogNames) *nmp.LogNameRegistry {
+	names := nmp.NewLogNameRegistry()
+
+	mods := make(map[int]string, len(ln.Modules))
+	for name, id := range ln.Modules {
+		mods[id] = name
+	}
+	names.AddModuleNames(mods)
+
+	lvls := make(map[int]string, len(ln.Levels))
+	for name, id := range ln.Levels {
+		lvls[id] = name
+	}
+	names.AddLevelNames(lvls)
+
+	return names
+}
+
+// Queries the device for the names of its log modules and levels.  Either
+// list may be missing if the device does not support the corresponding
+// command.
+func logQueryNames(s sesn.Sesn) (*config.LogNames, error) {
+	ln := &config.LogNames{}
+
+	mc := xact.NewLogModuleListCmd()
+	mc.SetTxOptions(nmutil.TxOptions())
+	mres, merr := mc.Run(s)
+	if merr == nil && mres.Status() != 0 {
+		merr = nmp.NewNmpRcError(mres.Status())
+	}
+	if merr == nil {
+		ln.Modules = mres.(*xact.LogModuleListResult).Rsp.Map
+	}
+
+	lc := xact.NewLogLevelListCmd()
+	lc.SetTxOptions(nmutil.TxOptions())
+	lres, lerr := lc.Run(s)
+	if lerr == nil && lres.Status() != 0 {
+		lerr = nmp.NewNmpRcError(lres.Status())
+	}
+	if lerr == nil {
+		ln.Levels = lres.(*xact.LogLevelListResult).Rsp.Map
+	}
+
+	if merr != nil && lerr != nil {
+		return nil, merr
+	}
+
+	return ln, nil
+}
+
+// Updates the cached log names for the current device.  Lists that are nil
+// in the provided names are left unchanged.
+func logCacheNames(ln *config.LogNames) error {
+	cp, err := getConnProfile()
+	if err != nil {
+		return err
+	}
+
+	lnm, err := config.NewLogNamesMgr()
+	if err != nil {
+		return err
+	}
+
+	key := connProfileKey(cp)
+	cached := lnm.GetLogNames(key)
+	if cached == nil {
+		cached = &config.LogNames{}
+	}
+	if ln.Modules != nil {
+		cached.Modules = ln.Modules
+	}
+	if ln.Levels != nil {
+		cached.Levels = ln.Levels
+	}
+
+	return lnm.SetLogNames(key, cached)
+}
+
+// Returns the names of the device's log modules and levels.  If a names file
+// was specified, the names are read from it.  Otherwise, the names cached for
+// the connection profile are used; if there are none, they are learned from
+// the device and cached.  Failure to learn the names is not an error; the
+// built-in names are used instead.  The failure is cached as well so that
+// devices without the list commands aren't queried on every invocation.
+func logReadNames(s sesn.Sesn) (*config.LogNames, error) {
+	if optLogNamesFile != "" {
+		return config.ReadLogNamesFile(optLogNamesFile)
+	}
+
+	cp, err := getConnProfile()
+	if err != nil {
+		return nil, err
+	}
+	key := connProfileKey(cp)
+
+	lnm, err := config.NewLogNamesMgr()
+	if err != nil {
+		return nil, err
+	}
+
+	if !optLogRefreshNames {
+		if ln := lnm.GetLogNames(key); ln != nil {
+			return ln, nil
+		}
+	}
+
+	ln, err := logQueryNames(s)
+	if err != nil {
+		log.Debugf("Failed to read log names from device: %s", err.Error())
+		ln = &config.LogNames{}
+	}
+
+	if err := lnm.SetLogNames(key, ln); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to cache log names: %s\n",
+			err.Error())
+	}
+
+	return ln, nil
+}
+
+// Loads the device's log module and level names (see logReadNames).  The
+// names are also used by the nmp package's name functions.
+func logLoadNames(s sesn.Sesn) (*nmp.LogNameRegistry, error) {
+	ln, err := logReadNames(s)
+	if err != nil {
+		return nil, err
+	}
+
+	names := logNameRegistry(ln)
+	nmp.SetLogNameRegistry(names)
+
+	return names, nil
+}
+
 type logShowCfg struct {
 	Name      string
 	Last      bool
 	Index     uint32
 	Timestamp int64
+	Format    string
+	Filter    *logFilter
+	Names     *nmp.LogNameRegistry
+}
+
+const (
+	LOG_FORMAT_TEXT = "text"
+	LOG_FORMAT_JSON = "json"
+	LOG_FORMAT_CSV  = "csv"
+)
+
+// Restricts the set of log entries that get displayed.
+type logFilter struct {
+	// If non-nil, only entries from these modules are displayed.
+	Modules map[int]bool
+
+	// Only entries at this level or higher are displayed.
+	MinLevel int
+
+	// Only entries with an index in this range (inclusive) are displayed.
+	MinIndex uint32
+	MaxIndex uint32
+}
+
+func newLogFilter() *logFilter {
+	return &logFilter{
+		MaxIndex: 0xffffffff,
+	}
+}
+
+func (f *logFilter) match(entry nmp.LogEntry) bool {
+	if f.Modules != nil && !f.Modules[int(entry.Module)] {
+		return false
+	}
+
+	return int(entry.Level) >= f.MinLevel &&
+		entry.Index >= f.MinIndex &&
+		entry.Index <= f.MaxIndex
+}
+
+// Returns a copy of the provided response containing only the entries that
+// match the filter.
+func (f *logFilter) apply(rsp *nmp.LogShowRsp) *nmp.LogShowRsp {
+	frsp := *rsp
+	frsp.Logs = make([]nmp.LogShowLog, len(rsp.Logs))
+
+	for i, log := range rsp.Logs {
+		flog := log
+		flog.Entries = nil
+		for _, entry := range log.Entries {
+			if f.match(entry) {
+				flog.Entries = append(flog.Entries, entry)
+			}
+		}
+		frsp.Logs[i] = flog
+	}
+
+	return &frsp
+}
+
+// Parses a module or level specifier.  The specifier is either a number or
+// a name known to the provided lookup function.
+func logParseId(s string, lookup func(string) (int, bool)) (int, error) {
+	if n, err := strconv.ParseUint(s, 0, 8); err == nil {
+		return int(n), nil
+	}
+
+	if id, ok := lookup(s); ok {
+		return id, nil
+	}
+
+	return 0, util.FmtNewtError("unknown name: %s", s)
+}
+
+func logShowParseFilter(cmd *cobra.Command,
+	names *nmp.LogNameRegistry) (*logFilter, error) {
+
+	f := newLogFilter()
+
+	if len(optLogShowModules) > 0 {
+		f.Modules = map[int]bool{}
+		for _, m := range optLogShowModules {
+			id, err := logParseId(m, names.ModuleFromString)
+			if err != nil {
+				return nil, util.FmtNewtError("invalid module: %s", m)
+			}
+			f.Modules[id] = true
+		}
+	}
+
+	if optLogShowLevel != "" {
+		id, err := logParseId(optLogShowLevel, names.LevelFromString)
+		if err != nil {
+			return nil, util.FmtNewtError("invalid level: %s",
+				optLogShowLevel)
+		}
+		f.MinLevel = id
+	}
+
+	f.MinIndex = optLogShowMinIndex
+	if cmd.Flags().Changed("max-index") {
+		f.MaxIndex = optLogShowMaxIndex
+	}
+	if f.MinIndex > f.MaxIndex {
+		return nil, util.NewNewtError("min-index exceeds max-index")
+	}
+
+	return f, nil
 }
 
 func logShowParseArgs(args []string) (*logShowCfg, error) {
@@ -99,7 +386,9 @@ func logShowParseArgs(args []string) (*logShowCfg, error) {
 	return cfg, nil
 }
 
-func printLogShowRsp(rsp *nmp.LogShowRsp, printHdr bool) {
+func printLogShowRsp(rsp *nmp.LogShowRsp, names *nmp.LogNameRegistry,
+	printHdr bool) {
+
 	if len(rsp.Logs) == 0 {
 		fmt.Printf("(no logs retrieved)\n")
 		return
@@ -117,32 +406,13 @@ func printLogShowRsp(rsp *nmp.LogShowRsp, printHdr bool) {
 
 		for _, entry := range log.Entries {
 			modText := fmt.Sprintf("%s (%d)",
-				nmp.LogModuleToString(int(entry.Module)), entry.Module)
+				names.ModuleToString(int(entry.Module)), entry.Module)
 			levText := fmt.Sprintf("%s (%d)",
-				nmp.LogLevelToString(int(entry.Level)), entry.Level)
-
-			var err error
-			msgText := ""
-			switch entry.Type {
-			case nmp.LOG_ENTRY_TYPE_STRING:
-				msgText = string(entry.Msg)
-			case nmp.LOG_ENTRY_TYPE_CBOR:
-				msgText, err = logCborMsgText(entry.Msg)
-				if err != nil {
-					fmt.Printf("Error decoding CBOR entry: %s; "+
-						"idx=%d",
-						err.Error(), entry.Index)
-					msgText = hex.EncodeToString(entry.Msg)
-				}
+				names.LevelToString(int(entry.Level)), entry.Level)
 
-			case nmp.LOG_ENTRY_TYPE_BINARY:
-				msgText = hex.EncodeToString(entry.Msg)
-
-			default:
-				fmt.Printf(
-					"Error decoding entry: unknown entry type (%d); idx=%d",
-					int(entry.Type), entry.Index)
-				msgText = hex.EncodeToString(entry.Msg)
+			msgText, err := logEntryMsgText(entry)
+			if err != nil {
+				fmt.Printf("%s", err.Error())
 			}
 
 			fmt.Printf("%10d %20dus | %16s %16s %6s %8s %s\n",
@@ -157,6 +427,163 @@ func printLogShowRsp(rsp *nmp.LogShowRsp, printHdr bool) {
 	}
 }
 
+// A single log entry in a form suitable for export.
+type logExportEntry struct {
+	Log        string      `json:"log"`
+	LogType    string      `json:"log_type"`
+	Index      uint32      `json:"index"`
+	Timestamp  int64       `json:"timestamp"`
+	Time       string      `json:"time,omitempty"`
+	Module     int         `json:"module"`
+	ModuleName string      `json:"module_name"`
+	Level      int         `json:"level"`
+	LevelName  string      `json:"level_name"`
+	Type       string      `json:"type"`
+	ImgHash    string      `json:"img_hash"`
+	Msg        interface{} `json:"msg"`
+
+	// The message as a single string.
+	msgText string
+}
+
+var logCsvHeader = []string{
+	"log", "log_type", "index", "timestamp", "time", "module",
+	"module_name", "level", "level_name", "type", "img_hash", "msg",
+}
+
+// Log timestamps are expressed in microseconds according to the device's
+// clock.  This function calculates the difference between the host's clock
+// and the device's clock so that timestamps can be converted to wall-clock
+// time.
+func logClockOffset(s sesn.Sesn) (time.Duration, error) {
+	c := xact.NewDateTimeReadCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+
+	before := time.Now()
+	res, err := c.Run(s)
+	if err != nil {
+		return 0, err
+	}
+	after := time.Now()
+
+	rsp := res.(*xact.DateTimeReadResult).Rsp
+	if rsp.Rc != 0 {
+		return 0, util.FmtNewtError("failed to read datetime: %s",
+			nmp.NmpRcToString(rsp.Rc))
+	}
+
+	t, err := xact.ParseDateTime(rsp.DateTime)
+	if err != nil {
+		return 0, util.ChildNewtError(err)
+	}
+
+	// Assume the device read its clock halfway through the transaction.
+	host := before.Add(after.Sub(before) / 2)
+	return host.Sub(t), nil
+}
+
+func logExportEntries(rsps []*nmp.LogShowRsp, names *nmp.LogNameRegistry,
+	offset *time.Duration) []logExportEntry {
+
+	var entries []logExportEntry
+	for _, rsp := range rsps {
+		for _, log := range rsp.Logs {
+			for _, entry := range log.Entries {
+				msgText, err := logEntryMsgText(entry)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+				}
+
+				e := logExportEntry{
+					Log:        log.Name,
+					LogType:    nmp.LogTypeToString(log.Type),
+					Index:      entry.Index,
+					Timestamp:  entry.Timestamp,
+					Module:     int(entry.Module),
+					ModuleName: names.ModuleToString(int(entry.Module)),
+					Level:      int(entry.Level),
+					LevelName:  names.LevelToString(int(entry.Level)),
+					Type:       entry.Type.String(),
+					ImgHash:    hex.EncodeToString(entry.ImgHash),
+					Msg:        msgText,
+					msgText:    msgText,
+				}
+
+				// Embed decoded CBOR messages as JSON objects rather than
+				// as strings.
+				if err == nil && entry.Type == nmp.LOG_ENTRY_TYPE_CBOR {
+					e.Msg = json.RawMessage(msgText)
+				}
+
+				if offset != nil {
+					t := time.Unix(0, entry.Timestamp*int64(time.Microsecond))
+					e.Time = t.Add(*offset).Format(time.RFC3339Nano)
+				}
+
+				entries = append(entries, e)
+			}
+		}
+	}
+
+	return entries
+}
+
+// Writes the provided log show responses to stdout in the specified export
+// format (json or csv).  Device timestamps are converted to wall-clock time
+// if the device's clock can be read.
+func logExport(s sesn.Sesn, rsps []*nmp.LogShowRsp,
+	names *nmp.LogNameRegistry, format string) error {
+
+	var offset *time.Duration
+	if off, err := logClockOffset(s); err != nil {
+		fmt.Fprintf(os.Stderr,
+			"Warning: unable to convert timestamps to wall-clock time: %s\n",
+			err.Error())
+	} else {
+		offset = &off
+	}
+
+	entries := logExportEntries(rsps, names, offset)
+
+	switch format {
+	case LOG_FORMAT_JSON:
+		if entries == nil {
+			entries = []logExportEntry{}
+		}
+		b, err := json.MarshalIndent(entries, "", "    ")
+		if err != nil {
+			return util.ChildNewtError(err)
+		}
+		fmt.Printf("%s\n", b)
+
+	case LOG_FORMAT_CSV:
+		w := csv.NewWriter(os.Stdout)
+		w.Write(logCsvHeader)
+		for _, e := range entries {
+			w.Write([]string{
+				e.Log,
+				e.LogType,
+				strconv.FormatUint(uint64(e.Index), 10),
+				strconv.FormatInt(e.Timestamp, 10),
+				e.Time,
+				strconv.Itoa(e.Module),
+				e.ModuleName,
+				strconv.Itoa(e.Level),
+				e.LevelName,
+				e.Type,
+				e.ImgHash,
+				e.msgText,
+			})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return util.ChildNewtError(err)
+		}
+	}
+
+	return nil
+}
+
 func logShowFullCmd(s sesn.Sesn, cfg *logShowCfg) error {
 	if cfg.Name == "" {
 		return util.FmtNewtError("must specify a single log to read when `-a` is used")
@@ -169,16 +596,32 @@ func logShowFullCmd(s sesn.Sesn, cfg *logShowCfg) error {
 	c.Index = cfg.Index
 
 	first := true
+	var rsps []*nmp.LogShowRsp
 	c.ProgressCb = func(_ *xact.LogShowFullCmd, rsp *nmp.LogShowRsp) {
-		printLogShowRsp(rsp, first)
+		rsp = cfg.Filter.apply(rsp)
+		if cfg.Format == LOG_FORMAT_TEXT {
+			printLogShowRsp(rsp, cfg.Names, first)
+		} else {
+			rsps = append(rsps, rsp)
+		}
 		first = false
 	}
 
-	_, err := c.Run(s)
+	res, err := c.Run(s)
 	if err != nil {
 		return err
 	}
 
+	// A status of 1 indicates that more entries remain; not an error.
+	if res.Status() != 0 && res.Status() != 1 {
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(res.Status()))
+		return nil
+	}
+
+	if cfg.Format != LOG_FORMAT_TEXT {
+		return logExport(s, rsps, cfg.Names, cfg.Format)
+	}
+
 	return nil
 }
 
@@ -196,12 +639,28 @@ func logShowPartialCmd(s sesn.Sesn, cfg *logShowCfg) error {
 	}
 
 	sres := res.(*xact.LogShowResult)
+	if sres.Status() != 0 && sres.Status() != 1 {
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(sres.Status()))
+		return nil
+	}
+
+	rsp := cfg.Filter.apply(sres.Rsp)
+
+	if cfg.Format != LOG_FORMAT_TEXT {
+		if sres.Status() == 1 {
+			fmt.Fprintf(os.Stderr, "Warning: more entries remain; "+
+				"use --all to read until the end of the log\n")
+		}
+		return logExport(s, []*nmp.LogShowRsp{rsp}, cfg.Names,
+			cfg.Format)
+	}
+
 	fmt.Printf("Status: %d\n", sres.Status())
 	fmt.Printf("Next index: %d\n", sres.Rsp.NextIndex)
-	if len(sres.Rsp.Logs) == 0 {
+	if len(rsp.Logs) == 0 {
 		fmt.Printf("(no logs retrieved)\n")
 	} else {
-		printLogShowRsp(sres.Rsp, true)
+		printLogShowRsp(rsp, cfg.Names, true)
 	}
 
 	return nil
@@ -213,11 +672,35 @@ func logShowCmd(cmd *cobra.Command, args []string) {
 		nmUsage(cmd, err)
 	}
 
+	switch optLogShowFormat {
+	case LOG_FORMAT_TEXT, LOG_FORMAT_JSON, LOG_FORMAT_CSV:
+		cfg.Format = optLogShowFormat
+	default:
+		nmUsage(cmd, util.FmtNewtError("invalid format: %s",
+			optLogShowFormat))
+	}
+
 	s, err := GetSesn()
 	if err != nil {
 		nmUsage(nil, err)
 	}
 
+	// Module and level filters may refer to names learned from the device.
+	cfg.Names, err = logLoadNames(s)
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	cfg.Filter, err = logShowParseFilter(cmd, cfg.Names)
+	if err != nil {
+		nmUsage(cmd, err)
+	}
+
+	// Don't ask the device for entries that will be filtered out anyway.
+	if cfg.Timestamp != -1 && cfg.Index < cfg.Filter.MinIndex {
+		cfg.Index = cfg.Filter.MinIndex
+	}
+
 	if optLogShowFull {
 		err = logShowFullCmd(s, cfg)
 	} else {
@@ -228,6 +711,55 @@ func logShowCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+func logTailCmd(cmd *cobra.Command, args []string) {
+	if len(args) > 1 {
+		nmUsage(cmd, nil)
+	}
+	if optLogTailInterval <= 0 {
+		nmUsage(cmd, util.NewNewtError("interval must be positive"))
+	}
+
+	s, err := GetSesn()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	names, err := logLoadNames(s)
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	c := xact.NewLogTailCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+	if len(args) > 0 {
+		c.Name = args[0]
+	}
+	if cmd.Flags().Changed("index") {
+		c.Index = optLogTailIndex
+	} else {
+		c.FromEnd = true
+	}
+	c.Interval = time.Duration(optLogTailInterval * float64(time.Second))
+	c.Stop = pollStopChan()
+	defer SetOnInterrupt(nil)
+
+	first := true
+	c.ProgressCb = func(_ *xact.LogTailCmd, rsp *nmp.LogShowRsp) {
+		printLogShowRsp(rsp, names, first)
+		first = false
+	}
+	c.ErrorCb = func(_ *xact.LogTailCmd, err error) { pollWarn(err) }
+
+	res, err := c.Run(s)
+	if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+
+	if res.Status() != 0 {
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(res.Status()))
+	}
+}
+
 func logListCmd(cmd *cobra.Command, args []string) {
 	s, err := GetSesn()
 	if err != nil {
@@ -244,7 +776,7 @@ func logListCmd(cmd *cobra.Command, args []string) {
 
 	sres := res.(*xact.LogListResult)
 	if sres.Rsp.Rc != 0 {
-		fmt.Printf("error: %d\n", sres.Rsp.Rc)
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(sres.Rsp.Rc))
 		return
 	}
 
@@ -272,10 +804,17 @@ func logModuleListCmd(cmd *cobra.Command, args []string) {
 
 	sres := res.(*xact.LogModuleListResult)
 	if sres.Rsp.Rc != 0 {
-		fmt.Printf("error: %d\n", sres.Rsp.Rc)
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(sres.Rsp.Rc))
 		return
 	}
 
+	if err := logCacheNames(&config.LogNames{
+		Modules: sres.Rsp.Map,
+	}); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to cache log names: %s\n",
+			err.Error())
+	}
+
 	names := make([]string, 0, len(sres.Rsp.Map))
 	for k, _ := range sres.Rsp.Map {
 		names = append(names, k)
@@ -304,10 +843,17 @@ func logLevelListCmd(cmd *cobra.Command, args []string) {
 
 	sres := res.(*xact.LogLevelListResult)
 	if sres.Rsp.Rc != 0 {
-		fmt.Printf("error: %d\n", sres.Rsp.Rc)
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(sres.Rsp.Rc))
 		return
 	}
 
+	if err := logCacheNames(&config.LogNames{
+		Levels: sres.Rsp.Map,
+	}); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to cache log names: %s\n",
+			err.Error())
+	}
+
 	vals := make([]int, 0, len(sres.Rsp.Map))
 	revmap := make(map[int]string, len(sres.Rsp.Map))
 	for name, val := range sres.Rsp.Map {
@@ -338,7 +884,7 @@ func logClearCmd(cmd *cobra.Command, args []string) {
 
 	sres := res.(*xact.LogClearResult)
 	if sres.Rsp.Rc != 0 {
-		fmt.Printf("error: %d\n", sres.Rsp.Rc)
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(sres.Rsp.Rc))
 		return
 	}
 
@@ -354,17 +900,26 @@ func logCmd() *cobra.Command {
 		},
 	}
 
+	logCmd.PersistentFlags().StringVar(&optLogNamesFile, "names-file", "",
+		"JSON file mapping log module and level names to IDs")
+	logCmd.PersistentFlags().BoolVar(&optLogRefreshNames, "refresh-names",
+		false, "re-read log module and level names from the device")
+
 	logShowHelpText := "Show logs on a device.  Optional log-name, min-index, and min-timestamp\nparameters can be specified to filter the logs to display.\n\n"
 	logShowHelpText += "- log-name specifies the log to display.  If log-name is not specified, all\nlogs are displayed.\n\n"
 	logShowHelpText += "- min-index specifies to only display the log entries with an index value equal to or higher than min-index.  "
 	logShowHelpText += "If \"last\"  is specified for min-index, the last\nlog entry is displayed.\n\n"
 	logShowHelpText += "- min-timestamp specifies to only display the log entries with a timestamp\nequal to or later than min-timestamp. Log entries with a timestamp equal to\nmin-timestamp are only displayed if the entry index is equal to or higher than min-index.\n"
+	logShowHelpText += "\nThe --module, --level, --min-index, and --max-index flags further restrict\nthe entries that are displayed.\n\n"
+	logShowHelpText += "With --format json or --format csv, entries are written in a form suitable\nfor other tools.  Device timestamps are converted to wall-clock time using\nthe device's current datetime, and CBOR entries are decoded.\n"
 
 	logShowEx := nmutil.ToolInfo.ExeName + " log show -c myserial\n"
 	logShowEx += nmutil.ToolInfo.ExeName + " log show reboot_log -c myserial\n"
 	logShowEx += nmutil.ToolInfo.ExeName + " log show reboot_log last -c myserial\n"
 	logShowEx += nmutil.ToolInfo.ExeName + " log show reboot_log 5 -c myserial\n"
 	logShowEx += nmutil.ToolInfo.ExeName + " log show reboot_log 3 1122222 -c myserial\n"
+	logShowEx += nmutil.ToolInfo.ExeName + " log show log --level warn --module os,nffs -c myserial\n"
+	logShowEx += nmutil.ToolInfo.ExeName + " log show log -a --format csv --min-index 100 --max-index 199 -c myserial\n"
 
 	showCmd := &cobra.Command{
 		Use:     "show [log-name [min-index [min-timestamp]]] -c <conn_profile>",
@@ -374,8 +929,44 @@ func logCmd() *cobra.Command {
 		Run:     logShowCmd,
 	}
 	showCmd.PersistentFlags().BoolVarP(&optLogShowFull, "all", "a", false, "read until end of log")
+	showCmd.Flags().StringVar(&optLogShowFormat, "format", LOG_FORMAT_TEXT,
+		"output format (text, json, or csv)")
+	showCmd.Flags().StringSliceVar(&optLogShowModules, "module", nil,
+		"only display entries from these modules (names or numbers)")
+	showCmd.Flags().StringVar(&optLogShowLevel, "level", "",
+		"only display entries at this level or higher (name or number)")
+	showCmd.Flags().Uint32Var(&optLogShowMinIndex, "min-index", 0,
+		"only display entries with an index equal to or higher than this")
+	showCmd.Flags().Uint32Var(&optLogShowMaxIndex, "max-index", 0,
+		"only display entries with an index equal to or lower than this")
 	logCmd.AddCommand(showCmd)
 
+	logTailHelpText := "Continuously display new entries as they are added to " +
+		"a log on a device.\nIf log-name is not specified, all logs are " +
+		"followed.\n\n"
+	logTailHelpText += "Only entries added after the command starts are " +
+		"displayed unless --index is\nspecified.  Timeouts and " +
+		"disconnects are reported and polling continues.\nPress Ctrl-C " +
+		"to stop.\n"
+
+	logTailEx := nmutil.ToolInfo.ExeName + " log tail -c myserial\n"
+	logTailEx += nmutil.ToolInfo.ExeName + " log tail log -c myserial\n"
+	logTailEx += nmutil.ToolInfo.ExeName +
+		" log tail log --index 0 --interval 0.5 -c myserial\n"
+
+	tailCmd := &cobra.Command{
+		Use:     "tail [log-name] -c <conn_profile>",
+		Example: logTailEx,
+		Long:    logTailHelpText,
+		Short:   "Follow new log entries on a device",
+		Run:     logTailCmd,
+	}
+	tailCmd.Flags().Uint32Var(&optLogTailIndex, "index", 0,
+		"index of the first entry to display (default: the end of the log)")
+	tailCmd.Flags().Float64Var(&optLogTailInterval, "interval", 1.0,
+		"polling interval in seconds (partial seconds allowed)")
+	logCmd.AddCommand(tailCmd)
+
 	clearCmd := &cobra.Command{
 		Use:     "clear -c <conn_profile>",
 		Short:   "Clear the logs on a device",
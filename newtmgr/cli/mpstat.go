@@ -20,17 +20,34 @@
 package cli
 
 import (
+	"encoding/csv"
 	"fmt"
+	"os"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"mynewt.apache.org/newt/util"
 	"mynewt.apache.org/newtmgr/newtmgr/nmutil"
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
 	"mynewt.apache.org/newtmgr/nmxact/xact"
 )
 
+var (
+	mempoolTrackDuration time.Duration
+	mempoolTrackInterval time.Duration
+	mempoolTrackSeries   string
+)
+
 func mempoolStatRunCmd(cmd *cobra.Command, args []string) {
+	if mempoolTrackDuration != 0 {
+		mempoolTrackRunCmd(cmd, args)
+		return
+	}
+
 	s, err := GetSesn()
 	if err != nil {
 		nmUsage(nil, err)
@@ -46,7 +63,7 @@ func mempoolStatRunCmd(cmd *cobra.Command, args []string) {
 
 	sres := res.(*xact.MempoolStatResult)
 	if sres.Rsp.Rc != 0 {
-		fmt.Printf("Error: %d\n", sres.Rsp.Rc)
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(sres.Rsp.Rc))
 		return
 	}
 
@@ -68,12 +85,193 @@ func mempoolStatRunCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+// Writes the raw samples collected by mpstat --track to a CSV file.
+type mempoolSeriesWriter struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+func newMempoolSeriesWriter(filename string) (*mempoolSeriesWriter, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	w := &mempoolSeriesWriter{
+		file:   f,
+		writer: csv.NewWriter(f),
+	}
+	w.writer.Write([]string{
+		"time", "name", "blksz", "cnt", "free", "min",
+	})
+
+	return w, nil
+}
+
+func (w *mempoolSeriesWriter) write(sample xact.MempoolSample) error {
+	ts := sample.Time.UTC().Format(time.RFC3339Nano)
+
+	names := make([]string, 0, len(sample.Mpools))
+	for name, _ := range sample.Mpools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		mp := sample.Mpools[name]
+		w.writer.Write([]string{
+			ts,
+			name,
+			strconv.Itoa(mp["blksiz"]),
+			strconv.Itoa(mp["nblks"]),
+			strconv.Itoa(mp["nfree"]),
+			strconv.Itoa(mp["min"]),
+		})
+	}
+
+	// Flush after every sample so that the series survives an aborted run.
+	w.writer.Flush()
+	if err := w.writer.Error(); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+func (w *mempoolSeriesWriter) close() {
+	w.writer.Flush()
+	w.file.Close()
+}
+
+func printMempoolTrends(trends []xact.MempoolTrend) {
+	fmt.Printf("%32s %5s %4s %9s %9s %8s %8s\n",
+		"name", "blksz", "cnt", "free", "min", "free/h", "min/h")
+
+	var declining []string
+	for _, t := range trends {
+		mark := ""
+		if t.Declining {
+			mark = " declining"
+			declining = append(declining, t.Name)
+		}
+
+		fmt.Printf("%32s %5d %4d %9s %9s %8.1f %8.1f%s\n",
+			t.Name,
+			t.BlockSize,
+			t.NumBlocks,
+			fmt.Sprintf("%d->%d", t.FirstFree, t.LastFree),
+			fmt.Sprintf("%d->%d", t.FirstMin, t.LastMin),
+			t.FreeSlope*3600,
+			t.MinSlope*3600,
+			mark)
+	}
+
+	fmt.Println()
+	if len(declining) == 0 {
+		fmt.Printf("No declining mempools\n")
+	} else {
+		fmt.Printf("Declining mempools: %s\n", strings.Join(declining, ", "))
+	}
+}
+
+func mempoolTrackRunCmd(cmd *cobra.Command, args []string) {
+	if mempoolTrackDuration < 0 {
+		nmUsage(cmd, util.NewNewtError("track duration must be positive"))
+	}
+	if mempoolTrackInterval <= 0 {
+		nmUsage(cmd, util.NewNewtError("interval must be positive"))
+	}
+
+	filename := mempoolTrackSeries
+	if filename == "" {
+		filename = "mpstat-" + time.Now().Format("20060102-150405") + ".csv"
+	}
+
+	s, err := GetSesn()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	w, err := newMempoolSeriesWriter(filename)
+	if err != nil {
+		nmUsage(nil, err)
+	}
+	defer w.close()
+
+	total := int(mempoolTrackDuration/mempoolTrackInterval) + 1
+	fmt.Printf("Tracking mempools for %s (%d samples); writing samples "+
+		"to %s\n", mempoolTrackDuration, total, filename)
+
+	// Ctrl-C stops sampling early; the samples collected so far are still
+	// reported.
+	c := xact.NewMempoolTrackCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+	c.Duration = mempoolTrackDuration
+	c.Interval = mempoolTrackInterval
+	c.Stop = pollStopChan()
+	defer SetOnInterrupt(nil)
+
+	n := 0
+	c.ProgressCb = func(_ *xact.MempoolTrackCmd, sample xact.MempoolSample) {
+		n++
+		fmt.Printf("%s sample %d/%d\n",
+			sample.Time.Format("15:04:05"), n, total)
+		if err := w.write(sample); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", err.Error())
+		}
+	}
+	c.ErrorCb = func(_ *xact.MempoolTrackCmd, err error) { pollWarn(err) }
+
+	res, err := c.Run(s)
+	if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+
+	tres := res.(*xact.MempoolTrackResult)
+	if tres.Rc != 0 {
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(tres.Rc))
+		if len(tres.Samples) == 0 {
+			return
+		}
+	}
+
+	if len(tres.Samples) < 2 {
+		fmt.Printf("Not enough samples to determine a trend\n")
+		return
+	}
+
+	fmt.Println()
+	printMempoolTrends(tres.Trends())
+}
+
 func mempoolStatCmd() *cobra.Command {
+	mempoolStatHelpText := "Read mempool statistics from a device.\n\n" +
+		"With --track, samples the statistics every --interval for the " +
+		"specified\nduration, writes the raw samples to a CSV file, and " +
+		"fits a linear trend to the\nfree and minimum free block counts " +
+		"of each pool.  Pools whose free and\nminimum free block counts " +
+		"keep declining are reported as possible leaks.\nPress Ctrl-C to " +
+		"stop early and report on the samples collected so far."
+
+	mempoolStatEx := "  " + nmutil.ToolInfo.ExeName + " -c olimex mpstat\n"
+	mempoolStatEx += "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex mpstat --track 8h --interval 1m --series soak.csv\n"
+
 	mempoolStatCmd := &cobra.Command{
-		Use:   "mpstat -c <conn_profile>",
-		Short: "Read mempool statistics from a device",
-		Run:   mempoolStatRunCmd,
+		Use:     "mpstat -c <conn_profile>",
+		Short:   "Read mempool statistics from a device",
+		Long:    mempoolStatHelpText,
+		Example: mempoolStatEx,
+		Run:     mempoolStatRunCmd,
 	}
 
+	mempoolStatCmd.Flags().DurationVar(&mempoolTrackDuration, "track", 0,
+		"Sample the statistics for this long and report declining pools")
+	mempoolStatCmd.Flags().DurationVar(&mempoolTrackInterval, "interval",
+		xact.MEMPOOL_TRACK_DFLT_INTERVAL, "Time between samples when tracking")
+	mempoolStatCmd.Flags().StringVar(&mempoolTrackSeries, "series", "",
+		"File to write the tracked samples to (default "+
+			"mpstat-<date>-<time>.csv)")
+
 	return mempoolStatCmd
 }
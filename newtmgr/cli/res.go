@@ -173,7 +173,7 @@ func resResponseStr(path string, cbor []byte) string {
 		}
 		j, err := json.MarshalIndent(cleanUpMapValue(m), "", "    ")
 		if err != nil {
-			s += fmt.Sprintf("\nerror: ", err)
+			s += fmt.Sprintf("\nerror: %v", err)
 		}
 		s += fmt.Sprintf("\n%v", string(j))
 	} else {
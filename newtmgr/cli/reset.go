@@ -20,7 +20,9 @@
 package cli
 
 import (
+	"encoding/hex"
 	"fmt"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -29,7 +31,57 @@ import (
 	"mynewt.apache.org/newtmgr/nmxact/xact"
 )
 
+var (
+	resetWait    bool
+	resetMinWait float64
+	resetMaxWait float64
+)
+
+func resetWaitRunCmd(cmd *cobra.Command, args []string) {
+	if resetMinWait < 0 || resetMaxWait <= 0 {
+		nmUsage(cmd, util.NewNewtError("wait times must be positive"))
+	}
+
+	s, err := GetSesn()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	c := xact.NewResetWaitCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+	c.MinWait = time.Duration(resetMinWait * float64(time.Second))
+	c.MaxWait = time.Duration(resetMaxWait * float64(time.Second))
+	c.StageCb = func(_ *xact.ResetWaitCmd, stage xact.ResetWaitStage) {
+		switch stage {
+		case xact.RESET_WAIT_STAGE_RESET:
+			fmt.Printf("Resetting device\n")
+		case xact.RESET_WAIT_STAGE_DISCONNECT:
+			fmt.Printf("Device disconnected\n")
+		case xact.RESET_WAIT_STAGE_RECONNECT:
+			fmt.Printf("Reconnected\n")
+		}
+	}
+
+	res, err := c.Run(s)
+	if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+
+	rres := res.(*xact.ResetWaitResult)
+	fmt.Printf("Device is back after %.1fs\n", rres.BootTime.Seconds())
+	if rres.Hash != nil {
+		fmt.Printf("Running image: %s\n", hex.EncodeToString(rres.Hash))
+	} else {
+		fmt.Printf("Running image: unknown\n")
+	}
+}
+
 func resetRunCmd(cmd *cobra.Command, args []string) {
+	if resetWait {
+		resetWaitRunCmd(cmd, args)
+		return
+	}
+
 	s, err := GetSesn()
 	if err != nil {
 		nmUsage(nil, err)
@@ -46,11 +98,33 @@ func resetRunCmd(cmd *cobra.Command, args []string) {
 }
 
 func resetCmd() *cobra.Command {
+	resetHelpText := "Perform a soft reset of a device.\n\n" +
+		"With --wait, waits for the device to reboot: newtmgr reconnects " +
+		"if the\nconnection drops, sends echo requests until the device " +
+		"answers, and then\nreports how long the reboot took and which " +
+		"image the device is running."
+
+	resetEx := "  " + nmutil.ToolInfo.ExeName + " -c olimex reset\n"
+	resetEx += "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex reset --wait --max-wait 60\n"
+
 	resetCmd := &cobra.Command{
-		Use:   "reset -c <conn_profile>",
-		Short: "Perform a soft reset of a device",
-		Run:   resetRunCmd,
+		Use:     "reset -c <conn_profile>",
+		Short:   "Perform a soft reset of a device",
+		Long:    resetHelpText,
+		Example: resetEx,
+		Run:     resetRunCmd,
 	}
 
+	resetCmd.Flags().BoolVar(&resetWait, "wait", false,
+		"Wait for the device to come back after the reset")
+	resetCmd.Flags().Float64Var(&resetMinWait, "min-wait",
+		xact.RESET_WAIT_DFLT_MIN_WAIT.Seconds(),
+		"Minimum time, in seconds, to wait after the reset before "+
+			"contacting the device")
+	resetCmd.Flags().Float64Var(&resetMaxWait, "max-wait",
+		xact.RESET_WAIT_DFLT_MAX_WAIT.Seconds(),
+		"Maximum time, in seconds, to wait for the device to come back")
+
 	return resetCmd
 }
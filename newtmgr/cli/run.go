@@ -27,6 +27,7 @@ import (
 
 	"mynewt.apache.org/newt/util"
 	"mynewt.apache.org/newtmgr/newtmgr/nmutil"
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
 	"mynewt.apache.org/newtmgr/nmxact/xact"
 )
 
@@ -55,7 +56,7 @@ func runTestCmd(cmd *cobra.Command, args []string) {
 
 	sres := res.(*xact.RunTestResult)
 	if sres.Rsp.Rc != 0 {
-		fmt.Printf("Error: %d\n", sres.Rsp.Rc)
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(sres.Rsp.Rc))
 		return
 	}
 
@@ -78,7 +79,7 @@ func runListCmd(cmd *cobra.Command, args []string) {
 
 	sres := res.(*xact.RunListResult)
 	if sres.Rsp.Rc != 0 {
-		fmt.Printf("Error: %d\n", sres.Rsp.Rc)
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(sres.Rsp.Rc))
 		return
 	}
 
@@ -21,13 +21,33 @@ package cli
 
 import (
 	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
 
+	"github.com/abiosoft/ishell/v2"
+	"github.com/abiosoft/readline"
+	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newtmgr/newtmgr/config"
 	"mynewt.apache.org/newtmgr/newtmgr/nmutil"
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
 	"mynewt.apache.org/newtmgr/nmxact/xact"
 )
 
+// Lines starting with this prefix are run by the host's shell rather than
+// sent to the device.
+const SHELL_HOST_ESCAPE = "!"
+
+// Matches the command names in the output of the device's help command.
+var shellHelpCmdRe = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
 func shellExecCmd(cmd *cobra.Command, args []string) {
 	s, err := GetSesn()
 	if err != nil {
@@ -49,7 +69,13 @@ func shellExecCmd(cmd *cobra.Command, args []string) {
 	}
 
 	sres := res.(*xact.ShellExecResult)
-	fmt.Printf("status=%d\n", sres.Rsp.Rc)
+	ret, rc := shellRet(sres.Rsp)
+	if rc != 0 {
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(rc))
+		return
+	}
+
+	fmt.Printf("status=%d\n", ret)
 	if len(sres.Rsp.O) > 0 {
 		fmt.Printf("%s", sres.Rsp.O)
 		if sres.Rsp.O[len(sres.Rsp.O)-1] != '\n' {
@@ -58,13 +84,327 @@ func shellExecCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+// Returns a shell command's return value and the management error that kept
+// it from running, if any.  Devices that don't send ret report the return
+// value in rc; only devices that send ret use rc for management errors.
+func shellRet(rsp *nmp.ShellExecRsp) (int, int) {
+	if rsp.Ret == nil {
+		return rsp.Rc, 0
+	}
+
+	return *rsp.Ret, rsp.Rc
+}
+
+// Extracts command names from the output of the device's help command.  The
+// first word of each line is taken to be a command name; headings (lines
+// ending in a colon) are skipped.
+func shellParseHelp(out string) []string {
+	var names []string
+	seen := map[string]bool{}
+
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasSuffix(line, ":") {
+			continue
+		}
+
+		name := strings.Fields(line)[0]
+		if shellHelpCmdRe.MatchString(name) && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// The state of an interactive shell session.
+type shellRepl struct {
+	sesn    sesn.Sesn
+	shell   *ishell.Shell
+	aliases *config.ShellAliasMgr
+
+	// Commands reported by the device's help command; used for completion.
+	remoteCmds []string
+}
+
+// Runs a command on the device and prints its output followed by its return
+// value.  Ctrl-C aborts the command without leaving the shell.
+func (r *shellRepl) execRemote(argv []string) error {
+	if !r.sesn.IsOpen() {
+		if err := r.sesn.Open(); err != nil {
+			return util.ChildNewtError(err)
+		}
+	}
+
+	c := xact.NewShellExecCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+	c.Argv = argv
+
+	SetOnInterrupt(func() { c.Abort() })
+	defer SetOnInterrupt(nil)
+
+	res, err := c.Run(r.sesn)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	rsp := res.(*xact.ShellExecResult).Rsp
+	if len(rsp.O) > 0 {
+		fmt.Printf("%s", rsp.O)
+		if rsp.O[len(rsp.O)-1] != '\n' {
+			fmt.Printf("\n")
+		}
+	}
+
+	ret, rc := shellRet(rsp)
+	if rc != 0 {
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(rc))
+	} else {
+		fmt.Printf("ret=%d\n", ret)
+	}
+
+	return nil
+}
+
+// Runs a command line with the host's shell.
+func (r *shellRepl) execHost(line string) error {
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		c = exec.Command("cmd", "/C", line)
+	} else {
+		c = exec.Command("sh", "-c", line)
+	}
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+
+	// The child receives Ctrl-C directly; don't let it terminate newtmgr.
+	SetOnInterrupt(func() {})
+	defer SetOnInterrupt(nil)
+
+	if err := c.Run(); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// Handles a line that is not a client-side command: expands an alias, if
+// any, and runs the result on the host or the device.
+func (r *shellRepl) handleLine(c *ishell.Context) {
+	if len(c.RawArgs) == 0 {
+		return
+	}
+
+	raw := strings.Join(c.RawArgs, " ")
+	argv := c.Args
+
+	// Aliases are expanded once; an alias that refers to another alias
+	// sends the second alias's name to the device.
+	if exp := r.aliases.GetShellAlias(argv[0]); exp != "" {
+		raw = strings.TrimSpace(exp + " " + strings.Join(c.RawArgs[1:], " "))
+		argv = append(strings.Fields(exp), argv[1:]...)
+	}
+
+	var err error
+	if strings.HasPrefix(raw, SHELL_HOST_ESCAPE) {
+		err = r.execHost(strings.TrimPrefix(raw, SHELL_HOST_ESCAPE))
+	} else {
+		err = r.execRemote(argv)
+	}
+	if err != nil {
+		c.Err(err)
+	}
+}
+
+func (r *shellRepl) aliasCmd(c *ishell.Context) {
+	switch len(c.Args) {
+	case 0:
+		for _, name := range r.aliases.GetShellAliasNames() {
+			c.Printf("%s = %s\n", name, r.aliases.GetShellAlias(name))
+		}
+
+	case 1:
+		exp := r.aliases.GetShellAlias(c.Args[0])
+		if exp == "" {
+			c.Err(util.FmtNewtError("alias \"%s\" doesn't exist",
+				c.Args[0]))
+			return
+		}
+		c.Printf("%s = %s\n", c.Args[0], exp)
+
+	default:
+		exp := strings.Join(c.RawArgs[2:], " ")
+		if err := r.aliases.SetShellAlias(c.Args[0], exp); err != nil {
+			c.Err(err)
+		}
+	}
+}
+
+func (r *shellRepl) unaliasCmd(c *ishell.Context) {
+	if len(c.Args) != 1 {
+		c.Err(util.NewNewtError("usage: .unalias <name>"))
+		return
+	}
+
+	if err := r.aliases.DeleteShellAlias(c.Args[0]); err != nil {
+		c.Err(err)
+	}
+}
+
+func (r *shellRepl) helpCmd(c *ishell.Context) {
+	c.Print(strings.TrimRight(c.HelpText(), "\n") + "\n")
+	c.Printf("  %-14srun a command line on the host, e.g., !ls\n\n",
+		SHELL_HOST_ESCAPE+"<cmd>")
+	c.Println("All other lines are sent to the device.  Type help for " +
+		"the device's commands.")
+}
+
+// Returns the names to offer when completing the first word of a line.
+func (r *shellRepl) completions() []string {
+	var names []string
+	for _, cmd := range r.shell.Cmds() {
+		names = append(names, cmd.Name)
+	}
+	names = append(names, r.aliases.GetShellAliasNames()...)
+	names = append(names, r.remoteCmds...)
+
+	return names
+}
+
+// Do implements readline.AutoCompleter.  Only the first word of a line is
+// completed.
+func (r *shellRepl) Do(line []rune, pos int) ([][]rune, int) {
+	prefix := string(line[:pos])
+	if strings.ContainsAny(prefix, " \t") ||
+		strings.HasPrefix(prefix, SHELL_HOST_ESCAPE) {
+
+		return nil, 0
+	}
+
+	seen := map[string]bool{}
+	var suggestions [][]rune
+	for _, name := range r.completions() {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			suggestions = append(suggestions,
+				[]rune(strings.TrimPrefix(name, prefix)+" "))
+		}
+	}
+
+	return suggestions, len([]rune(prefix))
+}
+
+// Reads the list of commands from the device for use in completion.  Devices
+// without a help command simply get no remote completion.
+func (r *shellRepl) loadRemoteCmds() {
+	c := xact.NewShellExecCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+	c.Argv = []string{"help"}
+
+	res, err := c.Run(r.sesn)
+	if err != nil {
+		return
+	}
+
+	rsp := res.(*xact.ShellExecResult).Rsp
+	if ret, rc := shellRet(rsp); ret != 0 || rc != 0 {
+		return
+	}
+
+	r.remoteCmds = shellParseHelp(rsp.O)
+}
+
+func shellReplRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) > 0 {
+		nmUsage(cmd, util.FmtNewtError("unknown command: %s", args[0]))
+	}
+
+	cp, err := getConnProfile()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	aliases, err := config.NewShellAliasMgr()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	s, err := GetSesn()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	home, err := homedir.Dir()
+	if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+
+	r := &shellRepl{
+		sesn:    s,
+		aliases: aliases,
+	}
+	r.loadRemoteCmds()
+
+	// The readline instance must be fully configured up front; changing the
+	// history path afterwards creates a second instance that competes with
+	// the first for stdin.
+	shell := ishell.NewWithConfig(&readline.Config{
+		Prompt:      cp.Name + "> ",
+		HistoryFile: filepath.Join(home, nmutil.ToolInfo.ShellHistoryFilename),
+	})
+	shell.CustomCompleter(r)
+	r.shell = shell
+
+	// Let "help" and "clear" through to the device.
+	shell.DeleteCmd("help")
+	shell.DeleteCmd("clear")
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: ".alias",
+		Help: "list aliases, or define one: .alias <name> <command...>",
+		Func: r.aliasCmd,
+	})
+	shell.AddCmd(&ishell.Cmd{
+		Name: ".unalias",
+		Help: "delete an alias: .unalias <name>",
+		Func: r.unaliasCmd,
+	})
+	shell.AddCmd(&ishell.Cmd{
+		Name: ".help",
+		Help: "display help for the client-side commands",
+		Func: r.helpCmd,
+	})
+	shell.NotFound(r.handleLine)
+	shell.EOF(func(c *ishell.Context) { c.Stop() })
+
+	shell.Printf("Connected to %s; type .help for help, exit or Ctrl-D "+
+		"to quit.\n", cp.Name)
+
+	shell.Run()
+	shell.Close()
+}
+
 func shellCmd() *cobra.Command {
+	shellHelpText := "Execute shell commands remotely.\n\n" +
+		"Without a subcommand, opens an interactive shell on the device.  " +
+		"Each line is\nsent to the device and its output and return value " +
+		"are displayed.  Lines\nstarting with " + SHELL_HOST_ESCAPE +
+		" are run on the host instead.  Client-side commands start\nwith " +
+		"a period; type .help to list them.  Command history is saved\nin " +
+		"~/" + nmutil.ToolInfo.ShellHistoryFilename + "."
+
+	shellEx := "  " + nmutil.ToolInfo.ExeName + " -c olimex shell\n"
+	shellEx += "  " + nmutil.ToolInfo.ExeName + " -c olimex shell exec help\n"
+
 	shellCmd := &cobra.Command{
-		Use:   "shell",
-		Short: "Execute shell commands remotely",
-		Run: func(cmd *cobra.Command, args []string) {
-			cmd.HelpFunc()(cmd, args)
-		},
+		Use:     "shell -c <conn_profile>",
+		Short:   "Execute shell commands remotely",
+		Long:    shellHelpText,
+		Example: shellEx,
+		Run:     shellReplRunCmd,
 	}
 
 	execCmd := &cobra.Command{
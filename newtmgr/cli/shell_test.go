@@ -0,0 +1,52 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"testing"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+)
+
+func TestShellRet(t *testing.T) {
+	intp := func(i int) *int { return &i }
+
+	tests := []struct {
+		name string
+		rsp  nmp.ShellExecRsp
+		ret  int
+		rc   int
+	}{
+		{"mynewt success", nmp.ShellExecRsp{Rc: 0}, 0, 0},
+		{"mynewt failure", nmp.ShellExecRsp{Rc: 1}, 1, 0},
+		{"mcumgr success", nmp.ShellExecRsp{Ret: intp(0)}, 0, 0},
+		{"mcumgr failure", nmp.ShellExecRsp{Ret: intp(-5)}, -5, 0},
+		{"mcumgr error", nmp.ShellExecRsp{Rc: nmp.NMP_ERR_ENOTSUP,
+			Ret: intp(0)}, 0, nmp.NMP_ERR_ENOTSUP},
+	}
+
+	for _, tt := range tests {
+		ret, rc := shellRet(&tt.rsp)
+		if ret != tt.ret || rc != tt.rc {
+			t.Errorf("%s: got ret=%d rc=%d; want ret=%d rc=%d",
+				tt.name, ret, rc, tt.ret, tt.rc)
+		}
+	}
+}
@@ -20,16 +20,30 @@
 package cli
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"os"
 	"sort"
+	"strconv"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"mynewt.apache.org/newt/util"
 	"mynewt.apache.org/newtmgr/newtmgr/nmutil"
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
 	"mynewt.apache.org/newtmgr/nmxact/xact"
 )
 
+var (
+	statWatchInterval time.Duration
+	statWatchCount    int
+	statWatchCsv      string
+	statWatchJsonl    string
+)
+
 func statsListRunCmd(cmd *cobra.Command, args []string) {
 	s, err := GetSesn()
 	if err != nil {
@@ -46,7 +60,7 @@ func statsListRunCmd(cmd *cobra.Command, args []string) {
 
 	sres := res.(*xact.StatListResult)
 	if sres.Rsp.Rc != 0 {
-		fmt.Printf("Error: %d\n", sres.Rsp.Rc)
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(sres.Rsp.Rc))
 	} else if len(sres.Rsp.List) == 0 {
 		fmt.Printf("stat groups: none\n")
 	} else {
@@ -84,7 +98,7 @@ func statsRunCmd(cmd *cobra.Command, args []string) {
 
 	sres := res.(*xact.StatReadResult)
 	if sres.Rsp.Rc != 0 {
-		fmt.Printf("Error: %d\n", sres.Rsp.Rc)
+		fmt.Printf("Error: %s\n", nmp.NmpRcToString(sres.Rsp.Rc))
 	} else {
 		fmt.Printf("stat group: %s\n", sres.Rsp.Name)
 		if len(sres.Rsp.Fields) == 0 {
@@ -103,6 +117,296 @@ func statsRunCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+// A snapshot of a stat group.
+type statSample struct {
+	Time   time.Time
+	Group  string
+	Fields map[string]uint64
+}
+
+// The change in a single stat between two samples.
+type statDelta struct {
+	Name  string
+	Value uint64
+	Delta uint64
+	Rate  float64
+}
+
+// Reads the current values of a stat group.
+func statReadSample(s sesn.Sesn, group string) (*statSample, int, error) {
+	c := xact.NewStatReadCmd()
+	c.SetTxOptions(nmutil.TxOptions())
+	c.Name = group
+
+	res, err := c.Run(s)
+	if err != nil {
+		if gerr := nmp.ToNmpGroup(err); gerr != nil {
+			return nil, gerr.Rc, nil
+		}
+		return nil, 0, err
+	}
+
+	rsp := res.(*xact.StatReadResult).Rsp
+	if rsp.Rc != 0 {
+		return nil, rsp.Rc, nil
+	}
+
+	sample := &statSample{
+		Time:   time.Now(),
+		Group:  group,
+		Fields: make(map[string]uint64, len(rsp.Fields)),
+	}
+	for name, _ := range rsp.Fields {
+		if v, ok := rsp.FieldUint64(name); ok {
+			sample.Fields[name] = v
+		}
+	}
+
+	return sample, 0, nil
+}
+
+// Calculates the change in each stat since the previous sample of the same
+// group, sorted by stat name.  If prev is nil, all deltas are zero.  If any
+// stat has decreased, the device has most likely rebooted and reset its
+// counters; in this case, the second return value is true and deltas are
+// measured from zero.
+func statDiff(prev *statSample, cur *statSample) ([]statDelta, bool) {
+	names := make([]string, 0, len(cur.Fields))
+	for name, _ := range cur.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	reset := false
+	if prev != nil {
+		for _, name := range names {
+			if cur.Fields[name] < prev.Fields[name] {
+				reset = true
+				break
+			}
+		}
+	}
+
+	var secs float64
+	if prev != nil {
+		secs = cur.Time.Sub(prev.Time).Seconds()
+	}
+
+	deltas := make([]statDelta, len(names))
+	for i, name := range names {
+		d := statDelta{
+			Name:  name,
+			Value: cur.Fields[name],
+		}
+
+		if prev != nil {
+			if reset {
+				d.Delta = d.Value
+			} else {
+				d.Delta = d.Value - prev.Fields[name]
+			}
+			if secs > 0 {
+				d.Rate = float64(d.Delta) / secs
+			}
+		}
+
+		deltas[i] = d
+	}
+
+	return deltas, reset
+}
+
+// Writes stat samples to the files specified on the command line.
+type statWatchOutput struct {
+	csvFile   *os.File
+	csvWriter *csv.Writer
+	jsonFile  *os.File
+	jsonEnc   *json.Encoder
+}
+
+// A single sample in the JSON lines output file.
+type statWatchJsonSample struct {
+	Time   string                        `json:"time"`
+	Group  string                        `json:"group"`
+	Reset  bool                          `json:"reset"`
+	Fields map[string]statWatchJsonField `json:"fields"`
+}
+
+type statWatchJsonField struct {
+	Value uint64  `json:"value"`
+	Delta uint64  `json:"delta"`
+	Rate  float64 `json:"rate"`
+}
+
+func newStatWatchOutput(csvFilename string,
+	jsonFilename string) (*statWatchOutput, error) {
+
+	o := &statWatchOutput{}
+
+	if csvFilename != "" {
+		f, err := os.Create(csvFilename)
+		if err != nil {
+			return nil, util.ChildNewtError(err)
+		}
+		o.csvFile = f
+		o.csvWriter = csv.NewWriter(f)
+		o.csvWriter.Write([]string{
+			"time", "group", "stat", "value", "delta", "rate", "reset",
+		})
+	}
+
+	if jsonFilename != "" {
+		f, err := os.Create(jsonFilename)
+		if err != nil {
+			o.close()
+			return nil, util.ChildNewtError(err)
+		}
+		o.jsonFile = f
+		o.jsonEnc = json.NewEncoder(f)
+	}
+
+	return o, nil
+}
+
+func (o *statWatchOutput) write(sample *statSample, deltas []statDelta,
+	reset bool) error {
+
+	ts := sample.Time.UTC().Format(time.RFC3339Nano)
+
+	if o.csvWriter != nil {
+		for _, d := range deltas {
+			o.csvWriter.Write([]string{
+				ts,
+				sample.Group,
+				d.Name,
+				strconv.FormatUint(d.Value, 10),
+				strconv.FormatUint(d.Delta, 10),
+				strconv.FormatFloat(d.Rate, 'f', 3, 64),
+				strconv.FormatBool(reset),
+			})
+		}
+		o.csvWriter.Flush()
+		if err := o.csvWriter.Error(); err != nil {
+			return util.ChildNewtError(err)
+		}
+	}
+
+	if o.jsonEnc != nil {
+		js := statWatchJsonSample{
+			Time:   ts,
+			Group:  sample.Group,
+			Reset:  reset,
+			Fields: make(map[string]statWatchJsonField, len(deltas)),
+		}
+		for _, d := range deltas {
+			js.Fields[d.Name] = statWatchJsonField{
+				Value: d.Value,
+				Delta: d.Delta,
+				Rate:  d.Rate,
+			}
+		}
+		if err := o.jsonEnc.Encode(js); err != nil {
+			return util.ChildNewtError(err)
+		}
+	}
+
+	return nil
+}
+
+func (o *statWatchOutput) close() {
+	if o.csvFile != nil {
+		o.csvFile.Close()
+	}
+	if o.jsonFile != nil {
+		o.jsonFile.Close()
+	}
+}
+
+func printStatDeltas(sample *statSample, deltas []statDelta, first bool,
+	reset bool) {
+
+	fmt.Printf("stat group: %s\n", sample.Group)
+	if reset {
+		fmt.Printf("    (counters reset; device rebooted?)\n")
+	}
+	if len(deltas) == 0 {
+		fmt.Printf("    (empty)\n")
+		return
+	}
+
+	fmt.Printf("%10s %10s %12s %s\n", "[value]", "[delta]", "[rate/s]",
+		"[name]")
+	for _, d := range deltas {
+		if first {
+			fmt.Printf("%10d %10s %12s %s\n", d.Value, "-", "-", d.Name)
+		} else {
+			fmt.Printf("%10d %10d %12.2f %s\n", d.Value, d.Delta, d.Rate,
+				d.Name)
+		}
+	}
+}
+
+func statsWatchRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		nmUsage(cmd, nil)
+	}
+	if statWatchInterval <= 0 {
+		nmUsage(cmd, util.NewNewtError("interval must be positive"))
+	}
+
+	out, err := newStatWatchOutput(statWatchCsv, statWatchJsonl)
+	if err != nil {
+		nmUsage(nil, err)
+	}
+	defer out.close()
+
+	s, err := GetSesn()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	p := &xact.Poller{
+		Interval: statWatchInterval,
+		Count:    statWatchCount,
+		Stop:     pollStopChan(),
+		ErrorCb:  pollWarn,
+	}
+	defer SetOnInterrupt(nil)
+
+	prev := map[string]*statSample{}
+	first := true
+	err = p.Run(s, func() (bool, error) {
+		fmt.Printf("%s\n", time.Now().Format(time.RFC3339))
+		for _, group := range args {
+			sample, rc, err := statReadSample(s, group)
+			if err != nil {
+				return false, err
+			}
+			if rc != 0 {
+				if first {
+					nmUsage(nil, util.FmtNewtError("stat group %s: %s",
+						group, nmp.NmpRcToString(rc)))
+				}
+				fmt.Printf("Error: %s: %s\n", group, nmp.NmpRcToString(rc))
+				continue
+			}
+
+			deltas, reset := statDiff(prev[group], sample)
+			printStatDeltas(sample, deltas, prev[group] == nil, reset)
+			if err := out.write(sample, deltas, reset); err != nil {
+				nmUsage(nil, err)
+			}
+			prev[group] = sample
+		}
+
+		first = false
+		return true, nil
+	})
+	if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+}
+
 func statsCmd() *cobra.Command {
 	statsHelpText := "Read statistics for the specified stats_name from a device"
 	statsCmd := &cobra.Command{
@@ -120,5 +424,34 @@ func statsCmd() *cobra.Command {
 
 	statsCmd.AddCommand(ListCmd)
 
+	watchHelpText := "Periodically read one or more stat groups from a " +
+		"device and display the\ncurrent values along with the change " +
+		"and per-second rate since the previous\nsample.  A decrease in " +
+		"any value is treated as a counter reset (e.g., a reboot).\n\n" +
+		"Use --csv or --jsonl to also write each sample to a file.  " +
+		"Press Ctrl-C to stop."
+
+	watchEx := "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex stat watch ble_phy ble_ll\n"
+	watchEx += "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex stat watch mgmt --interval 5s --csv mgmt.csv\n"
+
+	watchCmd := &cobra.Command{
+		Use:     "watch <stats_name> [stats_name...] -c <conn_profile>",
+		Short:   "Periodically read statistics from a device",
+		Long:    watchHelpText,
+		Example: watchEx,
+		Run:     statsWatchRunCmd,
+	}
+	watchCmd.Flags().DurationVar(&statWatchInterval, "interval", time.Second,
+		"Time between samples")
+	watchCmd.Flags().IntVar(&statWatchCount, "count", 0,
+		"Number of samples to take (0 for no limit)")
+	watchCmd.Flags().StringVar(&statWatchCsv, "csv", "",
+		"Write each sample to this CSV file")
+	watchCmd.Flags().StringVar(&statWatchJsonl, "jsonl", "",
+		"Write each sample to this JSON lines file")
+	statsCmd.AddCommand(watchCmd)
+
 	return statsCmd
 }
@@ -0,0 +1,84 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStatDiff(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	sample := func(secs int, fields map[string]uint64) *statSample {
+		return &statSample{
+			Time:   t0.Add(time.Duration(secs) * time.Second),
+			Group:  "g",
+			Fields: fields,
+		}
+	}
+
+	tests := []struct {
+		name   string
+		prev   *statSample
+		cur    *statSample
+		deltas []statDelta
+		reset  bool
+	}{
+		{"first sample", nil,
+			sample(0, map[string]uint64{"b": 5, "a": 3}),
+			[]statDelta{{"a", 3, 0, 0}, {"b", 5, 0, 0}}, false},
+		{"increase",
+			sample(0, map[string]uint64{"a": 3, "b": 5}),
+			sample(2, map[string]uint64{"a": 7, "b": 5}),
+			[]statDelta{{"a", 7, 4, 2}, {"b", 5, 0, 0}}, false},
+		{"new stat",
+			sample(0, map[string]uint64{"a": 3}),
+			sample(1, map[string]uint64{"a": 3, "b": 2}),
+			[]statDelta{{"a", 3, 0, 0}, {"b", 2, 2, 2}}, false},
+		{"removed stat",
+			sample(0, map[string]uint64{"a": 3, "b": 9}),
+			sample(1, map[string]uint64{"a": 4}),
+			[]statDelta{{"a", 4, 1, 1}}, false},
+		{"reset",
+			sample(0, map[string]uint64{"a": 100, "b": 5}),
+			sample(4, map[string]uint64{"a": 8, "b": 6}),
+			[]statDelta{{"a", 8, 8, 2}, {"b", 6, 6, 1.5}}, true},
+		{"no elapsed time",
+			sample(0, map[string]uint64{"a": 1}),
+			sample(0, map[string]uint64{"a": 2}),
+			[]statDelta{{"a", 2, 1, 0}}, false},
+		{"empty", sample(0, map[string]uint64{}),
+			sample(1, map[string]uint64{}),
+			[]statDelta{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deltas, reset := statDiff(tt.prev, tt.cur)
+			if reset != tt.reset {
+				t.Fatalf("reset=%v; want %v", reset, tt.reset)
+			}
+			if !reflect.DeepEqual(deltas, tt.deltas) {
+				t.Fatalf("deltas %+v; want %+v", deltas, tt.deltas)
+			}
+		})
+	}
+}
@@ -0,0 +1,380 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newtmgr/newtmgr/nmutil"
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
+	"mynewt.apache.org/newtmgr/nmxact/xact"
+)
+
+var (
+	topInterval  time.Duration
+	topCount     int
+	topSort      string
+	topStackWarn float64
+)
+
+const (
+	TOP_SORT_CPU     = "cpu"
+	TOP_SORT_NAME    = "name"
+	TOP_SORT_PRIO    = "prio"
+	TOP_SORT_STACK   = "stack"
+	TOP_SORT_CSW     = "csw"
+	TOP_SORT_RUNTIME = "runtime"
+)
+
+var topSortKeys = []string{
+	TOP_SORT_CPU,
+	TOP_SORT_NAME,
+	TOP_SORT_PRIO,
+	TOP_SORT_STACK,
+	TOP_SORT_CSW,
+	TOP_SORT_RUNTIME,
+}
+
+// ANSI escape sequences used when writing to a terminal.
+const (
+	TOP_ANSI_CLEAR   = "\033[H\033[2J"
+	TOP_ANSI_WARN    = "\033[1;31m"
+	TOP_ANSI_RESET   = "\033[0m"
+	TOP_ANSI_REVERSE = "\033[7m"
+)
+
+// A single row of the task table.
+type topTask struct {
+	Name      string
+	Prio      int
+	Tid       int
+	Runtime   int
+	Csw       int
+	StackSize int
+	StackUse  int
+
+	// Percentage of CPU time used since the previous sample; negative if
+	// unknown.
+	Cpu float64
+}
+
+func (t *topTask) stackPct() float64 {
+	if t.StackSize == 0 {
+		return 0
+	}
+	return 100 * float64(t.StackUse) / float64(t.StackSize)
+}
+
+// Builds the task table from two consecutive task statistics responses.
+// CPU usage is a task's share of the total runtime that elapsed across all
+// tasks between the two samples.  If prev is nil, or if any runtime
+// decreased (i.e., the device rebooted), CPU usage is unknown.
+func topBuildTasks(prev map[string]map[string]int,
+	cur map[string]map[string]int) []topTask {
+
+	tasks := make([]topTask, 0, len(cur))
+	for name, t := range cur {
+		tasks = append(tasks, topTask{
+			Name:      name,
+			Prio:      t["prio"],
+			Tid:       t["tid"],
+			Runtime:   t["runtime"],
+			Csw:       t["cswcnt"],
+			StackSize: t["stksiz"],
+			StackUse:  t["stkuse"],
+			Cpu:       -1,
+		})
+	}
+
+	if prev == nil {
+		return tasks
+	}
+
+	total := 0
+	deltas := make([]int, len(tasks))
+	for i, t := range tasks {
+		p, ok := prev[t.Name]
+		if !ok {
+			// New task; its entire runtime is recent.
+			deltas[i] = t.Runtime
+		} else {
+			deltas[i] = t.Runtime - p["runtime"]
+		}
+		if deltas[i] < 0 {
+			return tasks
+		}
+		total += deltas[i]
+	}
+
+	if total > 0 {
+		for i, _ := range tasks {
+			tasks[i].Cpu = 100 * float64(deltas[i]) / float64(total)
+		}
+	}
+
+	return tasks
+}
+
+func topSortTasks(tasks []topTask, key string) {
+	less := func(i, j int) bool {
+		a, b := &tasks[i], &tasks[j]
+
+		switch key {
+		case TOP_SORT_CPU:
+			if a.Cpu != b.Cpu {
+				return a.Cpu > b.Cpu
+			}
+		case TOP_SORT_PRIO:
+			if a.Prio != b.Prio {
+				return a.Prio < b.Prio
+			}
+		case TOP_SORT_STACK:
+			if a.stackPct() != b.stackPct() {
+				return a.stackPct() > b.stackPct()
+			}
+		case TOP_SORT_CSW:
+			if a.Csw != b.Csw {
+				return a.Csw > b.Csw
+			}
+		case TOP_SORT_RUNTIME:
+			if a.Runtime != b.Runtime {
+				return a.Runtime > b.Runtime
+			}
+		}
+
+		return a.Name < b.Name
+	}
+
+	sort.SliceStable(tasks, less)
+}
+
+// Reads task and memory pool statistics from the device.  A nil map means
+// the corresponding command failed with the accompanying status code.
+func topRead(s sesn.Sesn) (map[string]map[string]int,
+	map[string]map[string]int, int, error) {
+
+	tc := xact.NewTaskStatCmd()
+	tc.SetTxOptions(nmutil.TxOptions())
+	tres, err := tc.Run(s)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if tres.Status() != 0 {
+		return nil, nil, tres.Status(), nil
+	}
+
+	var mpools map[string]map[string]int
+
+	mc := xact.NewMempoolStatCmd()
+	mc.SetTxOptions(nmutil.TxOptions())
+	mres, err := mc.Run(s)
+	if err != nil && !nmp.IsNmpGroup(err) {
+		return nil, nil, 0, err
+	}
+	if err == nil && mres.Status() == 0 {
+		mpools = mres.(*xact.MempoolStatResult).Rsp.Mpools
+	}
+
+	return tres.(*xact.TaskStatResult).Rsp.Tasks, mpools, 0, nil
+}
+
+func topPrint(tasks []topTask, mpools map[string]map[string]int,
+	tty bool) {
+
+	var b strings.Builder
+
+	if tty {
+		b.WriteString(TOP_ANSI_CLEAR)
+	}
+
+	fmt.Fprintf(&b, "%s - %d tasks, sorted by %s\n\n",
+		time.Now().Format("15:04:05"), len(tasks), topSort)
+
+	hdr := fmt.Sprintf("%-16s %4s %4s %6s %10s %10s %13s %5s",
+		"task", "pri", "tid", "cpu%", "runtime", "csw", "stack",
+		"stk%")
+	if tty {
+		b.WriteString(TOP_ANSI_REVERSE + hdr + TOP_ANSI_RESET + "\n")
+	} else {
+		b.WriteString(hdr + "\n")
+	}
+
+	for _, t := range tasks {
+		cpu := "-"
+		if t.Cpu >= 0 {
+			cpu = fmt.Sprintf("%.1f", t.Cpu)
+		}
+
+		line := fmt.Sprintf("%-16s %4d %4d %6s %10d %10d %13s %5.1f",
+			t.Name, t.Prio, t.Tid, cpu, t.Runtime, t.Csw,
+			fmt.Sprintf("%d/%d", t.StackUse, t.StackSize), t.stackPct())
+
+		if t.stackPct() >= topStackWarn {
+			if tty {
+				line = TOP_ANSI_WARN + line + TOP_ANSI_RESET
+			} else {
+				line += " !"
+			}
+		}
+		b.WriteString(line + "\n")
+	}
+
+	b.WriteString("\n")
+	if mpools == nil {
+		b.WriteString("(mempool statistics unavailable)\n")
+	} else {
+		names := make([]string, 0, len(mpools))
+		for name, _ := range mpools {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		hdr := fmt.Sprintf("%-24s %5s %5s %5s %5s %5s", "mempool",
+			"blksz", "cnt", "used", "use%", "min")
+		if tty {
+			b.WriteString(TOP_ANSI_REVERSE + hdr + TOP_ANSI_RESET + "\n")
+		} else {
+			b.WriteString(hdr + "\n")
+		}
+
+		for _, name := range names {
+			mp := mpools[name]
+			used := mp["nblks"] - mp["nfree"]
+			pct := 0.0
+			if mp["nblks"] > 0 {
+				pct = 100 * float64(used) / float64(mp["nblks"])
+			}
+			fmt.Fprintf(&b, "%-24s %5d %5d %5d %5.1f %5d\n",
+				name, mp["blksiz"], mp["nblks"], used, pct, mp["min"])
+		}
+	}
+
+	// Separate refreshes when the output is not being redrawn in place.
+	if !tty {
+		b.WriteString("\n")
+	}
+
+	fmt.Print(b.String())
+}
+
+// Indicates whether stdout is a terminal.
+func topIsTerminal() bool {
+	fi, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+func topRunCmd(cmd *cobra.Command, args []string) {
+	valid := false
+	for _, k := range topSortKeys {
+		if topSort == k {
+			valid = true
+		}
+	}
+	if !valid {
+		nmUsage(cmd, util.FmtNewtError("invalid sort key: %s (valid keys: "+
+			"%s)", topSort, strings.Join(topSortKeys, ", ")))
+	}
+	if topInterval <= 0 {
+		nmUsage(cmd, util.NewNewtError("interval must be positive"))
+	}
+
+	s, err := GetSesn()
+	if err != nil {
+		nmUsage(nil, err)
+	}
+
+	tty := topIsTerminal()
+
+	p := &xact.Poller{
+		Interval: topInterval,
+		Count:    topCount,
+		Stop:     pollStopChan(),
+		ErrorCb:  pollWarn,
+	}
+	defer SetOnInterrupt(nil)
+
+	var prev map[string]map[string]int
+	err = p.Run(s, func() (bool, error) {
+		tasks, mpools, rc, err := topRead(s)
+		if err != nil {
+			gerr := nmp.ToNmpGroup(err)
+			if gerr == nil {
+				return false, err
+			}
+			rc = gerr.Rc
+		}
+		if rc != 0 {
+			fmt.Printf("Error: %s\n", nmp.NmpRcToString(rc))
+			return false, nil
+		}
+
+		rows := topBuildTasks(prev, tasks)
+		topSortTasks(rows, topSort)
+		topPrint(rows, mpools, tty)
+
+		prev = tasks
+		return true, nil
+	})
+	if err != nil {
+		nmUsage(nil, util.ChildNewtError(err))
+	}
+}
+
+func topCmd() *cobra.Command {
+	topHelpText := "Display a periodically refreshed view of the tasks and " +
+		"memory pools on a device.\n\n" +
+		"CPU usage is each task's share of the run time accumulated by " +
+		"all tasks since\nthe previous refresh.  Tasks whose stack " +
+		"high-water mark is at or above the\n--stack-warn percentage of " +
+		"their stack size are highlighted.  Press Ctrl-C to\nstop."
+
+	topEx := "  " + nmutil.ToolInfo.ExeName + " -c olimex top\n"
+	topEx += "  " + nmutil.ToolInfo.ExeName +
+		" -c olimex top --sort stack --interval 5s\n"
+
+	topCmd := &cobra.Command{
+		Use:     "top -c <conn_profile>",
+		Short:   "Display a live view of task and mempool statistics",
+		Long:    topHelpText,
+		Example: topEx,
+		Run:     topRunCmd,
+	}
+	topCmd.Flags().DurationVar(&topInterval, "interval", 2*time.Second,
+		"Time between refreshes")
+	topCmd.Flags().IntVar(&topCount, "count", 0,
+		"Number of refreshes (0 for no limit)")
+	topCmd.Flags().StringVar(&topSort, "sort", TOP_SORT_CPU,
+		"Task sort key ("+strings.Join(topSortKeys, ", ")+")")
+	topCmd.Flags().Float64Var(&topStackWarn, "stack-warn", 80,
+		"Highlight tasks using at least this percentage of their stack")
+
+	return topCmd
+}
@@ -22,6 +22,7 @@ package cli
 import (
 	"fmt"
 	"os"
+	"sync"
 	"sync/atomic"
 
 	log "github.com/sirupsen/logrus"
@@ -34,10 +35,54 @@ var onExit func()
 var exiting int32
 var silenceErrors bool
 
+var onInterrupt func()
+var onInterruptMtx sync.Mutex
+
 func SetOnExit(cb func()) {
 	onExit = cb
 }
 
+// Registers a callback to execute when the user interrupts the application,
+// in place of the default behavior of exiting immediately.  The callback is
+// executed at most once; a second interrupt terminates the application.
+func SetOnInterrupt(cb func()) {
+	onInterruptMtx.Lock()
+	defer onInterruptMtx.Unlock()
+
+	onInterrupt = cb
+}
+
+// Returns a channel that is closed when the user interrupts a command that
+// polls a device, so that polling stops rather than the application exiting
+// mid-transaction.  The caller must call SetOnInterrupt(nil) once polling
+// ends.
+func pollStopChan() chan struct{} {
+	stop := make(chan struct{})
+	SetOnInterrupt(func() { close(stop) })
+	return stop
+}
+
+// Reports a transient error encountered while polling a device.
+func pollWarn(err error) {
+	fmt.Fprintf(os.Stderr, "Warning: %s; retrying\n", err.Error())
+}
+
+// Handles a user interrupt (e.g., Ctrl-C).
+func Interrupt() {
+	onInterruptMtx.Lock()
+	cb := onInterrupt
+	onInterrupt = nil
+	onInterruptMtx.Unlock()
+
+	if cb != nil {
+		cb()
+		return
+	}
+
+	SilenceErrors()
+	NmExit(1)
+}
+
 func SilenceErrors() {
 	silenceErrors = true
 }
@@ -62,6 +62,8 @@ const (
 	CONN_TYPE_UDP_PLAIN
 	CONN_TYPE_UDP_OIC
 	CONN_TYPE_MTECH_LORA_OIC
+	CONN_TYPE_TCP_PLAIN
+	CONN_TYPE_TCP_OIC
 )
 
 var connTypeNameMap = map[ConnType]string{
@@ -74,6 +76,8 @@ var connTypeNameMap = map[ConnType]string{
 	CONN_TYPE_UDP_PLAIN:      "udp",
 	CONN_TYPE_UDP_OIC:        "oic_udp",
 	CONN_TYPE_MTECH_LORA_OIC: "oic_mtech",
+	CONN_TYPE_TCP_PLAIN:      "tcp",
+	CONN_TYPE_TCP_OIC:        "oic_tcp",
 	CONN_TYPE_NONE:           "???",
 }
 
@@ -0,0 +1,100 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newtmgr/newtmgr/nmutil"
+)
+
+// LogNames maps the names of a device's log modules and levels to their IDs.
+// This is the format that devices use to report their modules and levels, as
+// well as the format of user-supplied mapping files.
+type LogNames struct {
+	Modules map[string]int `json:"modules"`
+	Levels  map[string]int `json:"levels"`
+}
+
+// ReadLogNamesFile reads a log module and level mapping from a JSON file.
+func ReadLogNamesFile(filename string) (*LogNames, error) {
+	blob, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	ln := &LogNames{}
+	if err := json.Unmarshal(blob, ln); err != nil {
+		return nil, util.FmtNewtError("error reading log names "+
+			"(%s): %s", filename, err.Error())
+	}
+
+	return ln, nil
+}
+
+// LogNamesMgr caches the log names learned from devices so that they don't
+// need to be queried on every invocation.  Names are keyed by the
+// connection profile that they were learned through.
+type LogNamesMgr struct {
+	file  *stateFile
+	names map[string]*LogNames
+}
+
+func NewLogNamesMgr() (*LogNamesMgr, error) {
+	file, err := newStateFile(nmutil.ToolInfo.LogNamesFilename,
+		"log names")
+	if err != nil {
+		return nil, err
+	}
+
+	lnm := &LogNamesMgr{
+		file:  file,
+		names: map[string]*LogNames{},
+	}
+	if err := file.read(&lnm.names); err != nil {
+		return nil, err
+	}
+
+	return lnm, nil
+}
+
+func (lnm *LogNamesMgr) save() error {
+	return lnm.file.write(lnm.names)
+}
+
+func (lnm *LogNamesMgr) GetLogNames(key string) *LogNames {
+	return lnm.names[key]
+}
+
+func (lnm *LogNamesMgr) SetLogNames(key string, ln *LogNames) error {
+	lnm.names[key] = ln
+	return lnm.save()
+}
+
+func (lnm *LogNamesMgr) DeleteLogNames(key string) error {
+	if lnm.names[key] == nil {
+		return nil
+	}
+
+	delete(lnm.names, key)
+	return lnm.save()
+}
@@ -0,0 +1,87 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package config
+
+import (
+	"sort"
+
+	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newtmgr/newtmgr/nmutil"
+)
+
+// ShellAliasMgr stores the client-side aliases used by the interactive
+// shell.  Each alias maps a name to the command line it expands to.
+type ShellAliasMgr struct {
+	file    *stateFile
+	aliases map[string]string
+}
+
+func NewShellAliasMgr() (*ShellAliasMgr, error) {
+	file, err := newStateFile(nmutil.ToolInfo.ShellAliasFilename,
+		"shell aliases")
+	if err != nil {
+		return nil, err
+	}
+
+	sam := &ShellAliasMgr{
+		file:    file,
+		aliases: map[string]string{},
+	}
+	if err := file.read(&sam.aliases); err != nil {
+		return nil, err
+	}
+
+	return sam, nil
+}
+
+func (sam *ShellAliasMgr) save() error {
+	return sam.file.write(sam.aliases)
+}
+
+// GetShellAliasNames returns the names of all aliases, sorted.
+func (sam *ShellAliasMgr) GetShellAliasNames() []string {
+	names := make([]string, 0, len(sam.aliases))
+	for name, _ := range sam.aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// GetShellAlias returns the expansion of the named alias, or "" if there is
+// no such alias.
+func (sam *ShellAliasMgr) GetShellAlias(name string) string {
+	return sam.aliases[name]
+}
+
+func (sam *ShellAliasMgr) SetShellAlias(name string, expansion string) error {
+	sam.aliases[name] = expansion
+	return sam.save()
+}
+
+func (sam *ShellAliasMgr) DeleteShellAlias(name string) error {
+	if _, ok := sam.aliases[name]; !ok {
+		return util.FmtNewtError("alias \"%s\" doesn't exist", name)
+	}
+
+	delete(sam.aliases, name)
+	return sam.save()
+}
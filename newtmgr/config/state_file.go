@@ -0,0 +1,95 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mitchellh/go-homedir"
+	log "github.com/sirupsen/logrus"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// stateFile is a JSON file that persists newtmgr state, such as cached
+// device information, between invocations.
+type stateFile struct {
+	filename string
+
+	// Describes the contents of the file in messages.
+	desc string
+}
+
+// newStateFile creates a state file located in the user's home directory.
+func newStateFile(basename string, desc string) (*stateFile, error) {
+	dir, err := homedir.Dir()
+	if err != nil {
+		return nil, util.NewNewtError(err.Error())
+	}
+
+	return &stateFile{
+		filename: filepath.Join(dir, basename),
+		desc:     desc,
+	}, nil
+}
+
+// read decodes the contents of the file into v.  If the file doesn't exist, v
+// is left unchanged.
+func (sf *stateFile) read(v interface{}) error {
+	log.Debugf("Reading %s from %s", sf.desc, sf.filename)
+	blob, err := ioutil.ReadFile(sf.filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		} else {
+			return util.ChildNewtError(err)
+		}
+	}
+
+	if err := json.Unmarshal(blob, v); err != nil {
+		return util.FmtNewtError("error reading %s (%s): %s", sf.desc,
+			sf.filename, err.Error())
+	}
+
+	return nil
+}
+
+// write replaces the contents of the file with the encoding of v.
+func (sf *stateFile) write(v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return util.NewNewtError(err.Error())
+	}
+
+	// Write to a temporary file and rename it so that a kill in the middle
+	// of a write doesn't leave a truncated file behind.
+	tmpFilename := sf.filename + ".tmp"
+	if err := ioutil.WriteFile(tmpFilename, b, 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+	if err := os.Rename(tmpFilename, sf.filename); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package config
+
+import (
+	"mynewt.apache.org/newtmgr/newtmgr/nmutil"
+)
+
+// UploadState records the progress of an image upload to a single device.
+type UploadState struct {
+	Filename string `json:"Filename"`
+	Hash     string `json:"Hash"`
+	ImageNum int    `json:"ImageNum"`
+	Off      int    `json:"Off"`
+}
+
+// UploadStateMgr persists the progress of image uploads so that an
+// interrupted upload can be resumed by a later invocation.  States are keyed
+// by the connection profile used to reach the device.
+type UploadStateMgr struct {
+	file   *stateFile
+	states map[string]*UploadState
+}
+
+func NewUploadStateMgr() (*UploadStateMgr, error) {
+	file, err := newStateFile(nmutil.ToolInfo.UploadStateFilename,
+		"upload state")
+	if err != nil {
+		return nil, err
+	}
+
+	usm := &UploadStateMgr{
+		file:   file,
+		states: map[string]*UploadState{},
+	}
+	if err := file.read(&usm.states); err != nil {
+		return nil, err
+	}
+
+	return usm, nil
+}
+
+func (usm *UploadStateMgr) save() error {
+	return usm.file.write(usm.states)
+}
+
+func (usm *UploadStateMgr) GetUploadState(key string) *UploadState {
+	return usm.states[key]
+}
+
+func (usm *UploadStateMgr) SetUploadState(key string, us *UploadState) error {
+	usm.states[key] = us
+	return usm.save()
+}
+
+func (usm *UploadStateMgr) DeleteUploadState(key string) error {
+	if usm.states[key] == nil {
+		return nil
+	}
+
+	delete(usm.states, key)
+	return usm.save()
+}
@@ -74,11 +74,15 @@ func cleanup() {
 
 func main() {
 	nmutil.ToolInfo = nmutil.ToolInfoType{
-		ExeName:       "newtmgr",
-		ShortName:     "Newtmgr",
-		LongName:      "Apache Newtmgr",
-		VersionString: "1.13.0-dev",
-		CfgFilename:   ".newtmgr.cp.json",
+		ExeName:              "newtmgr",
+		ShortName:            "Newtmgr",
+		LongName:             "Apache Newtmgr",
+		VersionString:        "1.13.0-dev",
+		CfgFilename:          ".newtmgr.cp.json",
+		UploadStateFilename:  ".newtmgr.upload.json",
+		LogNamesFilename:     ".newtmgr.lognames.json",
+		ShellHistoryFilename: ".newtmgr.shell_history",
+		ShellAliasFilename:   ".newtmgr.shell_aliases.json",
 	}
 
 	if err := config.InitGlobalConnProfileMgr(); err != nil {
@@ -97,10 +101,7 @@ func main() {
 			s := <-sigChan
 			switch s {
 			case os.Interrupt, syscall.SIGTERM:
-				go func() {
-					cli.SilenceErrors()
-					cli.NmExit(1)
-				}()
+				go cli.Interrupt()
 
 			case syscall.SIGQUIT:
 				util.PrintStacks()
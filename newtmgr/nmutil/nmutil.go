@@ -28,11 +28,15 @@ import (
 )
 
 type ToolInfoType struct {
-	ExeName       string
-	ShortName     string
-	LongName      string
-	VersionString string
-	CfgFilename   string
+	ExeName              string
+	ShortName            string
+	LongName             string
+	VersionString        string
+	CfgFilename          string
+	UploadStateFilename  string
+	LogNamesFilename     string
+	ShellHistoryFilename string
+	ShellAliasFilename   string
 }
 
 var Timeout float64
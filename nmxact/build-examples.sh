@@ -21,6 +21,7 @@ read -r -d '' exdirs <<-'EOS'
     ble_loop
     ble_plain
     serial_plain
+    sim_plain
 EOS
 
 rc=0
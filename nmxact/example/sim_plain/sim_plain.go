@@ -0,0 +1,83 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmsim"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
+	"mynewt.apache.org/newtmgr/nmxact/xact"
+)
+
+func main() {
+	// Initialize the simulator transport.  A new simulated device gets
+	// created for us.
+	cfg := nmsim.NewXportCfg()
+	x := nmsim.NewSimXport(cfg)
+
+	// Start the simulator transport.
+	if err := x.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "error starting simulator transport: %s\n",
+			err.Error())
+		os.Exit(1)
+	}
+	defer x.Stop()
+
+	// Create and open a session for the simulated device.
+	sc := sesn.NewSesnCfg()
+	sc.MgmtProto = sesn.MGMT_PROTO_NMP
+
+	s, err := x.BuildSesn(sc)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error creating simulator session: %s\n",
+			err.Error())
+		os.Exit(1)
+	}
+
+	if err := s.Open(); err != nil {
+		fmt.Fprintf(os.Stderr, "error starting simulator session: %s\n",
+			err.Error())
+		os.Exit(1)
+	}
+	defer s.Close()
+
+	// Read the device's image state.
+	c := xact.NewImageStateReadCmd()
+
+	res, err := c.Run(s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error executing image state command: %s\n",
+			err.Error())
+		os.Exit(1)
+	}
+
+	if res.Status() != 0 {
+		fmt.Printf("Device responded negatively to image state command; "+
+			"status=%d\n", res.Status())
+	}
+
+	ires := res.(*xact.ImageStateReadResult)
+	for _, img := range ires.Rsp.Images {
+		fmt.Printf("slot=%d version=%s hash=%x\n",
+			img.Slot, img.Version, img.Hash)
+	}
+}
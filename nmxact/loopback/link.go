@@ -0,0 +1,186 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package loopback
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// LinkCfg describes the impairments applied to data travelling in one
+// direction across a loopback link.
+type LinkCfg struct {
+	// Time it takes a fragment to cross the link.
+	Latency time.Duration
+
+	// Probability (0.0 - 1.0) that a fragment is dropped.
+	LossRate float64
+
+	// Probability (0.0 - 1.0) that a fragment is delivered after the
+	// fragment that follows it.
+	ReorderRate float64
+
+	// Probability (0.0 - 1.0) that a fragment is delivered twice.
+	DupRate float64
+}
+
+type delivery struct {
+	data []byte
+	due  time.Time
+}
+
+// pipe carries fragments in one direction.  Impairments are decided in the
+// order fragments are sent using a seeded random number generator, so a
+// given sequence of fragments is always impaired in the same way.
+type pipe struct {
+	cfg     LinkCfg
+	rng     *rand.Rand
+	deliver func(data []byte)
+
+	inChan   chan []byte
+	outChan  chan delivery
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// How long a fragment selected for reordering waits for a successor before
+// it is delivered anyway.
+const REORDER_MAX_HOLD = 50 * time.Millisecond
+
+func newPipe(cfg LinkCfg, seed int64, deliver func(data []byte)) *pipe {
+	p := &pipe{
+		cfg:      cfg,
+		rng:      rand.New(rand.NewSource(seed)),
+		deliver:  deliver,
+		inChan:   make(chan []byte, 64),
+		outChan:  make(chan delivery, 64),
+		stopChan: make(chan struct{}),
+	}
+
+	p.wg.Add(2)
+	go p.impair()
+	go p.output()
+
+	return p
+}
+
+// send queues a fragment for transmission.  False is returned if the pipe
+// has been stopped.
+func (p *pipe) send(data []byte) bool {
+	select {
+	case p.inChan <- append([]byte(nil), data...):
+		return true
+	case <-p.stopChan:
+		return false
+	}
+}
+
+func (p *pipe) stop() {
+	close(p.stopChan)
+	p.wg.Wait()
+}
+
+func (p *pipe) enqueue(data []byte) bool {
+	d := delivery{
+		data: data,
+		due:  time.Now().Add(p.cfg.Latency),
+	}
+
+	select {
+	case p.outChan <- d:
+		return true
+	case <-p.stopChan:
+		return false
+	}
+}
+
+func (p *pipe) chance(rate float64) bool {
+	return rate > 0 && p.rng.Float64() < rate
+}
+
+func (p *pipe) impair() {
+	defer p.wg.Done()
+
+	var held []byte
+	var holdTimer <-chan time.Time
+
+	for {
+		select {
+		case data := <-p.inChan:
+			if p.chance(p.cfg.LossRate) {
+				continue
+			}
+
+			dup := p.chance(p.cfg.DupRate)
+
+			if held == nil && p.chance(p.cfg.ReorderRate) {
+				held = data
+				holdTimer = time.After(REORDER_MAX_HOLD)
+				continue
+			}
+
+			if !p.enqueue(data) {
+				return
+			}
+			if dup && !p.enqueue(data) {
+				return
+			}
+			if held != nil {
+				if !p.enqueue(held) {
+					return
+				}
+				held = nil
+				holdTimer = nil
+			}
+
+		case <-holdTimer:
+			if !p.enqueue(held) {
+				return
+			}
+			held = nil
+			holdTimer = nil
+
+		case <-p.stopChan:
+			return
+		}
+	}
+}
+
+func (p *pipe) output() {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case d := <-p.outChan:
+			if wait := time.Until(d.due); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-p.stopChan:
+					return
+				}
+			}
+			p.deliver(d.data)
+
+		case <-p.stopChan:
+			return
+		}
+	}
+}
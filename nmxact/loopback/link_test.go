@@ -0,0 +1,179 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package loopback
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+const pipeTestFrags = 200
+
+// runPipe sends a numbered sequence of one-byte fragments through a pipe and
+// returns the fragments in the order they were delivered.
+func runPipe(cfg LinkCfg, seed int64) []int {
+	var mtx sync.Mutex
+	var got []int
+
+	p := newPipe(cfg, seed, func(data []byte) {
+		mtx.Lock()
+		got = append(got, int(data[0]))
+		mtx.Unlock()
+	})
+
+	for i := 0; i < pipeTestFrags; i++ {
+		p.send([]byte{byte(i)})
+	}
+
+	// Allow a held fragment to be released.
+	time.Sleep(cfg.Latency + 2*REORDER_MAX_HOLD)
+	p.stop()
+
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	return got
+}
+
+func TestPipeImpairments(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   LinkCfg
+		check func(t *testing.T, got []int)
+	}{
+		{
+			name: "none",
+			cfg:  LinkCfg{},
+			check: func(t *testing.T, got []int) {
+				for i, v := range got {
+					if v != i {
+						t.Fatalf("position %d holds fragment %d", i, v)
+					}
+				}
+				if len(got) != pipeTestFrags {
+					t.Fatalf("delivered %d fragments; want %d",
+						len(got), pipeTestFrags)
+				}
+			},
+		},
+		{
+			name: "loss",
+			cfg:  LinkCfg{LossRate: 0.2},
+			check: func(t *testing.T, got []int) {
+				if len(got) == pipeTestFrags || len(got) == 0 {
+					t.Fatalf("delivered %d of %d fragments",
+						len(got), pipeTestFrags)
+				}
+				if !sort.IntsAreSorted(got) {
+					t.Fatalf("lossy link reordered fragments: %v", got)
+				}
+			},
+		},
+		{
+			name: "dup",
+			cfg:  LinkCfg{DupRate: 0.2},
+			check: func(t *testing.T, got []int) {
+				if len(got) <= pipeTestFrags {
+					t.Fatalf("no fragments were duplicated")
+				}
+				if !sort.IntsAreSorted(got) {
+					t.Fatalf("duplicating link reordered fragments: %v",
+						got)
+				}
+				seen := map[int]int{}
+				for _, v := range got {
+					seen[v]++
+					if seen[v] > 2 {
+						t.Fatalf("fragment %d delivered %d times",
+							v, seen[v])
+					}
+				}
+				if len(seen) != pipeTestFrags {
+					t.Fatalf("%d fragments missing",
+						pipeTestFrags-len(seen))
+				}
+			},
+		},
+		{
+			name: "reorder",
+			cfg:  LinkCfg{ReorderRate: 0.2},
+			check: func(t *testing.T, got []int) {
+				if sort.IntsAreSorted(got) {
+					t.Fatalf("no fragments were reordered")
+				}
+				sorted := append([]int(nil), got...)
+				sort.Ints(sorted)
+				for i, v := range sorted {
+					if v != i {
+						t.Fatalf("reordering link lost or duplicated "+
+							"fragments: %v", got)
+					}
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := runPipe(tt.cfg, 1)
+			tt.check(t, got)
+
+			// The same seed always impairs the sequence in the same way.
+			for i := 0; i < 3; i++ {
+				again := runPipe(tt.cfg, 1)
+				if !reflect.DeepEqual(got, again) {
+					t.Fatalf("run %d differs with the same seed:\n"+
+						"%v\n%v", i+2, got, again)
+				}
+			}
+
+			if tt.cfg != (LinkCfg{}) {
+				other := runPipe(tt.cfg, 2)
+				if reflect.DeepEqual(got, other) {
+					t.Fatalf("different seeds impaired the sequence " +
+						"identically")
+				}
+			}
+		})
+	}
+}
+
+func TestPipeLatency(t *testing.T) {
+	const latency = 30 * time.Millisecond
+
+	start := time.Now()
+	done := make(chan time.Duration, 1)
+
+	p := newPipe(LinkCfg{Latency: latency}, 1, func(data []byte) {
+		done <- time.Since(start)
+	})
+	defer p.stop()
+
+	p.send([]byte{0})
+
+	if d := <-done; d < latency {
+		t.Fatalf("fragment delivered after %s; want at least %s",
+			d, latency)
+	}
+}
@@ -0,0 +1,246 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package loopback
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/runtimeco/go-coap"
+
+	"mynewt.apache.org/newtmgr/nmxact/mgmt"
+	"mynewt.apache.org/newtmgr/nmxact/nmcoap"
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
+)
+
+type LoopbackSesn struct {
+	cfg    sesn.SesnCfg
+	lx     *LoopbackXport
+	txvr   *mgmt.Transceiver
+	isOpen bool
+
+	// Client to server and server to client directions of the link.
+	c2s *pipe
+	s2c *pipe
+
+	// This mutex ensures:
+	//     * accesses to isOpen and the pipes are protected.
+	m sync.Mutex
+}
+
+func NewLoopbackSesn(lx *LoopbackXport,
+	cfg sesn.SesnCfg) (*LoopbackSesn, error) {
+
+	if cfg.MgmtProto != sesn.MGMT_PROTO_NMP &&
+		cfg.MgmtProto != sesn.MGMT_PROTO_OMP {
+
+		return nil, fmt.Errorf("Invalid management protocol for loopback "+
+			"session: %s", cfg.MgmtProto)
+	}
+	if lx.cfg.NewHandler == nil {
+		return nil, fmt.Errorf("Loopback xport has no handler factory")
+	}
+
+	s := &LoopbackSesn{
+		cfg: cfg,
+		lx:  lx,
+	}
+
+	txvr, err := mgmt.NewTransceiver(cfg.TxFilter, cfg.RxFilter,
+		lx.cfg.CoapIsTcp, cfg.MgmtProto, 3)
+	if err != nil {
+		return nil, err
+	}
+	s.txvr = txvr
+
+	return s, nil
+}
+
+// isStream indicates whether messages can be split across several
+// fragments.  CoAP datagrams must fit in a single fragment.
+func (s *LoopbackSesn) isStream() bool {
+	return s.cfg.MgmtProto == sesn.MGMT_PROTO_NMP || s.lx.cfg.CoapIsTcp
+}
+
+func (s *LoopbackSesn) Open() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.isOpen {
+		return nmxutil.NewSesnAlreadyOpenError(
+			"Attempt to open an already-open loopback session")
+	}
+
+	txvr, err := mgmt.NewTransceiver(s.cfg.TxFilter, s.cfg.RxFilter,
+		s.lx.cfg.CoapIsTcp, s.cfg.MgmtProto, 3)
+	if err != nil {
+		return err
+	}
+	s.txvr = txvr
+
+	h := s.lx.cfg.NewHandler(s.cfg.MgmtProto, s.lx.cfg.CoapIsTcp)
+	mtu := s.lx.cfg.Mtu
+	stream := s.isStream()
+
+	s2c := newPipe(s.lx.cfg.Rx, s.lx.cfg.Seed+1, func(data []byte) {
+		txvr.DispatchNmpRsp(data)
+	})
+
+	c2s := newPipe(s.lx.cfg.Tx, s.lx.cfg.Seed, func(data []byte) {
+		for _, rsp := range h.Rx(data) {
+			frags := [][]byte{rsp}
+			if stream {
+				frags = nmxutil.Fragment(rsp, mtu)
+			}
+			for _, frag := range frags {
+				s2c.send(frag)
+			}
+		}
+	})
+
+	s.c2s = c2s
+	s.s2c = s2c
+	s.isOpen = true
+
+	return nil
+}
+
+func (s *LoopbackSesn) Close() error {
+	s.m.Lock()
+
+	if !s.isOpen {
+		s.m.Unlock()
+		return nmxutil.NewSesnClosedError(
+			"Attempt to close an unopened loopback session")
+	}
+
+	s.isOpen = false
+	c2s := s.c2s
+	s2c := s.s2c
+	s.m.Unlock()
+
+	c2s.stop()
+	s2c.stop()
+
+	s.txvr.ErrorAll(fmt.Errorf("closed"))
+	s.txvr.Stop()
+
+	return nil
+}
+
+func (s *LoopbackSesn) IsOpen() bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.isOpen
+}
+
+// tx sends a single fragment to the server.
+func (s *LoopbackSesn) tx(b []byte) error {
+	s.m.Lock()
+	c2s := s.c2s
+	isOpen := s.isOpen
+	s.m.Unlock()
+
+	if !isOpen || !c2s.send(b) {
+		return nmxutil.NewSesnClosedError(
+			"Attempt to transmit over closed loopback session")
+	}
+
+	return nil
+}
+
+func (s *LoopbackSesn) MtuIn() int {
+	return s.lx.cfg.Mtu
+}
+
+func (s *LoopbackSesn) MtuOut() int {
+	return s.lx.cfg.Mtu
+}
+
+func (s *LoopbackSesn) TxRxMgmt(m *nmp.NmpMsg,
+	timeout time.Duration) (nmp.NmpRsp, error) {
+
+	if !s.IsOpen() {
+		return nil, nmxutil.NewSesnClosedError(
+			"Attempt to transmit over closed loopback session")
+	}
+
+	return s.txvr.TxRxMgmt(s.tx, m, s.MtuOut(), timeout)
+}
+
+func (s *LoopbackSesn) TxRxMgmtAsync(m *nmp.NmpMsg,
+	timeout time.Duration, ch chan nmp.NmpRsp, errc chan error) error {
+
+	if !s.IsOpen() {
+		return nmxutil.NewSesnClosedError(
+			"Attempt to transmit over closed loopback session")
+	}
+
+	return s.txvr.TxRxMgmtAsync(s.tx, m, s.MtuOut(), timeout, ch, errc)
+}
+
+func (s *LoopbackSesn) AbortRx(seq uint8) error {
+	s.txvr.AbortRx(seq)
+	return nil
+}
+
+func (s *LoopbackSesn) TxCoap(m coap.Message) error {
+	return s.txvr.TxCoap(s.tx, m, s.MtuOut())
+}
+
+func (s *LoopbackSesn) MgmtProto() sesn.MgmtProto {
+	return s.cfg.MgmtProto
+}
+
+func (s *LoopbackSesn) ListenCoap(
+	mc nmcoap.MsgCriteria) (*nmcoap.Listener, error) {
+
+	return s.txvr.ListenCoap(mc)
+}
+
+func (s *LoopbackSesn) StopListenCoap(mc nmcoap.MsgCriteria) {
+	s.txvr.StopListenCoap(mc)
+}
+
+func (s *LoopbackSesn) CoapIsTcp() bool {
+	return s.lx.cfg.CoapIsTcp
+}
+
+func (s *LoopbackSesn) RxAccept() (sesn.Sesn, *sesn.SesnCfg, error) {
+	return nil, nil, fmt.Errorf("Op not implemented yet")
+}
+
+func (s *LoopbackSesn) RxCoap(opt sesn.TxOptions) (coap.Message, error) {
+	return nil, fmt.Errorf("Op not implemented yet")
+}
+
+func (s *LoopbackSesn) Filters() (nmcoap.TxMsgFilter, nmcoap.RxMsgFilter) {
+	return s.txvr.Filters()
+}
+
+func (s *LoopbackSesn) SetFilters(txFilter nmcoap.TxMsgFilter,
+	rxFilter nmcoap.RxMsgFilter) {
+
+	s.txvr.SetFilters(txFilter, rxFilter)
+}
@@ -0,0 +1,294 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package loopback_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"mynewt.apache.org/newtmgr/nmxact/loopback"
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/nmsim"
+	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
+	"mynewt.apache.org/newtmgr/nmxact/xact"
+)
+
+func TestMain(m *testing.M) {
+	// The listener log is verbose by default.
+	nmxutil.SetLogLevel(log.WarnLevel)
+	os.Exit(m.Run())
+}
+
+type sesnTest struct {
+	name      string
+	proto     sesn.MgmtProto
+	coapIsTcp bool
+}
+
+var sesnTests = []sesnTest{
+	{"nmp", sesn.MGMT_PROTO_NMP, false},
+	{"omp", sesn.MGMT_PROTO_OMP, false},
+	{"omp-tcp", sesn.MGMT_PROTO_OMP, true},
+}
+
+// openSesn opens a loopback session to a simulated device.
+func openSesn(t *testing.T, st sesnTest,
+	cfg *nmsim.XportCfg) sesn.Sesn {
+
+	t.Helper()
+
+	cfg.CoapIsTcp = st.coapIsTcp
+
+	x := nmsim.NewSimXport(cfg)
+	if err := x.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { x.Stop() })
+
+	sc := sesn.NewSesnCfg()
+	sc.MgmtProto = st.proto
+
+	s, err := x.BuildSesn(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.(*loopback.LoopbackSesn); !ok {
+		t.Fatalf("simulator built a %T; want a loopback session", s)
+	}
+	if s.CoapIsTcp() != st.coapIsTcp {
+		t.Fatalf("CoapIsTcp=%v; want %v", s.CoapIsTcp(), st.coapIsTcp)
+	}
+
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if s.IsOpen() {
+			s.Close()
+		}
+	})
+
+	return s
+}
+
+func echo(s sesn.Sesn, payload string, opt sesn.TxOptions) error {
+	c := xact.NewEchoCmd()
+	c.SetTxOptions(opt)
+	c.Payload = payload
+
+	res, err := c.Run(s)
+	if err != nil {
+		return err
+	}
+
+	if got := res.(*xact.EchoResult).Rsp.Payload; got != payload {
+		return fmt.Errorf("echoed %q; want %q", got, payload)
+	}
+
+	return nil
+}
+
+// Requests and responses survive duplication, reordering, and latency in
+// both directions.
+func TestSesnImpaired(t *testing.T) {
+	link := loopback.LinkCfg{
+		Latency:     time.Millisecond,
+		ReorderRate: 0.2,
+		DupRate:     0.2,
+	}
+
+	for _, st := range sesnTests {
+		st := st
+		t.Run(st.name, func(t *testing.T) {
+			cfg := nmsim.NewXportCfg()
+			cfg.Tx = link
+			cfg.Rx = link
+			cfg.Seed = 7
+
+			s := openSesn(t, st, cfg)
+			opt := sesn.TxOptions{Timeout: 2 * time.Second, Tries: 1}
+
+			for i := 0; i < 50; i++ {
+				if err := echo(s, fmt.Sprintf("msg %d", i), opt); err != nil {
+					t.Fatalf("echo %d failed: %s", i, err.Error())
+				}
+			}
+		})
+	}
+}
+
+// A lost request times out and is retried; the retry succeeds.
+func TestSesnLossRetry(t *testing.T) {
+	for _, st := range sesnTests {
+		st := st
+		t.Run(st.name, func(t *testing.T) {
+			cfg := nmsim.NewXportCfg()
+			cfg.Tx = loopback.LinkCfg{LossRate: 0.3}
+			cfg.Seed = 3
+
+			s := openSesn(t, st, cfg)
+			opt := sesn.TxOptions{
+				Timeout: 50 * time.Millisecond,
+				Tries:   10,
+			}
+
+			for i := 0; i < 20; i++ {
+				if err := echo(s, fmt.Sprintf("msg %d", i), opt); err != nil {
+					t.Fatalf("echo %d failed: %s", i, err.Error())
+				}
+			}
+		})
+	}
+}
+
+// Closing the session fails requests rather than leaving them pending.
+func TestSesnClosed(t *testing.T) {
+	for _, st := range sesnTests {
+		st := st
+		t.Run(st.name, func(t *testing.T) {
+			s := openSesn(t, st, nmsim.NewXportCfg())
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			err := echo(s, "hello", sesn.NewTxOptions())
+			if !nmxutil.IsSesnClosed(err) {
+				t.Fatalf("echo over closed session: err=%v", err)
+			}
+		})
+	}
+}
+
+// A windowed image upload completes over a link that loses requests and
+// responses, including the tail of the upload.
+func TestImageUploadLossy(t *testing.T) {
+	for _, st := range sesnTests {
+		st := st
+		t.Run(st.name, func(t *testing.T) {
+			for seed := int64(1); seed <= 3; seed++ {
+				cfg := nmsim.NewXportCfg()
+				cfg.Device = nmsim.NewDevice()
+				cfg.Tx = loopback.LinkCfg{LossRate: 0.1}
+				cfg.Rx = loopback.LinkCfg{LossRate: 0.1}
+				cfg.Seed = seed
+
+				s := openSesn(t, st, cfg)
+
+				body := make([]byte, 8000)
+				for i := range body {
+					body[i] = byte(i)
+				}
+				img := nmsim.BuildImage(nmsim.ImageVersion{Major: 2}, body)
+
+				c := xact.NewImageUploadCmd()
+				c.SetTxOptions(sesn.TxOptions{
+					Timeout: 50 * time.Millisecond,
+					Tries:   1,
+				})
+				c.Data = img
+				c.MaxWinSz = xact.IMAGE_UPLOAD_DEF_MAX_WS
+
+				done := make(chan error, 1)
+				go func() {
+					_, err := c.Run(s)
+					done <- err
+				}()
+
+				select {
+				case err := <-done:
+					if err != nil {
+						t.Fatalf("seed %d: upload failed: %s",
+							seed, err.Error())
+					}
+				case <-time.After(20 * time.Second):
+					t.Fatalf("seed %d: upload hung", seed)
+				}
+
+				if !bytes.Equal(cfg.Device.Image(1), img) {
+					t.Fatalf("seed %d: slot 1 doesn't contain the "+
+						"uploaded image", seed)
+				}
+			}
+		})
+	}
+}
+
+// The device's status code is reported rather than retried forever.
+func TestImageUploadRejected(t *testing.T) {
+	for _, st := range sesnTests {
+		st := st
+		t.Run(st.name, func(t *testing.T) {
+			cfg := nmsim.NewXportCfg()
+			cfg.Device = nmsim.NewDevice()
+			s := openSesn(t, st, cfg)
+
+			img := nmsim.BuildImage(nmsim.ImageVersion{Major: 2},
+				make([]byte, 2000))
+
+			c := xact.NewImageUploadCmd()
+			c.SetTxOptions(sesn.TxOptions{Timeout: time.Second, Tries: 1})
+			c.Data = img
+			c.ImageNum = 1
+			c.MaxWinSz = xact.IMAGE_UPLOAD_DEF_MAX_WS
+
+			res, err := c.Run(s)
+			rc := 0
+			if gerr := nmp.ToNmpGroup(err); gerr != nil {
+				rc = gerr.Rc
+			} else if err != nil {
+				t.Fatalf("upload failed: %s", err.Error())
+			} else {
+				rc = res.Status()
+			}
+			if rc != nmp.NMP_ERR_EINVAL {
+				t.Fatalf("upload status=%d; want %d",
+					rc, nmp.NMP_ERR_EINVAL)
+			}
+		})
+	}
+}
+
+// A request that can't be sent fails the upload with the transmit error.
+func TestImageUploadClosed(t *testing.T) {
+	for _, st := range sesnTests {
+		st := st
+		t.Run(st.name, func(t *testing.T) {
+			s := openSesn(t, st, nmsim.NewXportCfg())
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			c := xact.NewImageUploadCmd()
+			c.SetTxOptions(sesn.TxOptions{Timeout: time.Second, Tries: 1})
+			c.Data = nmsim.BuildImage(nmsim.ImageVersion{Major: 2},
+				make([]byte, 2000))
+
+			if _, err := c.Run(s); !nmxutil.IsSesnClosed(err) {
+				t.Fatalf("upload over closed session: err=%v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package loopback implements a transport that connects client sessions to
+// an in-process server over Go channels.  The link between the two ends can
+// be configured to drop, delay, reorder, and duplicate data, making it
+// possible to reproduce problems seen on unreliable links.
+package loopback
+
+import (
+	"fmt"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
+)
+
+// Handler is the server end of a loopback connection.  Rx is called with
+// each fragment that crosses the link; it returns the (possibly empty) list
+// of messages to send back to the client.
+type Handler interface {
+	Rx(data []byte) [][]byte
+}
+
+// HandlerFactory creates the server end of a new connection.  isTcp
+// indicates whether OMP traffic uses the TCP encoding of CoAP.
+type HandlerFactory func(proto sesn.MgmtProto, isTcp bool) Handler
+
+type XportCfg struct {
+	// Creates the server end of each session.
+	NewHandler HandlerFactory
+
+	// Maximum size of a fragment in either direction.
+	Mtu int
+
+	// Whether OMP sessions use the TCP encoding of CoAP.  If false, the
+	// datagram encoding is used.
+	CoapIsTcp bool
+
+	// Impairments applied to data sent by the client (Tx) and by the
+	// server (Rx).
+	Tx LinkCfg
+	Rx LinkCfg
+
+	// Seeds the random number generators that decide which fragments get
+	// impaired.  Each session uses the same seed, so a session's
+	// impairments are reproducible.
+	Seed int64
+}
+
+func NewXportCfg() *XportCfg {
+	return &XportCfg{
+		Mtu: 512,
+	}
+}
+
+type LoopbackXport struct {
+	cfg     *XportCfg
+	started bool
+}
+
+func NewLoopbackXport(cfg *XportCfg) *LoopbackXport {
+	return &LoopbackXport{
+		cfg: cfg,
+	}
+}
+
+func (lx *LoopbackXport) BuildSesn(cfg sesn.SesnCfg) (sesn.Sesn, error) {
+	return NewLoopbackSesn(lx, cfg)
+}
+
+func (lx *LoopbackXport) Start() error {
+	if lx.started {
+		return nmxutil.NewXportError("Loopback xport started twice")
+	}
+	lx.started = true
+	return nil
+}
+
+func (lx *LoopbackXport) Stop() error {
+	if !lx.started {
+		return nmxutil.NewXportError("Loopback xport stopped twice")
+	}
+	lx.started = false
+	return nil
+}
+
+func (lx *LoopbackXport) Tx(bytes []byte) error {
+	return fmt.Errorf("unsupported")
+}
@@ -50,6 +50,12 @@ type Transceiver struct {
 	isTcp bool
 	proto sesn.MgmtProto
 	wg    sync.WaitGroup
+
+	// The NMP protocol version supported by the peer; only valid if
+	// peerVerKnown is true.
+	peerVer      uint8
+	peerVerKnown bool
+	verMtx       sync.Mutex
 }
 
 func NewTransceiver(txFilter nmcoap.TxMsgFilter, rxFilter nmcoap.RxMsgFilter, isTcp bool,
@@ -147,7 +153,11 @@ func (t *Transceiver) txRxNmpAsync(txCb TxFn, req *nmp.NmpMsg, mtu int,
 				errc <- err
 				return
 			case rsp := <-nl.RspChan:
-				ch <- rsp
+				if err := t.rxRspAsync(req, rsp); err != nil {
+					errc <- err
+				} else {
+					ch <- rsp
+				}
 				return
 			case _, ok := <-nl.AfterTimeout(timeout):
 				if ok {
@@ -251,7 +261,11 @@ func (t *Transceiver) txRxOmpAsync(txCb TxFn, req *nmp.NmpMsg, mtu int,
 				errc <- err
 				return
 			case rsp := <-nl.RspChan:
-				ch <- rsp
+				if err := t.rxRspAsync(req, rsp); err != nil {
+					errc <- err
+				} else {
+					ch <- rsp
+				}
 				return
 			case _, ok := <-nl.AfterTimeout(timeout):
 				if ok {
@@ -264,7 +278,83 @@ func (t *Transceiver) txRxOmpAsync(txCb TxFn, req *nmp.NmpMsg, mtu int,
 	return nil
 }
 
-func (t *Transceiver) TxRxMgmt(txCb TxFn, req *nmp.NmpMsg, mtu int,
+// applyPeerVer downgrades a request to the protocol version supported by the
+// peer, if known.
+func (t *Transceiver) applyPeerVer(req *nmp.NmpMsg) {
+	t.verMtx.Lock()
+	defer t.verMtx.Unlock()
+
+	if t.peerVerKnown && req.Hdr.Version > t.peerVer {
+		req.Hdr.Version = t.peerVer
+	}
+}
+
+func (t *Transceiver) setPeerVer(ver uint8) {
+	t.verMtx.Lock()
+	defer t.verMtx.Unlock()
+
+	if !t.peerVerKnown || ver < t.peerVer {
+		log.Debugf("Peer supports NMP version %d", ver+1)
+	}
+	t.peerVer = ver
+	t.peerVerKnown = true
+}
+
+// rxRsp processes a response to a request.  It records the protocol version
+// that the peer supports and converts a group error into a Go error.  The
+// returned bool indicates whether the peer rejected the request because of
+// its protocol version, in which case it should be resent as version 1.
+func (t *Transceiver) rxRsp(req *nmp.NmpMsg, rsp nmp.NmpRsp) (bool, error) {
+	if req.Hdr.Version >= nmp.NMP_VER_2 {
+		rcErr := nmp.ToNmpRc(rsp.RspErr())
+
+		switch {
+		case rsp.Hdr().Version < nmp.NMP_VER_2:
+			// Only a version 1 peer responds to a version 2 request with a
+			// version 1 header.  Such a peer may have misinterpreted the
+			// version bits, so a failed request is resent as version 1.
+			t.setPeerVer(nmp.NMP_VER_1)
+			if rcErr != nil {
+				return true, nil
+			}
+
+		case rcErr != nil && rcErr.Rc == nmp.NMP_ERR_UNSUPPORTED_TOO_NEW:
+			t.setPeerVer(nmp.NMP_VER_1)
+			return true, nil
+
+		default:
+			// Any other failure is a genuine rejection of the request;
+			// resending it would repeat a write the device refused.
+			t.setPeerVer(rsp.Hdr().Version)
+		}
+	}
+
+	if gerr := nmp.ToNmpGroup(rsp.RspErr()); gerr != nil {
+		return false, gerr
+	}
+
+	return false, nil
+}
+
+// rxRspAsync processes a response to an asynchronous request.  Such a request
+// cannot be resent here, so a version rejection is reported as an error; the
+// caller's next attempt uses version 1.
+func (t *Transceiver) rxRspAsync(req *nmp.NmpMsg, rsp nmp.NmpRsp) error {
+	retry, err := t.rxRsp(req, rsp)
+	if err != nil {
+		return err
+	}
+
+	if retry {
+		t.setPeerVer(nmp.NMP_VER_1)
+		return fmt.Errorf("Peer rejected NMP version %d request",
+			req.Hdr.Version+1)
+	}
+
+	return nil
+}
+
+func (t *Transceiver) txRxMgmtOnce(txCb TxFn, req *nmp.NmpMsg, mtu int,
 	timeout time.Duration) (nmp.NmpRsp, error) {
 
 	if t.nd != nil {
@@ -274,9 +364,52 @@ func (t *Transceiver) TxRxMgmt(txCb TxFn, req *nmp.NmpMsg, mtu int,
 	}
 }
 
+func (t *Transceiver) TxRxMgmt(txCb TxFn, req *nmp.NmpMsg, mtu int,
+	timeout time.Duration) (nmp.NmpRsp, error) {
+
+	t.applyPeerVer(req)
+
+	rsp, err := t.txRxMgmtOnce(txCb, req, mtu, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	retry, err := t.rxRsp(req, rsp)
+	if err != nil {
+		return nil, err
+	}
+	if !retry {
+		return rsp, nil
+	}
+
+	log.Debugf("Peer rejected NMP version %d request; retrying with "+
+		"version 1", req.Hdr.Version+1)
+	req.Hdr.Version = nmp.NMP_VER_1
+	req.Hdr.Seq = nmxutil.NextNmpSeq()
+
+	rsp, err = t.txRxMgmtOnce(txCb, req, mtu, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// If the peer accepts the version 1 request, it does not support
+	// version 2.
+	if rsp.RspErr() == nil {
+		t.setPeerVer(nmp.NMP_VER_1)
+	}
+
+	return rsp, nil
+}
+
+// TxRxMgmtAsync sends a request without waiting for the response.  Unlike
+// TxRxMgmt, it does not resend a request that the peer rejects because of its
+// protocol version; the rejection is reported via errc and subsequent
+// requests use version 1.
 func (t *Transceiver) TxRxMgmtAsync(txCb TxFn, req *nmp.NmpMsg, mtu int,
 	timeout time.Duration, ch chan nmp.NmpRsp, errc chan error) error {
 
+	t.applyPeerVer(req)
+
 	if t.nd != nil {
 		return t.txRxNmpAsync(txCb, req, mtu, timeout, ch, errc)
 	} else {
@@ -120,7 +120,13 @@ func (d *Dispatcher) Dispatch(data []byte) bool {
 		return false
 	}
 
-	lner.RspChan <- msg
+	// Drop duplicates rather than block the receive path on a listener that
+	// has not consumed its previous message yet.
+	select {
+	case lner.RspChan <- msg:
+	default:
+		log.Debugf("dropping duplicate CoAP message: %s", mc.String())
+	}
 	return true
 }
 
@@ -0,0 +1,398 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package nmimage parses Mynewt (MCUboot) image files.
+package nmimage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// $defs                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+const IMAGE_HEADER_MAGIC = 0x96f3b83d
+const IMAGE_HEADER_SIZE = 32
+
+const IMAGE_TLV_INFO_MAGIC = 0x6907
+const IMAGE_TLV_PROT_INFO_MAGIC = 0x6908
+const IMAGE_TLV_INFO_SIZE = 4
+const IMAGE_TLV_HDR_SIZE = 4
+
+// Image header flags.
+const (
+	IMAGE_F_PIC              = 0x00000001
+	IMAGE_F_ENCRYPTED_AES128 = 0x00000004
+	IMAGE_F_ENCRYPTED_AES256 = 0x00000008
+	IMAGE_F_NON_BOOTABLE     = 0x00000010
+	IMAGE_F_RAM_LOAD         = 0x00000020
+)
+
+// Image trailer TLV types.
+const (
+	IMAGE_TLV_KEYHASH    = 0x01
+	IMAGE_TLV_PUBKEY     = 0x02
+	IMAGE_TLV_SHA256     = 0x10
+	IMAGE_TLV_RSA2048    = 0x20
+	IMAGE_TLV_ECDSA224   = 0x21
+	IMAGE_TLV_ECDSA256   = 0x22
+	IMAGE_TLV_RSA3072    = 0x23
+	IMAGE_TLV_ED25519    = 0x24
+	IMAGE_TLV_ENC_RSA    = 0x30
+	IMAGE_TLV_ENC_KEK    = 0x31
+	IMAGE_TLV_ENC_EC256  = 0x32
+	IMAGE_TLV_DEPENDENCY = 0x40
+	IMAGE_TLV_SEC_CNT    = 0x50
+)
+
+var imageFlagNameMap = map[uint32]string{
+	IMAGE_F_PIC:              "pic",
+	IMAGE_F_ENCRYPTED_AES128: "encrypted-aes128",
+	IMAGE_F_ENCRYPTED_AES256: "encrypted-aes256",
+	IMAGE_F_NON_BOOTABLE:     "non-bootable",
+	IMAGE_F_RAM_LOAD:         "ram-load",
+}
+
+var imageTlvTypeNameMap = map[uint8]string{
+	IMAGE_TLV_KEYHASH:    "KEYHASH",
+	IMAGE_TLV_PUBKEY:     "PUBKEY",
+	IMAGE_TLV_SHA256:     "SHA256",
+	IMAGE_TLV_RSA2048:    "RSA2048",
+	IMAGE_TLV_ECDSA224:   "ECDSA224",
+	IMAGE_TLV_ECDSA256:   "ECDSA256",
+	IMAGE_TLV_RSA3072:    "RSA3072",
+	IMAGE_TLV_ED25519:    "ED25519",
+	IMAGE_TLV_ENC_RSA:    "ENC_RSA",
+	IMAGE_TLV_ENC_KEK:    "ENC_KEK",
+	IMAGE_TLV_ENC_EC256:  "ENC_EC256",
+	IMAGE_TLV_DEPENDENCY: "DEPENDENCY",
+	IMAGE_TLV_SEC_CNT:    "SEC_CNT",
+}
+
+type ImageVersion struct {
+	Major    uint8
+	Minor    uint8
+	Rev      uint16
+	BuildNum uint32
+}
+
+type ImageHdr struct {
+	Magic    uint32
+	LoadAddr uint32
+	HdrSz    uint16
+	ProtSz   uint16 /* Size of protected TLV area */
+	ImgSz    uint32
+	Flags    uint32
+	Vers     ImageVersion
+	Pad      uint32
+}
+
+type ImageTlv struct {
+	Type      uint8
+	Protected bool
+	Data      []byte
+}
+
+type Image struct {
+	Header ImageHdr
+	Body   []byte
+	Tlvs   []ImageTlv
+
+	// The number of bytes following the TLV area.  Tools such as
+	// "imgtool --pad" fill the rest of the slot, including the image
+	// trailer, with padding.
+	PadSz int
+
+	// The portion of the image covered by the hash: the header, body, and
+	// protected TLVs.
+	hashed []byte
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $version                                                                 //
+//////////////////////////////////////////////////////////////////////////////
+
+func (v ImageVersion) String() string {
+	if v.BuildNum == 0 {
+		return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Rev)
+	}
+	return fmt.Sprintf("%d.%d.%d.%d", v.Major, v.Minor, v.Rev, v.BuildNum)
+}
+
+// Compare returns -1, 0, or 1 if v is less than, equal to, or greater than
+// o, respectively.
+func (v ImageVersion) Compare(o ImageVersion) int {
+	a := []uint64{uint64(v.Major), uint64(v.Minor), uint64(v.Rev),
+		uint64(v.BuildNum)}
+	b := []uint64{uint64(o.Major), uint64(o.Minor), uint64(o.Rev),
+		uint64(o.BuildNum)}
+
+	for i := range a {
+		if a[i] < b[i] {
+			return -1
+		} else if a[i] > b[i] {
+			return 1
+		}
+	}
+	return 0
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $names                                                                   //
+//////////////////////////////////////////////////////////////////////////////
+
+// ImageTlvTypeName returns the name of a TLV type (e.g., "SHA256").
+func ImageTlvTypeName(typ uint8) string {
+	if name, ok := imageTlvTypeNameMap[typ]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("0x%02x", typ)
+}
+
+// ImageFlagsString returns a comma-separated list of the names of the
+// specified header flags.
+func ImageFlagsString(flags uint32) string {
+	var names []string
+	for bit := uint32(1); bit != 0; bit <<= 1 {
+		if flags&bit == 0 {
+			continue
+		}
+
+		if name, ok := imageFlagNameMap[bit]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, fmt.Sprintf("0x%08x", bit))
+		}
+	}
+
+	return strings.Join(names, ",")
+}
+
+// IsSigTlv indicates whether a TLV type is a signature.
+func IsSigTlv(typ uint8) bool {
+	switch typ {
+	case IMAGE_TLV_RSA2048, IMAGE_TLV_ECDSA224, IMAGE_TLV_ECDSA256,
+		IMAGE_TLV_RSA3072, IMAGE_TLV_ED25519:
+
+		return true
+	default:
+		return false
+	}
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $parse                                                                   //
+//////////////////////////////////////////////////////////////////////////////
+
+// ParseImageHdr decodes an image header.
+func ParseImageHdr(data []byte) (ImageHdr, error) {
+	if len(data) < IMAGE_HEADER_SIZE {
+		return ImageHdr{}, fmt.Errorf(
+			"image too small to contain header: %d bytes", len(data))
+	}
+
+	hdr := ImageHdr{
+		Magic:    binary.LittleEndian.Uint32(data[0:]),
+		LoadAddr: binary.LittleEndian.Uint32(data[4:]),
+		HdrSz:    binary.LittleEndian.Uint16(data[8:]),
+		ProtSz:   binary.LittleEndian.Uint16(data[10:]),
+		ImgSz:    binary.LittleEndian.Uint32(data[12:]),
+		Flags:    binary.LittleEndian.Uint32(data[16:]),
+		Vers: ImageVersion{
+			Major:    data[20],
+			Minor:    data[21],
+			Rev:      binary.LittleEndian.Uint16(data[22:]),
+			BuildNum: binary.LittleEndian.Uint32(data[24:]),
+		},
+		Pad: binary.LittleEndian.Uint32(data[28:]),
+	}
+
+	if hdr.Magic != IMAGE_HEADER_MAGIC {
+		return ImageHdr{}, fmt.Errorf("invalid image magic: 0x%08x",
+			hdr.Magic)
+	}
+	if hdr.HdrSz < IMAGE_HEADER_SIZE {
+		return ImageHdr{}, fmt.Errorf("invalid image header size: %d",
+			hdr.HdrSz)
+	}
+
+	return hdr, nil
+}
+
+// parseTlvArea decodes the TLV area beginning at the specified offset.  It
+// returns the TLVs and the offset of the end of the area.
+func parseTlvArea(data []byte, off int, magic uint16,
+	protected bool) ([]ImageTlv, int, error) {
+
+	what := "TLV"
+	if protected {
+		what = "protected TLV"
+	}
+
+	if off+IMAGE_TLV_INFO_SIZE > len(data) {
+		return nil, 0, fmt.Errorf("image truncated: missing %s info", what)
+	}
+
+	m := binary.LittleEndian.Uint16(data[off:])
+	if m != magic {
+		return nil, 0, fmt.Errorf("invalid %s info magic: 0x%04x", what, m)
+	}
+
+	end := off + int(binary.LittleEndian.Uint16(data[off+2:]))
+	if end > len(data) {
+		return nil, 0, fmt.Errorf("image truncated: %s area extends to "+
+			"offset %d; image is %d bytes", what, end, len(data))
+	}
+
+	var tlvs []ImageTlv
+	for off += IMAGE_TLV_INFO_SIZE; off < end; {
+		if off+IMAGE_TLV_HDR_SIZE > end {
+			return nil, 0, fmt.Errorf("truncated %s at offset %d", what, off)
+		}
+
+		typ := data[off]
+		l := int(binary.LittleEndian.Uint16(data[off+2:]))
+		off += IMAGE_TLV_HDR_SIZE
+
+		if off+l > end {
+			return nil, 0, fmt.Errorf("truncated %s at offset %d", what,
+				off-IMAGE_TLV_HDR_SIZE)
+		}
+
+		tlvs = append(tlvs, ImageTlv{
+			Type:      typ,
+			Protected: protected,
+			Data:      data[off : off+l],
+		})
+		off += l
+	}
+
+	return tlvs, end, nil
+}
+
+// ParseImage decodes an image file and checks its structure.  Any bytes
+// following the TLV area are treated as padding.  It does not verify the
+// image hash; see Image.VerifyHash.
+func ParseImage(data []byte) (*Image, error) {
+	hdr, err := ParseImageHdr(data)
+	if err != nil {
+		return nil, err
+	}
+
+	bodyEnd := int(hdr.HdrSz) + int(hdr.ImgSz)
+	if bodyEnd > len(data) {
+		return nil, fmt.Errorf("image truncated: header indicates %d "+
+			"bytes of header and body; image is %d bytes",
+			bodyEnd, len(data))
+	}
+
+	img := &Image{
+		Header: hdr,
+		Body:   data[hdr.HdrSz:bodyEnd],
+	}
+
+	off := bodyEnd
+	if hdr.ProtSz > 0 {
+		tlvs, end, err := parseTlvArea(data, off,
+			IMAGE_TLV_PROT_INFO_MAGIC, true)
+		if err != nil {
+			return nil, err
+		}
+		if end != off+int(hdr.ProtSz) {
+			return nil, fmt.Errorf("protected TLV area size mismatch: "+
+				"header=%d trailer=%d", hdr.ProtSz, end-off)
+		}
+
+		img.Tlvs = append(img.Tlvs, tlvs...)
+		off = end
+	}
+	img.hashed = data[:off]
+
+	tlvs, end, err := parseTlvArea(data, off, IMAGE_TLV_INFO_MAGIC, false)
+	if err != nil {
+		return nil, err
+	}
+	img.Tlvs = append(img.Tlvs, tlvs...)
+	img.PadSz = len(data) - end
+
+	return img, nil
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $image                                                                   //
+//////////////////////////////////////////////////////////////////////////////
+
+// FindTlvs returns all of the image's TLVs of the specified type.
+func (img *Image) FindTlvs(typ uint8) []ImageTlv {
+	var tlvs []ImageTlv
+	for _, t := range img.Tlvs {
+		if t.Type == typ {
+			tlvs = append(tlvs, t)
+		}
+	}
+
+	return tlvs
+}
+
+// Hash returns the contents of the image's SHA256 TLV.
+func (img *Image) Hash() ([]byte, error) {
+	tlvs := img.FindTlvs(IMAGE_TLV_SHA256)
+	if len(tlvs) == 0 {
+		return nil, fmt.Errorf("image does not contain a SHA256 TLV")
+	}
+	if len(tlvs) > 1 {
+		return nil, fmt.Errorf("image contains %d SHA256 TLVs", len(tlvs))
+	}
+
+	return tlvs[0].Data, nil
+}
+
+// CalcHash computes the SHA256 of the hashed portion of the image.
+func (img *Image) CalcHash() []byte {
+	hash := sha256.Sum256(img.hashed)
+	return hash[:]
+}
+
+// HashedData returns the portion of the image covered by its hash and
+// signatures.
+func (img *Image) HashedData() []byte {
+	return img.hashed
+}
+
+// VerifyHash checks that the image's SHA256 TLV matches its contents.
+func (img *Image) VerifyHash() error {
+	hash, err := img.Hash()
+	if err != nil {
+		return err
+	}
+
+	calc := img.CalcHash()
+	if !bytes.Equal(hash, calc) {
+		return fmt.Errorf("image hash mismatch: trailer=%x calculated=%x",
+			hash, calc)
+	}
+
+	return nil
+}
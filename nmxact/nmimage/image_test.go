@@ -0,0 +1,276 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmimage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// testImage describes an image to construct.
+type testImage struct {
+	hdrSz    int
+	vers     ImageVersion
+	flags    uint32
+	body     []byte
+	protTlvs []ImageTlv
+
+	// Trailer TLVs in addition to the SHA256 TLV.
+	tlvs []ImageTlv
+}
+
+func encodeTlvArea(magic uint16, tlvs []ImageTlv) []byte {
+	b := make([]byte, IMAGE_TLV_INFO_SIZE)
+	for _, t := range tlvs {
+		hdr := make([]byte, IMAGE_TLV_HDR_SIZE)
+		hdr[0] = t.Type
+		binary.LittleEndian.PutUint16(hdr[2:], uint16(len(t.Data)))
+		b = append(b, hdr...)
+		b = append(b, t.Data...)
+	}
+
+	binary.LittleEndian.PutUint16(b[0:], magic)
+	binary.LittleEndian.PutUint16(b[2:], uint16(len(b)))
+
+	return b
+}
+
+// build encodes the image and appends a correct SHA256 TLV.
+func (ti testImage) build() []byte {
+	hdrSz := ti.hdrSz
+	if hdrSz == 0 {
+		hdrSz = IMAGE_HEADER_SIZE
+	}
+
+	var prot []byte
+	if len(ti.protTlvs) > 0 {
+		prot = encodeTlvArea(IMAGE_TLV_PROT_INFO_MAGIC, ti.protTlvs)
+	}
+
+	hdr := make([]byte, hdrSz)
+	binary.LittleEndian.PutUint32(hdr[0:], IMAGE_HEADER_MAGIC)
+	binary.LittleEndian.PutUint16(hdr[8:], uint16(hdrSz))
+	binary.LittleEndian.PutUint16(hdr[10:], uint16(len(prot)))
+	binary.LittleEndian.PutUint32(hdr[12:], uint32(len(ti.body)))
+	binary.LittleEndian.PutUint32(hdr[16:], ti.flags)
+	hdr[20] = ti.vers.Major
+	hdr[21] = ti.vers.Minor
+	binary.LittleEndian.PutUint16(hdr[22:], ti.vers.Rev)
+	binary.LittleEndian.PutUint32(hdr[24:], ti.vers.BuildNum)
+
+	data := append(hdr, ti.body...)
+	data = append(data, prot...)
+
+	hash := sha256.Sum256(data)
+	tlvs := append([]ImageTlv{{Type: IMAGE_TLV_SHA256, Data: hash[:]}},
+		ti.tlvs...)
+
+	return append(data, encodeTlvArea(IMAGE_TLV_INFO_MAGIC, tlvs)...)
+}
+
+func TestParseImage(t *testing.T) {
+	body := []byte("image body")
+	keyHash := bytes.Repeat([]byte{0xab}, 32)
+
+	tests := []struct {
+		name   string
+		img    testImage
+		pad    int
+		prot   int
+		trlr   int
+		hdrVer string
+	}{
+		{"minimal", testImage{
+			vers: ImageVersion{1, 2, 3, 0},
+			body: body,
+		}, 0, 0, 1, "1.2.3"},
+		{"large header", testImage{
+			hdrSz: 0x200,
+			vers:  ImageVersion{1, 2, 3, 4},
+			body:  body,
+		}, 0, 0, 1, "1.2.3.4"},
+		{"protected TLVs", testImage{
+			body: body,
+			protTlvs: []ImageTlv{
+				{Type: IMAGE_TLV_SEC_CNT, Data: []byte{1, 0, 0, 0}},
+			},
+		}, 0, 1, 1, "0.0.0"},
+		{"key hash", testImage{
+			body: body,
+			tlvs: []ImageTlv{{Type: IMAGE_TLV_KEYHASH, Data: keyHash}},
+		}, 0, 0, 2, "0.0.0"},
+		{"padded", testImage{
+			body: body,
+		}, 4096, 0, 1, "0.0.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.img.build()
+			data = append(data, bytes.Repeat([]byte{0xff}, tt.pad)...)
+
+			img, err := ParseImage(data)
+			if err != nil {
+				t.Fatalf("parse failed: %s", err.Error())
+			}
+
+			if s := img.Header.Vers.String(); s != tt.hdrVer {
+				t.Fatalf("version %s; want %s", s, tt.hdrVer)
+			}
+			if !bytes.Equal(img.Body, body) {
+				t.Fatalf("body mismatch: %q", img.Body)
+			}
+			if img.PadSz != tt.pad {
+				t.Fatalf("padding %d; want %d", img.PadSz, tt.pad)
+			}
+
+			prot := 0
+			for _, tlv := range img.Tlvs {
+				if tlv.Protected {
+					prot++
+				}
+			}
+			if prot != tt.prot || len(img.Tlvs)-prot != tt.trlr {
+				t.Fatalf("got %d protected, %d other TLVs; want %d, %d",
+					prot, len(img.Tlvs)-prot, tt.prot, tt.trlr)
+			}
+
+			if err := img.VerifyHash(); err != nil {
+				t.Fatalf("hash verification failed: %s", err.Error())
+			}
+		})
+	}
+}
+
+func TestParseImageMalformed(t *testing.T) {
+	good := testImage{body: []byte("image body")}.build()
+	bodyEnd := IMAGE_HEADER_SIZE + len("image body")
+
+	// Returns a copy of the good image modified by fn.
+	mod := func(fn func(b []byte) []byte) []byte {
+		return fn(append([]byte(nil), good...))
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"empty", nil, "too small"},
+		{"short header", good[:IMAGE_HEADER_SIZE-1], "too small"},
+		{"bad magic", mod(func(b []byte) []byte {
+			b[0] ^= 0xff
+			return b
+		}), "invalid image magic"},
+		{"small header size", mod(func(b []byte) []byte {
+			binary.LittleEndian.PutUint16(b[8:], IMAGE_HEADER_SIZE-1)
+			return b
+		}), "invalid image header size"},
+		{"truncated body", good[:bodyEnd-1], "image truncated"},
+		{"missing TLVs", good[:bodyEnd], "missing TLV info"},
+		{"bad TLV magic", mod(func(b []byte) []byte {
+			b[bodyEnd] ^= 0xff
+			return b
+		}), "invalid TLV info magic"},
+		{"truncated TLV area", good[:len(good)-1], "TLV area extends"},
+		{"truncated TLV", mod(func(b []byte) []byte {
+			// Claim a longer SHA256 TLV than the area holds.
+			binary.LittleEndian.PutUint16(b[bodyEnd+6:], 33)
+			return b
+		}), "truncated TLV"},
+		{"protected size mismatch", mod(func(b []byte) []byte {
+			b = testImage{
+				body: []byte("image body"),
+				protTlvs: []ImageTlv{
+					{Type: IMAGE_TLV_SEC_CNT, Data: []byte{1}},
+				},
+			}.build()
+			binary.LittleEndian.PutUint16(b[10:], 4)
+			return b
+		}), "protected TLV"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseImage(tt.data)
+			if err == nil {
+				t.Fatalf("parse succeeded; want error containing %q",
+					tt.err)
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("error %q; want error containing %q",
+					err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func TestImageVerifyHash(t *testing.T) {
+	data := testImage{body: []byte("image body")}.build()
+	data[IMAGE_HEADER_SIZE] ^= 0xff
+
+	img, err := ParseImage(data)
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if err := img.VerifyHash(); err == nil {
+		t.Fatalf("hash verification of a modified image succeeded")
+	}
+}
+
+func TestImageVersionCompare(t *testing.T) {
+	tests := []struct {
+		a, b ImageVersion
+		want int
+	}{
+		{ImageVersion{1, 0, 0, 0}, ImageVersion{1, 0, 0, 0}, 0},
+		{ImageVersion{1, 0, 0, 0}, ImageVersion{2, 0, 0, 0}, -1},
+		{ImageVersion{1, 2, 0, 0}, ImageVersion{1, 1, 9, 9}, 1},
+		{ImageVersion{1, 1, 300, 0}, ImageVersion{1, 1, 299, 7}, 1},
+		{ImageVersion{1, 1, 1, 1}, ImageVersion{1, 1, 1, 2}, -1},
+	}
+
+	for _, tt := range tests {
+		if got := tt.a.Compare(tt.b); got != tt.want {
+			t.Errorf("%s vs %s: got %d; want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestImageFlagsString(t *testing.T) {
+	tests := []struct {
+		flags uint32
+		want  string
+	}{
+		{0, ""},
+		{IMAGE_F_PIC, "pic"},
+		{IMAGE_F_NON_BOOTABLE | IMAGE_F_RAM_LOAD, "non-bootable,ram-load"},
+		{0x80000000, "0x80000000"},
+	}
+
+	for _, tt := range tests {
+		if got := ImageFlagsString(tt.flags); got != tt.want {
+			t.Errorf("0x%08x: got %q; want %q", tt.flags, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmimage
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Salt length that MCUboot uses for RSA-PSS signatures.
+const IMAGE_RSA_PSS_SALT_LEN = 32
+
+// ParsePubKeyPem extracts a public key from a PEM file.  The file can contain
+// either a public key or a private key (as generated by imgtool or newt).
+// Supported key types are ECDSA P-256, RSA-2048, RSA-3072, and ED25519.
+func ParsePubKeyPem(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key file is not PEM-encoded")
+	}
+
+	var key interface{}
+	var err error
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", strings.ToLower(block.Type),
+			err.Error())
+	}
+
+	var pub crypto.PublicKey
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		pub = &k.PublicKey
+	case *ecdsa.PrivateKey:
+		pub = &k.PublicKey
+	case ed25519.PrivateKey:
+		pub = k.Public()
+	default:
+		pub = k
+	}
+
+	if _, err := sigTlvType(pub); err != nil {
+		return nil, err
+	}
+
+	return pub, nil
+}
+
+// sigTlvType returns the type of signature TLV that the specified key
+// produces.
+func sigTlvType(pub crypto.PublicKey) (uint8, error) {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return 0, fmt.Errorf("unsupported ECDSA curve: %s",
+				k.Curve.Params().Name)
+		}
+		return IMAGE_TLV_ECDSA256, nil
+
+	case *rsa.PublicKey:
+		switch k.N.BitLen() {
+		case 2048:
+			return IMAGE_TLV_RSA2048, nil
+		case 3072:
+			return IMAGE_TLV_RSA3072, nil
+		default:
+			return 0, fmt.Errorf("unsupported RSA key size: %d",
+				k.N.BitLen())
+		}
+
+	case ed25519.PublicKey:
+		return IMAGE_TLV_ED25519, nil
+
+	default:
+		return 0, fmt.Errorf("unsupported key type: %T", pub)
+	}
+}
+
+// KeyHash computes the hash that identifies a public key in an image's
+// KEYHASH TLV.  As in MCUboot, RSA keys are hashed in their PKCS#1 encoding;
+// other keys are hashed in their PKIX encoding.
+func KeyHash(pub crypto.PublicKey) ([]byte, error) {
+	var der []byte
+	var err error
+
+	if k, ok := pub.(*rsa.PublicKey); ok {
+		der = x509.MarshalPKCS1PublicKey(k)
+	} else {
+		der, err = x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hash := sha256.Sum256(der)
+	return hash[:], nil
+}
+
+// ImageSig is a signature TLV and the key hash TLV that precedes it.
+type ImageSig struct {
+	Type    uint8
+	KeyHash []byte
+	Data    []byte
+}
+
+// Sigs returns the image's signatures.
+func (img *Image) Sigs() []ImageSig {
+	var sigs []ImageSig
+	var keyHash []byte
+
+	for _, t := range img.Tlvs {
+		if t.Type == IMAGE_TLV_KEYHASH {
+			keyHash = t.Data
+		} else if IsSigTlv(t.Type) {
+			sigs = append(sigs, ImageSig{
+				Type:    t.Type,
+				KeyHash: keyHash,
+				Data:    t.Data,
+			})
+			keyHash = nil
+		}
+	}
+
+	return sigs
+}
+
+// verifyEcdsaSig checks a DER-encoded ECDSA signature.  newt pads ECDSA256
+// signature TLVs with zeros to a fixed 72 bytes, so bytes following the DER
+// sequence are ignored.
+func verifyEcdsaSig(pub *ecdsa.PublicKey, hash []byte, sig []byte) bool {
+	var rs struct {
+		R, S *big.Int
+	}
+
+	if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+		return false
+	}
+
+	return ecdsa.Verify(pub, hash, rs.R, rs.S)
+}
+
+func verifySig(pub crypto.PublicKey, hash []byte, sig []byte) bool {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		return verifyEcdsaSig(k, hash, sig)
+
+	case *rsa.PublicKey:
+		opts := &rsa.PSSOptions{SaltLength: IMAGE_RSA_PSS_SALT_LEN}
+		return rsa.VerifyPSS(k, crypto.SHA256, hash, sig, opts) == nil
+
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, hash, sig)
+
+	default:
+		return false
+	}
+}
+
+// VerifySig checks that the image is signed with the specified public key.
+// The image hash is verified first.  On failure, the returned error indicates
+// which key hashes the image was actually signed with.
+func (img *Image) VerifySig(pub crypto.PublicKey) error {
+	typ, err := sigTlvType(pub)
+	if err != nil {
+		return err
+	}
+
+	keyHash, err := KeyHash(pub)
+	if err != nil {
+		return err
+	}
+
+	if err := img.VerifyHash(); err != nil {
+		return err
+	}
+	hash := img.CalcHash()
+
+	sigs := img.Sigs()
+	if len(sigs) == 0 {
+		return fmt.Errorf("image is not signed")
+	}
+
+	var signers []string
+	for _, s := range sigs {
+		if s.Type == typ && verifySig(pub, hash, s.Data) {
+			return nil
+		}
+
+		signer := ImageTlvTypeName(s.Type) + " key hash "
+		if s.KeyHash == nil {
+			signer += "unknown"
+		} else {
+			signer += hex.EncodeToString(s.KeyHash)
+		}
+		signers = append(signers, signer)
+	}
+
+	msg := fmt.Sprintf("image signature does not match %s key (key hash "+
+		"%s); image is signed with: %s", ImageTlvTypeName(typ),
+		hex.EncodeToString(keyHash), strings.Join(signers, ", "))
+
+	for _, s := range sigs {
+		if bytes.Equal(s.KeyHash, keyHash) {
+			msg += " (key hash matches, but signature is invalid)"
+			break
+		}
+	}
+
+	return fmt.Errorf("%s", msg)
+}
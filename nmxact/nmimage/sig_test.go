@@ -0,0 +1,187 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmimage
+
+import (
+	"bytes"
+	"crypto"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The fixtures in testdata are produced by testdata/mkimages.py.
+
+func readKey(t *testing.T, name string) crypto.PublicKey {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, err := ParsePubKeyPem(data)
+	if err != nil {
+		t.Fatalf("%s: %s", name, err.Error())
+	}
+
+	return pub
+}
+
+func readSignedImage(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestVerifySig(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		img     string
+		sigType uint8
+	}{
+		{"ecdsa256", "ecdsa256-key.pem", "ecdsa256-signed.img",
+			IMAGE_TLV_ECDSA256},
+		{"ecdsa256 public key", "ecdsa256-pub.pem", "ecdsa256-signed.img",
+			IMAGE_TLV_ECDSA256},
+		{"rsa2048", "rsa2048-key.pem", "rsa2048-signed.img",
+			IMAGE_TLV_RSA2048},
+		{"rsa3072", "rsa3072-key.pem", "rsa3072-signed.img",
+			IMAGE_TLV_RSA3072},
+		{"ed25519", "ed25519-key.pem", "ed25519-signed.img",
+			IMAGE_TLV_ED25519},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := readKey(t, tt.key)
+
+			img, err := ParseImage(readSignedImage(t, tt.img))
+			if err != nil {
+				t.Fatalf("parse failed: %s", err.Error())
+			}
+
+			sigs := img.Sigs()
+			if len(sigs) != 1 || sigs[0].Type != tt.sigType {
+				t.Fatalf("unexpected signatures: %+v", sigs)
+			}
+
+			keyHash, err := KeyHash(pub)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(sigs[0].KeyHash, keyHash) {
+				t.Fatalf("key hash mismatch: image=%x key=%x",
+					sigs[0].KeyHash, keyHash)
+			}
+
+			if err := img.VerifySig(pub); err != nil {
+				t.Fatalf("verification failed: %s", err.Error())
+			}
+		})
+	}
+}
+
+func TestEcdsaFixturePadded(t *testing.T) {
+	img, err := ParseImage(readSignedImage(t, "ecdsa256-signed.img"))
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+
+	// newt pads ECDSA signatures; make sure the fixture exercises that.
+	sig := img.Sigs()[0].Data
+	if len(sig) != 72 || sig[len(sig)-1] != 0 {
+		t.Fatalf("fixture signature is not padded: %x", sig)
+	}
+}
+
+func TestVerifySigMismatch(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		img  string
+		err  string
+	}{
+		{"other ecdsa256 key", "ecdsa256-other-key.pem",
+			"ecdsa256-signed.img", "image is signed with: ECDSA256"},
+		{"other key type", "rsa2048-key.pem", "ecdsa256-signed.img",
+			"does not match RSA2048 key"},
+		{"rsa size", "rsa3072-key.pem", "rsa2048-signed.img",
+			"image is signed with: RSA2048"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := ParseImage(readSignedImage(t, tt.img))
+			if err != nil {
+				t.Fatalf("parse failed: %s", err.Error())
+			}
+
+			err = img.VerifySig(readKey(t, tt.key))
+			if err == nil {
+				t.Fatalf("verification succeeded")
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("error %q; want error containing %q",
+					err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func TestVerifySigCorrupt(t *testing.T) {
+	imgs := []struct {
+		key string
+		img string
+	}{
+		{"ecdsa256-key.pem", "ecdsa256-signed.img"},
+		{"rsa2048-key.pem", "rsa2048-signed.img"},
+		{"rsa3072-key.pem", "rsa3072-signed.img"},
+		{"ed25519-key.pem", "ed25519-signed.img"},
+	}
+
+	for _, tt := range imgs {
+		t.Run(tt.img, func(t *testing.T) {
+			img, err := ParseImage(readSignedImage(t, tt.img))
+			if err != nil {
+				t.Fatalf("parse failed: %s", err.Error())
+			}
+
+			// Flip a bit within the signature proper, not its padding.
+			sig := img.Sigs()[0].Data
+			sig[len(sig)/3] ^= 0x01
+
+			err = img.VerifySig(readKey(t, tt.key))
+			if err == nil {
+				t.Fatalf("verification of a corrupt signature succeeded")
+			}
+			if !strings.Contains(err.Error(), "signature is invalid") {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+		})
+	}
+}
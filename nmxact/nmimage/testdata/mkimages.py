@@ -0,0 +1,120 @@
+#!/usr/bin/env python3
+#
+# Licensed to the Apache Software Foundation (ASF) under one
+# or more contributor license agreements.  See the NOTICE file
+# distributed with this work for additional information
+# regarding copyright ownership.  The ASF licenses this file
+# to you under the Apache License, Version 2.0 (the
+# "License"); you may not use this file except in compliance
+# with the License.  You may obtain a copy of the License at
+#
+#  http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing,
+# software distributed under the License is distributed on an
+# "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+# KIND, either express or implied.  See the License for the
+# specific language governing permissions and limitations
+# under the License.
+#
+
+# Generates the signed image fixtures used by the nmimage tests.  Keys are
+# generated and signatures are computed with the openssl command line tool, so
+# the fixtures do not depend on the code under test.  Images are laid out the
+# way newt signs them: SHA256, then KEYHASH and signature TLVs.  ECDSA
+# signatures are zero-padded to 72 bytes, as newt does.
+#
+# Usage: ./mkimages.py  (run from this directory)
+
+import hashlib
+import os
+import struct
+import subprocess
+import tempfile
+
+IMAGE_MAGIC = 0x96f3b83d
+TLV_INFO_MAGIC = 0x6907
+
+TLV_KEYHASH = 0x01
+TLV_SHA256 = 0x10
+TLV_RSA2048 = 0x20
+TLV_ECDSA256 = 0x22
+TLV_RSA3072 = 0x23
+TLV_ED25519 = 0x24
+
+ECDSA256_SIG_LEN = 72
+
+
+def openssl(*args, data=None):
+    return subprocess.run(["openssl"] + list(args), input=data,
+                          stdout=subprocess.PIPE, check=True).stdout
+
+
+def genkey(name, *args):
+    openssl("genpkey", "-out", name + "-key.pem", *args)
+
+
+def pubkey_der(key, rsa):
+    if rsa:
+        return openssl("rsa", "-in", key, "-RSAPublicKey_out",
+                       "-outform", "DER")
+    return openssl("pkey", "-in", key, "-pubout", "-outform", "DER")
+
+
+def sign(key, digest, kind):
+    with tempfile.NamedTemporaryFile() as f:
+        f.write(digest)
+        f.flush()
+
+        if kind == "ecdsa":
+            # Pick a signature that needs padding.
+            while True:
+                sig = openssl("pkeyutl", "-sign", "-inkey", key,
+                              "-in", f.name)
+                if len(sig) < ECDSA256_SIG_LEN:
+                    return sig + b"\0" * (ECDSA256_SIG_LEN - len(sig))
+        if kind == "rsa":
+            return openssl("pkeyutl", "-sign", "-inkey", key, "-in", f.name,
+                           "-pkeyopt", "digest:sha256",
+                           "-pkeyopt", "rsa_padding_mode:pss",
+                           "-pkeyopt", "rsa_pss_saltlen:32")
+        return openssl("pkeyutl", "-sign", "-inkey", key, "-rawin",
+                       "-in", f.name)
+
+
+def tlv(typ, data):
+    return struct.pack("<BxH", typ, len(data)) + data
+
+
+def mkimage(name, sig_type, kind):
+    key = name + "-key.pem"
+    body = bytes((i * 7) & 0xff for i in range(1000))
+
+    hdr = struct.pack("<IIHHIIBBHII", IMAGE_MAGIC, 0, 32, 0, len(body), 0,
+                      1, 2, 3, 4, 0)
+    digest = hashlib.sha256(hdr + body).digest()
+
+    keyhash = hashlib.sha256(pubkey_der(key, kind == "rsa")).digest()
+    tlvs = (tlv(TLV_SHA256, digest) + tlv(TLV_KEYHASH, keyhash) +
+            tlv(sig_type, sign(key, digest, kind)))
+    info = struct.pack("<HH", TLV_INFO_MAGIC, 4 + len(tlvs))
+
+    with open(name + "-signed.img", "wb") as f:
+        f.write(hdr + body + info + tlvs)
+
+
+genkey("ecdsa256", "-algorithm", "EC", "-pkeyopt",
+       "ec_paramgen_curve:P-256")
+genkey("ecdsa256-other", "-algorithm", "EC", "-pkeyopt",
+       "ec_paramgen_curve:P-256")
+genkey("rsa2048", "-algorithm", "RSA", "-pkeyopt", "rsa_keygen_bits:2048")
+genkey("rsa3072", "-algorithm", "RSA", "-pkeyopt", "rsa_keygen_bits:3072")
+genkey("ed25519", "-algorithm", "ED25519")
+
+openssl("pkey", "-in", "ecdsa256-key.pem", "-pubout",
+        "-out", "ecdsa256-pub.pem")
+
+mkimage("ecdsa256", TLV_ECDSA256, "ecdsa")
+mkimage("rsa2048", TLV_RSA2048, "rsa")
+mkimage("rsa3072", TLV_RSA3072, "rsa")
+mkimage("ed25519", TLV_ED25519, "ed25519")
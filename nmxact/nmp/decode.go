@@ -34,6 +34,7 @@ const gr_sta = NMP_GROUP_STAT
 const gr_cfg = NMP_GROUP_CONFIG
 const gr_log = NMP_GROUP_LOG
 const gr_cra = NMP_GROUP_CRASH
+const gr_spl = NMP_GROUP_SPLIT
 const gr_run = NMP_GROUP_RUN
 const gr_fil = NMP_GROUP_FS
 const gr_she = NMP_GROUP_SHELL
@@ -48,6 +49,7 @@ type Ogi struct {
 type rspCtor func() NmpRsp
 
 func echoRspCtor() NmpRsp          { return NewEchoRsp() }
+func consEchoCtrlRspCtor() NmpRsp  { return NewConsEchoCtrlRsp() }
 func taskStatRspCtor() NmpRsp      { return NewTaskStatRsp() }
 func mpStatRspCtor() NmpRsp        { return NewMempoolStatRsp() }
 func dateTimeReadRspCtor() NmpRsp  { return NewDateTimeReadRsp() }
@@ -67,43 +69,58 @@ func logModuleListRspCtor() NmpRsp { return NewLogModuleListRsp() }
 func logLevelListRspCtor() NmpRsp  { return NewLogLevelListRsp() }
 func logClearRspCtor() NmpRsp      { return NewLogClearRsp() }
 func crashRspCtor() NmpRsp         { return NewCrashRsp() }
+func splitReadRspCtor() NmpRsp     { return NewSplitReadRsp() }
+func splitWriteRspCtor() NmpRsp    { return NewSplitWriteRsp() }
 func runTestRspCtor() NmpRsp       { return NewRunTestRsp() }
 func runListRspCtor() NmpRsp       { return NewRunListRsp() }
 func fsDownloadRspCtor() NmpRsp    { return NewFsDownloadRsp() }
 func fsUploadRspCtor() NmpRsp      { return NewFsUploadRsp() }
+func fsStatRspCtor() NmpRsp        { return NewFsStatRsp() }
+func fsHashRspCtor() NmpRsp        { return NewFsHashRsp() }
+func fsLsRspCtor() NmpRsp          { return NewFsLsRsp() }
+func fsUnlinkRspCtor() NmpRsp      { return NewFsUnlinkRsp() }
+func fsMkdirRspCtor() NmpRsp       { return NewFsMkdirRsp() }
 func configReadRspCtor() NmpRsp    { return NewConfigReadRsp() }
 func configWriteRspCtor() NmpRsp   { return NewConfigWriteRsp() }
 func shellExecRspCtor() NmpRsp     { return NewShellExecRsp() }
 
 var rspCtorMap = map[Ogi]rspCtor{
-	{op_wr, gr_def, NMP_ID_DEF_ECHO}:         echoRspCtor,
-	{op_rr, gr_def, NMP_ID_DEF_TASKSTAT}:     taskStatRspCtor,
-	{op_rr, gr_def, NMP_ID_DEF_MPSTAT}:       mpStatRspCtor,
-	{op_rr, gr_def, NMP_ID_DEF_DATETIME_STR}: dateTimeReadRspCtor,
-	{op_wr, gr_def, NMP_ID_DEF_DATETIME_STR}: dateTimeWriteRspCtor,
-	{op_wr, gr_def, NMP_ID_DEF_RESET}:        resetRspCtor,
-	{op_wr, gr_img, NMP_ID_IMAGE_UPLOAD}:     imageUploadRspCtor,
-	{op_rr, gr_img, NMP_ID_IMAGE_STATE}:      imageStateRspCtor,
-	{op_wr, gr_img, NMP_ID_IMAGE_STATE}:      imageStateRspCtor,
-	{op_rr, gr_img, NMP_ID_IMAGE_CORELIST}:   coreListRspCtor,
-	{op_rr, gr_img, NMP_ID_IMAGE_CORELOAD}:   coreLoadRspCtor,
-	{op_wr, gr_img, NMP_ID_IMAGE_CORELOAD}:   coreEraseRspCtor,
-	{op_wr, gr_img, NMP_ID_IMAGE_ERASE}:      imageEraseRspCtor,
-	{op_rr, gr_sta, NMP_ID_STAT_READ}:        statReadRspCtor,
-	{op_rr, gr_sta, NMP_ID_STAT_LIST}:        statListRspCtor,
-	{op_rr, gr_log, NMP_ID_LOG_SHOW}:         logReadRspCtor,
-	{op_rr, gr_log, NMP_ID_LOG_LIST}:         logListRspCtor,
-	{op_rr, gr_log, NMP_ID_LOG_MODULE_LIST}:  logModuleListRspCtor,
-	{op_rr, gr_log, NMP_ID_LOG_LEVEL_LIST}:   logLevelListRspCtor,
-	{op_wr, gr_log, NMP_ID_LOG_CLEAR}:        logClearRspCtor,
-	{op_wr, gr_cra, NMP_ID_CRASH_TRIGGER}:    crashRspCtor,
-	{op_wr, gr_run, NMP_ID_RUN_TEST}:         runTestRspCtor,
-	{op_rr, gr_run, NMP_ID_RUN_LIST}:         runListRspCtor,
-	{op_rr, gr_fil, NMP_ID_FS_FILE}:          fsDownloadRspCtor,
-	{op_wr, gr_fil, NMP_ID_FS_FILE}:          fsUploadRspCtor,
-	{op_rr, gr_cfg, NMP_ID_CONFIG_VAL}:       configReadRspCtor,
-	{op_wr, gr_cfg, NMP_ID_CONFIG_VAL}:       configWriteRspCtor,
-	{op_wr, gr_she, NMP_ID_SHELL_EXEC}:       shellExecRspCtor,
+	{op_wr, gr_def, NMP_ID_DEF_ECHO}:           echoRspCtor,
+	{op_wr, gr_def, NMP_ID_DEF_CONS_ECHO_CTRL}: consEchoCtrlRspCtor,
+	{op_rr, gr_def, NMP_ID_DEF_TASKSTAT}:       taskStatRspCtor,
+	{op_rr, gr_def, NMP_ID_DEF_MPSTAT}:         mpStatRspCtor,
+	{op_rr, gr_def, NMP_ID_DEF_DATETIME_STR}:   dateTimeReadRspCtor,
+	{op_wr, gr_def, NMP_ID_DEF_DATETIME_STR}:   dateTimeWriteRspCtor,
+	{op_wr, gr_def, NMP_ID_DEF_RESET}:          resetRspCtor,
+	{op_wr, gr_img, NMP_ID_IMAGE_UPLOAD}:       imageUploadRspCtor,
+	{op_rr, gr_img, NMP_ID_IMAGE_STATE}:        imageStateRspCtor,
+	{op_wr, gr_img, NMP_ID_IMAGE_STATE}:        imageStateRspCtor,
+	{op_rr, gr_img, NMP_ID_IMAGE_CORELIST}:     coreListRspCtor,
+	{op_rr, gr_img, NMP_ID_IMAGE_CORELOAD}:     coreLoadRspCtor,
+	{op_wr, gr_img, NMP_ID_IMAGE_CORELOAD}:     coreEraseRspCtor,
+	{op_wr, gr_img, NMP_ID_IMAGE_ERASE}:        imageEraseRspCtor,
+	{op_rr, gr_sta, NMP_ID_STAT_READ}:          statReadRspCtor,
+	{op_rr, gr_sta, NMP_ID_STAT_LIST}:          statListRspCtor,
+	{op_rr, gr_log, NMP_ID_LOG_SHOW}:           logReadRspCtor,
+	{op_rr, gr_log, NMP_ID_LOG_LIST}:           logListRspCtor,
+	{op_rr, gr_log, NMP_ID_LOG_MODULE_LIST}:    logModuleListRspCtor,
+	{op_rr, gr_log, NMP_ID_LOG_LEVEL_LIST}:     logLevelListRspCtor,
+	{op_wr, gr_log, NMP_ID_LOG_CLEAR}:          logClearRspCtor,
+	{op_wr, gr_cra, NMP_ID_CRASH_TRIGGER}:      crashRspCtor,
+	{op_rr, gr_spl, NMP_ID_SPLIT_SPLIT}:        splitReadRspCtor,
+	{op_wr, gr_spl, NMP_ID_SPLIT_SPLIT}:        splitWriteRspCtor,
+	{op_wr, gr_run, NMP_ID_RUN_TEST}:           runTestRspCtor,
+	{op_rr, gr_run, NMP_ID_RUN_LIST}:           runListRspCtor,
+	{op_rr, gr_fil, NMP_ID_FS_FILE}:            fsDownloadRspCtor,
+	{op_wr, gr_fil, NMP_ID_FS_FILE}:            fsUploadRspCtor,
+	{op_rr, gr_fil, NMP_ID_FS_STAT}:            fsStatRspCtor,
+	{op_rr, gr_fil, NMP_ID_FS_HASH}:            fsHashRspCtor,
+	{op_rr, gr_fil, NMP_ID_FS_LS}:              fsLsRspCtor,
+	{op_wr, gr_fil, NMP_ID_FS_UNLINK}:          fsUnlinkRspCtor,
+	{op_wr, gr_fil, NMP_ID_FS_MKDIR}:           fsMkdirRspCtor,
+	{op_rr, gr_cfg, NMP_ID_CONFIG_VAL}:         configReadRspCtor,
+	{op_wr, gr_cfg, NMP_ID_CONFIG_VAL}:         configWriteRspCtor,
+	{op_wr, gr_she, NMP_ID_SHELL_EXEC}:         shellExecRspCtor,
 }
 
 func DecodeRspBody(hdr *NmpHdr, body []byte) (NmpRsp, error) {
@@ -121,7 +138,15 @@ func DecodeRspBody(hdr *NmpHdr, body []byte) (NmpRsp, error) {
 		return nil, fmt.Errorf("Invalid response: %s", err.Error())
 	}
 
+	// Extract the status fields common to all responses.
+	var st rspStatus
+	dec = codec.NewDecoderBytes(body, cborCodec)
+	if err := dec.Decode(&st); err != nil {
+		return nil, fmt.Errorf("Invalid response: %s", err.Error())
+	}
+
 	r.SetHdr(hdr)
+	r.SetRspErr(st.err())
 	return r, nil
 }
 
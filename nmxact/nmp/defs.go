@@ -27,12 +27,23 @@ const (
 )
 
 const (
-	NMP_ERR_OK       = 0
-	NMP_ERR_EUNKNOWN = 1
-	NMP_ERR_ENOMEM   = 2
-	NMP_ERR_EINVAL   = 3
-	NMP_ERR_ETIMEOUT = 4
-	NMP_ERR_ENOENT   = 5
+	NMP_ERR_OK                  = 0
+	NMP_ERR_EUNKNOWN            = 1
+	NMP_ERR_ENOMEM              = 2
+	NMP_ERR_EINVAL              = 3
+	NMP_ERR_ETIMEOUT            = 4
+	NMP_ERR_ENOENT              = 5
+	NMP_ERR_EBADSTATE           = 6
+	NMP_ERR_EMSGSIZE            = 7
+	NMP_ERR_ENOTSUP             = 8
+	NMP_ERR_ECORRUPT            = 9
+	NMP_ERR_EBUSY               = 10
+	NMP_ERR_EACCESSDENIED       = 11
+	NMP_ERR_UNSUPPORTED_TOO_OLD = 12
+	NMP_ERR_UNSUPPORTED_TOO_NEW = 13
+
+	// Codes at or above this value are defined by the application.
+	NMP_ERR_EPERUSER = 256
 )
 
 // First 64 groups are reserved for system level newtmgr commands.
@@ -97,15 +108,28 @@ const (
 	NMP_ID_CRASH_TRIGGER = 0
 )
 
+// Split group (6).
+const (
+	NMP_ID_SPLIT_SPLIT = 0
+)
+
 // Run group (7).
 const (
 	NMP_ID_RUN_TEST = 0
 	NMP_ID_RUN_LIST = 1
 )
 
-// File system group (8).
+// File system group (8).  IDs 0-2 match MCUmgr, which also assigns 3
+// (supported hash types) and 4 (close file).  LS, UNLINK and MKDIR are a
+// newtmgr extension that MCUmgr does not define; they only work with device
+// firmware that implements them.
 const (
-	NMP_ID_FS_FILE = 0
+	NMP_ID_FS_FILE   = 0
+	NMP_ID_FS_STAT   = 1
+	NMP_ID_FS_HASH   = 2
+	NMP_ID_FS_LS     = 5
+	NMP_ID_FS_UNLINK = 6
+	NMP_ID_FS_MKDIR  = 7
 )
 
 // Shell group (8).
@@ -138,7 +138,13 @@ func (d *Dispatcher) DispatchRsp(r NmpRsp) bool {
 		return false
 	}
 
-	nl.RspChan <- r
+	// A duplicated response must not block the receive path while the
+	// listener still holds an unread one; drop it instead.
+	select {
+	case nl.RspChan <- r:
+	default:
+		log.Debugf("Dropping duplicate NMP rsp; seq=%d", r.Hdr().Seq)
+	}
 
 	return true
 }
@@ -45,3 +45,27 @@ func NewEchoRsp() *EchoRsp {
 }
 
 func (r *EchoRsp) Msg() *NmpMsg { return MsgFromReq(r) }
+
+type ConsEchoCtrlReq struct {
+	NmpBase `codec:"-"`
+	Echo    int `codec:"echo"`
+}
+
+type ConsEchoCtrlRsp struct {
+	NmpBase
+	Rc int `codec:"rc"`
+}
+
+func NewConsEchoCtrlReq() *ConsEchoCtrlReq {
+	r := &ConsEchoCtrlReq{}
+	fillNmpReq(r, NMP_OP_WRITE, NMP_GROUP_DEFAULT, NMP_ID_DEF_CONS_ECHO_CTRL)
+	return r
+}
+
+func (r *ConsEchoCtrlReq) Msg() *NmpMsg { return MsgFromReq(r) }
+
+func NewConsEchoCtrlRsp() *ConsEchoCtrlRsp {
+	return &ConsEchoCtrlRsp{}
+}
+
+func (r *ConsEchoCtrlRsp) Msg() *NmpMsg { return MsgFromReq(r) }
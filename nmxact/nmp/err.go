@@ -0,0 +1,165 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmp
+
+import (
+	"fmt"
+)
+
+type nmpRcInfo struct {
+	name string
+	desc string
+}
+
+var nmpRcInfoMap = map[int]nmpRcInfo{
+	NMP_ERR_OK:                  {"EOK", "no error"},
+	NMP_ERR_EUNKNOWN:            {"EUNKNOWN", "unknown error"},
+	NMP_ERR_ENOMEM:              {"ENOMEM", "not enough memory"},
+	NMP_ERR_EINVAL:              {"EINVAL", "invalid argument"},
+	NMP_ERR_ETIMEOUT:            {"ETIMEOUT", "operation timed out"},
+	NMP_ERR_ENOENT:              {"ENOENT", "no such entry"},
+	NMP_ERR_EBADSTATE:           {"EBADSTATE", "current state disallows command"},
+	NMP_ERR_EMSGSIZE:            {"EMSGSIZE", "response too large"},
+	NMP_ERR_ENOTSUP:             {"ENOTSUP", "command not supported"},
+	NMP_ERR_ECORRUPT:            {"ECORRUPT", "corrupt data"},
+	NMP_ERR_EBUSY:               {"EBUSY", "device busy"},
+	NMP_ERR_EACCESSDENIED:       {"EACCESSDENIED", "access denied"},
+	NMP_ERR_UNSUPPORTED_TOO_OLD: {"UNSUPPORTED_TOO_OLD", "protocol version too old"},
+	NMP_ERR_UNSUPPORTED_TOO_NEW: {"UNSUPPORTED_TOO_NEW", "protocol version too new"},
+}
+
+// NmpRcName returns the symbolic name of an NMP status code (e.g.,
+// "EINVAL").
+func NmpRcName(rc int) string {
+	if info, ok := nmpRcInfoMap[rc]; ok {
+		return info.name
+	}
+
+	if rc >= NMP_ERR_EPERUSER {
+		return fmt.Sprintf("EPERUSER+%d", rc-NMP_ERR_EPERUSER)
+	}
+
+	return "UNKNOWN"
+}
+
+// NmpRcDesc returns a short description of an NMP status code (e.g.,
+// "invalid argument").
+func NmpRcDesc(rc int) string {
+	if info, ok := nmpRcInfoMap[rc]; ok {
+		return info.desc
+	}
+
+	if rc >= NMP_ERR_EPERUSER {
+		return "application-defined error"
+	}
+
+	return "unrecognized error code"
+}
+
+// NmpRcToString returns a human-readable representation of an NMP status code
+// of the form: "EINVAL (3): invalid argument".
+func NmpRcToString(rc int) string {
+	return fmt.Sprintf("%s (%d): %s", NmpRcName(rc), rc, NmpRcDesc(rc))
+}
+
+// NmpRcError indicates that a device responded to a request with a nonzero
+// status code.
+type NmpRcError struct {
+	Rc int
+}
+
+func NewNmpRcError(rc int) *NmpRcError {
+	return &NmpRcError{
+		Rc: rc,
+	}
+}
+
+func (e *NmpRcError) Error() string {
+	return NmpRcToString(e.Rc)
+}
+
+func IsNmpRc(err error) bool {
+	_, ok := err.(*NmpRcError)
+	return ok
+}
+
+func ToNmpRc(err error) *NmpRcError {
+	if rerr, ok := err.(*NmpRcError); ok {
+		return rerr
+	} else {
+		return nil
+	}
+}
+
+// NmpGroupErr is the body of the "err" map that protocol version 2 devices
+// include in a response to indicate a group-specific failure.  The meaning of
+// the status code depends on the group.
+type NmpGroupErr struct {
+	Group uint16 `codec:"group"`
+	Rc    int    `codec:"rc"`
+}
+
+// NmpGroupError indicates that a device responded to a request with a
+// group-specific status code.
+type NmpGroupError struct {
+	Group uint16
+	Rc    int
+}
+
+func NewNmpGroupError(group uint16, rc int) *NmpGroupError {
+	return &NmpGroupError{
+		Group: group,
+		Rc:    rc,
+	}
+}
+
+func (e *NmpGroupError) Error() string {
+	return fmt.Sprintf("group %d error: rc=%d", e.Group, e.Rc)
+}
+
+func IsNmpGroup(err error) bool {
+	_, ok := err.(*NmpGroupError)
+	return ok
+}
+
+func ToNmpGroup(err error) *NmpGroupError {
+	if gerr, ok := err.(*NmpGroupError); ok {
+		return gerr
+	} else {
+		return nil
+	}
+}
+
+// rspStatus holds the status fields that any response may contain.
+type rspStatus struct {
+	Rc  int          `codec:"rc"`
+	Err *NmpGroupErr `codec:"err"`
+}
+
+func (st *rspStatus) err() error {
+	if st.Err != nil && st.Err.Rc != 0 {
+		return NewNmpGroupError(st.Err.Group, st.Err.Rc)
+	}
+	if st.Rc != 0 {
+		return NewNmpRcError(st.Rc)
+	}
+
+	return nil
+}
@@ -19,7 +19,10 @@
 
 package nmp
 
-import ()
+import (
+	"encoding/binary"
+	"fmt"
+)
 
 //////////////////////////////////////////////////////////////////////////////
 // $download                                                                //
@@ -84,3 +87,195 @@ func NewFsUploadRsp() *FsUploadRsp {
 }
 
 func (r *FsUploadRsp) Msg() *NmpMsg { return MsgFromReq(r) }
+
+//////////////////////////////////////////////////////////////////////////////
+// $stat                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+type FsStatReq struct {
+	NmpBase     `codec:"-"`
+	Name string `codec:"name"`
+}
+
+type FsStatRsp struct {
+	NmpBase
+	Rc  int    `codec:"rc"`
+	Len uint32 `codec:"len"`
+}
+
+func NewFsStatReq() *FsStatReq {
+	r := &FsStatReq{}
+	fillNmpReq(r, NMP_OP_READ, NMP_GROUP_FS, NMP_ID_FS_STAT)
+	return r
+}
+
+func (r *FsStatReq) Msg() *NmpMsg { return MsgFromReq(r) }
+
+func NewFsStatRsp() *FsStatRsp {
+	return &FsStatRsp{}
+}
+
+func (r *FsStatRsp) Msg() *NmpMsg { return MsgFromReq(r) }
+
+//////////////////////////////////////////////////////////////////////////////
+// $hash                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+const (
+	FS_HASH_CRC32  = "crc32"
+	FS_HASH_SHA256 = "sha256"
+)
+
+// Len of 0 indicates the rest of the file.
+type FsHashReq struct {
+	NmpBase     `codec:"-"`
+	Name string `codec:"name"`
+	Type string `codec:"type,omitempty"`
+	Off  uint32 `codec:"off,omitempty"`
+	Len  uint32 `codec:"len,omitempty"`
+}
+
+// The output is an unsigned integer for checksums (crc32) and a byte string
+// for hashes (sha256).
+type FsHashRsp struct {
+	NmpBase
+	Rc     int         `codec:"rc"`
+	Type   string      `codec:"type"`
+	Off    uint32      `codec:"off"`
+	Len    uint32      `codec:"len"`
+	Output interface{} `codec:"output"`
+}
+
+func NewFsHashReq() *FsHashReq {
+	r := &FsHashReq{}
+	fillNmpReq(r, NMP_OP_READ, NMP_GROUP_FS, NMP_ID_FS_HASH)
+	return r
+}
+
+func (r *FsHashReq) Msg() *NmpMsg { return MsgFromReq(r) }
+
+func NewFsHashRsp() *FsHashRsp {
+	return &FsHashRsp{}
+}
+
+func (r *FsHashRsp) Msg() *NmpMsg { return MsgFromReq(r) }
+
+// Sum returns the response's output as a byte string.  Checksums are
+// converted to big-endian byte strings of the checksum's size.
+func (r *FsHashRsp) Sum() ([]byte, error) {
+	switch o := r.Output.(type) {
+	case []byte:
+		return o, nil
+
+	case uint64:
+		if r.Type == FS_HASH_CRC32 {
+			b := make([]byte, 4)
+			binary.BigEndian.PutUint32(b, uint32(o))
+			return b, nil
+		}
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, o)
+		return b, nil
+
+	default:
+		return nil, fmt.Errorf("invalid %s output: %v", r.Type, r.Output)
+	}
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $ls                                                                      //
+//////////////////////////////////////////////////////////////////////////////
+
+const (
+	FS_ENTRY_TYPE_FILE = "file"
+	FS_ENTRY_TYPE_DIR  = "dir"
+)
+
+type FsEntry struct {
+	Name string `codec:"name"`
+	Type string `codec:"type"`
+	Len  uint32 `codec:"len"`
+}
+
+// Off is the index of the first directory entry to return.
+type FsLsReq struct {
+	NmpBase     `codec:"-"`
+	Name string `codec:"name"`
+	Off  uint32 `codec:"off"`
+}
+
+type FsLsRsp struct {
+	NmpBase
+	Rc      int       `codec:"rc"`
+	Entries []FsEntry `codec:"entries"`
+}
+
+func NewFsLsReq() *FsLsReq {
+	r := &FsLsReq{}
+	fillNmpReq(r, NMP_OP_READ, NMP_GROUP_FS, NMP_ID_FS_LS)
+	return r
+}
+
+func (r *FsLsReq) Msg() *NmpMsg { return MsgFromReq(r) }
+
+func NewFsLsRsp() *FsLsRsp {
+	return &FsLsRsp{}
+}
+
+func (r *FsLsRsp) Msg() *NmpMsg { return MsgFromReq(r) }
+
+//////////////////////////////////////////////////////////////////////////////
+// $unlink                                                                  //
+//////////////////////////////////////////////////////////////////////////////
+
+type FsUnlinkReq struct {
+	NmpBase     `codec:"-"`
+	Name string `codec:"name"`
+}
+
+type FsUnlinkRsp struct {
+	NmpBase
+	Rc int `codec:"rc"`
+}
+
+func NewFsUnlinkReq() *FsUnlinkReq {
+	r := &FsUnlinkReq{}
+	fillNmpReq(r, NMP_OP_WRITE, NMP_GROUP_FS, NMP_ID_FS_UNLINK)
+	return r
+}
+
+func (r *FsUnlinkReq) Msg() *NmpMsg { return MsgFromReq(r) }
+
+func NewFsUnlinkRsp() *FsUnlinkRsp {
+	return &FsUnlinkRsp{}
+}
+
+func (r *FsUnlinkRsp) Msg() *NmpMsg { return MsgFromReq(r) }
+
+//////////////////////////////////////////////////////////////////////////////
+// $mkdir                                                                   //
+//////////////////////////////////////////////////////////////////////////////
+
+type FsMkdirReq struct {
+	NmpBase     `codec:"-"`
+	Name string `codec:"name"`
+}
+
+type FsMkdirRsp struct {
+	NmpBase
+	Rc int `codec:"rc"`
+}
+
+func NewFsMkdirReq() *FsMkdirReq {
+	r := &FsMkdirReq{}
+	fillNmpReq(r, NMP_OP_WRITE, NMP_GROUP_FS, NMP_ID_FS_MKDIR)
+	return r
+}
+
+func (r *FsMkdirReq) Msg() *NmpMsg { return MsgFromReq(r) }
+
+func NewFsMkdirRsp() *FsMkdirRsp {
+	return &FsMkdirRsp{}
+}
+
+func (r *FsMkdirRsp) Msg() *NmpMsg { return MsgFromReq(r) }
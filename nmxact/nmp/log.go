@@ -21,6 +21,8 @@ package nmp
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 )
 
 //////////////////////////////////////////////////////////////////////////////
@@ -80,28 +82,140 @@ var LogTypeNameMap = map[int]string{
 	STORAGE_LOG: "STORAGE",
 }
 
+// Names a log module using the registry set with SetLogNameRegistry.
 func LogModuleToString(lm int) string {
-	name := LogModuleNameMap[lm]
+	return CurLogNameRegistry().ModuleToString(lm)
+}
+
+// Names a log level using the registry set with SetLogNameRegistry.
+func LogLevelToString(lm int) string {
+	return CurLogNameRegistry().LevelToString(lm)
+}
+
+func LogTypeToString(lm int) string {
+	name := LogTypeNameMap[lm]
 	if name == "" {
-		name = "CUSTOM"
+		name = "UNDEFINED"
 	}
 	return name
 }
 
-func LogLevelToString(lm int) string {
-	name := LogLevelNameMap[lm]
+//////////////////////////////////////////////////////////////////////////////
+// $names                                                                   //
+//////////////////////////////////////////////////////////////////////////////
+
+// LogNameRegistry maps log module and level IDs to names.  It starts out
+// with the built-in names; names learned from a particular device or read
+// from a file can be added without affecting other registries.
+type LogNameRegistry struct {
+	mtx     sync.RWMutex
+	modules map[int]string
+	levels  map[int]string
+}
+
+func copyLogNames(m map[int]string) map[int]string {
+	c := make(map[int]string, len(m))
+	for id, name := range m {
+		c[id] = name
+	}
+	return c
+}
+
+func NewLogNameRegistry() *LogNameRegistry {
+	return &LogNameRegistry{
+		modules: copyLogNames(LogModuleNameMap),
+		levels:  copyLogNames(LogLevelNameMap),
+	}
+}
+
+// Adds names for log modules, overriding any existing names for the same
+// IDs.
+func (r *LogNameRegistry) AddModuleNames(names map[int]string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for id, name := range names {
+		r.modules[id] = name
+	}
+}
+
+// Adds names for log levels, overriding any existing names for the same
+// IDs.
+func (r *LogNameRegistry) AddLevelNames(names map[int]string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for id, name := range names {
+		r.levels[id] = name
+	}
+}
+
+func (r *LogNameRegistry) lookup(m map[int]string, name string) (int, bool) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	for id, n := range m {
+		if strings.EqualFold(n, name) {
+			return id, true
+		}
+	}
+
+	return 0, false
+}
+
+func (r *LogNameRegistry) toString(m map[int]string, id int) string {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	name := m[id]
 	if name == "" {
 		name = "CUSTOM"
 	}
 	return name
 }
 
-func LogTypeToString(lm int) string {
-	name := LogTypeNameMap[lm]
-	if name == "" {
-		name = "UNDEFINED"
+// The registry consulted by LogModuleToString and LogLevelToString.
+var curLogNames = NewLogNameRegistry()
+var curLogNamesMtx sync.Mutex
+
+// Sets the registry that LogModuleToString and LogLevelToString consult, for
+// example to the names learned from the device being managed.  A nil
+// registry restores the built-in names.
+func SetLogNameRegistry(r *LogNameRegistry) {
+	if r == nil {
+		r = NewLogNameRegistry()
 	}
-	return name
+
+	curLogNamesMtx.Lock()
+	defer curLogNamesMtx.Unlock()
+
+	curLogNames = r
+}
+
+// Returns the registry set with SetLogNameRegistry.
+func CurLogNameRegistry() *LogNameRegistry {
+	curLogNamesMtx.Lock()
+	defer curLogNamesMtx.Unlock()
+
+	return curLogNames
+}
+
+// Looks up a log module ID by name (case insensitive).
+func (r *LogNameRegistry) ModuleFromString(name string) (int, bool) {
+	return r.lookup(r.modules, name)
+}
+
+// Looks up a log level ID by name (case insensitive).
+func (r *LogNameRegistry) LevelFromString(name string) (int, bool) {
+	return r.lookup(r.levels, name)
+}
+
+func (r *LogNameRegistry) ModuleToString(lm int) string {
+	return r.toString(r.modules, lm)
+}
+
+func (r *LogNameRegistry) LevelToString(ll int) string {
+	return r.toString(r.levels, ll)
 }
 
 //////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,110 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmp
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestLogNameRegistry(t *testing.T) {
+	a := NewLogNameRegistry()
+	b := NewLogNameRegistry()
+
+	a.AddModuleNames(map[int]string{MODULE_OS: "KERNEL", 64: "SENSOR"})
+	a.AddLevelNames(map[int]string{5: "TRACE"})
+
+	if s := a.ModuleToString(MODULE_OS); s != "KERNEL" {
+		t.Fatalf("module %d is %s; want KERNEL", MODULE_OS, s)
+	}
+	if s := a.ModuleToString(64); s != "SENSOR" {
+		t.Fatalf("module 64 is %s; want SENSOR", s)
+	}
+	if id, ok := a.ModuleFromString("sensor"); !ok || id != 64 {
+		t.Fatalf("sensor lookup returned %d, %v; want 64", id, ok)
+	}
+	if id, ok := a.LevelFromString("Trace"); !ok || id != 5 {
+		t.Fatalf("trace lookup returned %d, %v; want 5", id, ok)
+	}
+
+	// Names added to one registry don't leak into others or into the
+	// built-in names.
+	if s := b.ModuleToString(64); s != "CUSTOM" {
+		t.Fatalf("module 64 is %s in another registry; want CUSTOM", s)
+	}
+	if s := b.ModuleToString(MODULE_OS); s != "OS" {
+		t.Fatalf("module %d is %s in another registry; want OS",
+			MODULE_OS, s)
+	}
+	if _, ok := b.LevelFromString("trace"); ok {
+		t.Fatalf("trace found in another registry")
+	}
+	if s := LogModuleToString(64); s != "CUSTOM" {
+		t.Fatalf("built-in name of module 64 is %s; want CUSTOM", s)
+	}
+}
+
+func TestSetLogNameRegistry(t *testing.T) {
+	defer SetLogNameRegistry(nil)
+
+	r := NewLogNameRegistry()
+	r.AddModuleNames(map[int]string{64: "SENSOR"})
+	r.AddLevelNames(map[int]string{5: "TRACE"})
+	SetLogNameRegistry(r)
+
+	if s := LogModuleToString(64); s != "SENSOR" {
+		t.Fatalf("module 64 is %s; want SENSOR", s)
+	}
+	if s := LogLevelToString(5); s != "TRACE" {
+		t.Fatalf("level 5 is %s; want TRACE", s)
+	}
+	if s := LogModuleToString(MODULE_OS); s != "OS" {
+		t.Fatalf("module %d is %s; want OS", MODULE_OS, s)
+	}
+
+	SetLogNameRegistry(nil)
+	if s := LogModuleToString(64); s != "CUSTOM" {
+		t.Fatalf("module 64 is %s after reset; want CUSTOM", s)
+	}
+}
+
+func TestLogNameRegistryConcurrent(t *testing.T) {
+	r := NewLogNameRegistry()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				r.AddModuleNames(map[int]string{100 + i: "M"})
+				r.AddLevelNames(map[int]string{100 + i: "L"})
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				r.ModuleToString(MODULE_OS)
+				r.LevelFromString("l")
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -32,13 +32,25 @@ import (
 
 const NMP_HDR_SIZE = 8
 
+// NMP protocol versions, conveyed in bits 3 and 4 of the first header byte.
+const (
+	NMP_VER_1 uint8 = 0
+	NMP_VER_2 uint8 = 1
+)
+
+// The protocol version to use in outgoing requests.  Version 2 is opt-in;
+// when it is selected, a transceiver falls back to version 1 if the peer
+// responds with a version 1 header or reports that the version is too new.
+var NmpVer uint8 = NMP_VER_1
+
 type NmpHdr struct {
-	Op    uint8 /* 3 bits of opcode */
-	Flags uint8
-	Len   uint16
-	Group uint16
-	Seq   uint8
-	Id    uint8
+	Op      uint8 /* 3 bits of opcode */
+	Version uint8 /* 2 bits of protocol version */
+	Flags   uint8
+	Len     uint16
+	Group   uint16
+	Seq     uint8
+	Id      uint8
 }
 
 type NmpMsg struct {
@@ -58,11 +70,17 @@ type NmpRsp interface {
 	Hdr() *NmpHdr
 	SetHdr(msg *NmpHdr)
 
+	// Returns the error conveyed in the generic status fields of the
+	// response: an *NmpRcError, an *NmpGroupError, or nil.
+	RspErr() error
+	SetRspErr(err error)
+
 	Msg() *NmpMsg
 }
 
 type NmpBase struct {
-	hdr NmpHdr `codec:"-"`
+	hdr    NmpHdr `codec:"-"`
+	rspErr error  `codec:"-"`
 }
 
 func (b *NmpBase) Hdr() *NmpHdr {
@@ -73,6 +91,14 @@ func (b *NmpBase) SetHdr(h *NmpHdr) {
 	b.hdr = *h
 }
 
+func (b *NmpBase) RspErr() error {
+	return b.rspErr
+}
+
+func (b *NmpBase) SetRspErr(err error) {
+	b.rspErr = err
+}
+
 func MsgFromReq(r NmpReq) *NmpMsg {
 	return &NmpMsg{
 		*r.Hdr(),
@@ -92,7 +118,8 @@ func DecodeNmpHdr(data []byte) (*NmpHdr, error) {
 
 	hdr := &NmpHdr{}
 
-	hdr.Op = uint8(data[0])
+	hdr.Op = uint8(data[0]) & 0x07
+	hdr.Version = (uint8(data[0]) >> 3) & 0x03
 	hdr.Flags = uint8(data[1])
 	hdr.Len = binary.BigEndian.Uint16(data[2:4])
 	hdr.Group = binary.BigEndian.Uint16(data[4:6])
@@ -105,7 +132,7 @@ func DecodeNmpHdr(data []byte) (*NmpHdr, error) {
 func (hdr *NmpHdr) Bytes() []byte {
 	buf := make([]byte, 0, NMP_HDR_SIZE)
 
-	buf = append(buf, byte(hdr.Op))
+	buf = append(buf, byte(hdr.Op&0x07|(hdr.Version&0x03)<<3))
 	buf = append(buf, byte(hdr.Flags))
 
 	u16b := make([]byte, 2)
@@ -152,12 +179,13 @@ func EncodeNmpPlain(nmr *NmpMsg) ([]byte, error) {
 
 func fillNmpReqWithSeq(req NmpReq, op uint8, group uint16, id uint8, seq uint8) {
 	hdr := NmpHdr{
-		Op:    op,
-		Flags: 0,
-		Len:   0,
-		Group: group,
-		Seq:   seq,
-		Id:    id,
+		Op:      op,
+		Version: NmpVer,
+		Flags:   0,
+		Len:     0,
+		Group:   group,
+		Seq:     seq,
+		Id:      id,
 	}
 
 	req.SetHdr(&hdr)
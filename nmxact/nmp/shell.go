@@ -24,10 +24,14 @@ type ShellExecReq struct {
 	Argv    []string `codec:"argv"`
 }
 
+// Mynewt devices report a command's return value in the rc field; MCUmgr
+// devices report it in the ret field and only use rc for management errors.
+// Ret is nil if the device didn't send it.
 type ShellExecRsp struct {
 	NmpBase `codec:"-"`
 	O       string `codec:"o"`
 	Rc      int    `codec:"rc"`
+	Ret     *int   `codec:"ret,omitempty"`
 }
 
 func NewShellExecReq() *ShellExecReq {
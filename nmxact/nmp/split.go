@@ -0,0 +1,113 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmp
+
+import (
+	"fmt"
+)
+
+type SplitMode int
+
+const (
+	SPLIT_MODE_NONE SplitMode = iota
+	SPLIT_MODE_TEST
+	SPLIT_MODE_RUN
+)
+
+var splitModeNameMap = map[SplitMode]string{
+	SPLIT_MODE_NONE: "none",
+	SPLIT_MODE_TEST: "test",
+	SPLIT_MODE_RUN:  "run",
+}
+
+func (sm SplitMode) String() string {
+	str := splitModeNameMap[sm]
+	if str == "" {
+		return "Unknown!"
+	}
+	return str
+}
+
+func SplitModeFromString(s string) (SplitMode, error) {
+	for k, v := range splitModeNameMap {
+		if s == v {
+			return k, nil
+		}
+	}
+
+	return SplitMode(0), fmt.Errorf("Invalid split mode: %s", s)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $read                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+type SplitReadReq struct {
+	NmpBase `codec:"-"`
+}
+
+type SplitReadRsp struct {
+	NmpBase
+	Rc     int         `codec:"rc"`
+	Mode   SplitMode   `codec:"splitMode"`
+	Status SplitStatus `codec:"splitStatus"`
+}
+
+func NewSplitReadReq() *SplitReadReq {
+	r := &SplitReadReq{}
+	fillNmpReq(r, NMP_OP_READ, NMP_GROUP_SPLIT, NMP_ID_SPLIT_SPLIT)
+	return r
+}
+
+func (r *SplitReadReq) Msg() *NmpMsg { return MsgFromReq(r) }
+
+func NewSplitReadRsp() *SplitReadRsp {
+	return &SplitReadRsp{}
+}
+
+func (r *SplitReadRsp) Msg() *NmpMsg { return MsgFromReq(r) }
+
+//////////////////////////////////////////////////////////////////////////////
+// $write                                                                   //
+//////////////////////////////////////////////////////////////////////////////
+
+type SplitWriteReq struct {
+	NmpBase `codec:"-"`
+	Mode    SplitMode `codec:"splitMode"`
+}
+
+type SplitWriteRsp struct {
+	NmpBase
+	Rc int `codec:"rc"`
+}
+
+func NewSplitWriteReq() *SplitWriteReq {
+	r := &SplitWriteReq{}
+	fillNmpReq(r, NMP_OP_WRITE, NMP_GROUP_SPLIT, NMP_ID_SPLIT_SPLIT)
+	return r
+}
+
+func (r *SplitWriteReq) Msg() *NmpMsg { return MsgFromReq(r) }
+
+func NewSplitWriteRsp() *SplitWriteRsp {
+	return &SplitWriteRsp{}
+}
+
+func (r *SplitWriteRsp) Msg() *NmpMsg { return MsgFromReq(r) }
@@ -52,6 +52,24 @@ func NewStatReadRsp() *StatReadRsp {
 
 func (r *StatReadRsp) Msg() *NmpMsg { return MsgFromReq(r) }
 
+// Returns the value of the named field as an unsigned integer.  Stat values
+// are decoded as either signed or unsigned integers depending on their
+// magnitude; negative values are reported as 0.  The second return value is
+// false if the field is absent or is not an integer.
+func (r *StatReadRsp) FieldUint64(name string) (uint64, bool) {
+	switch n := r.Fields[name].(type) {
+	case uint64:
+		return n, true
+	case int64:
+		if n < 0 {
+			return 0, true
+		}
+		return uint64(n), true
+	default:
+		return 0, false
+	}
+}
+
 //////////////////////////////////////////////////////////////////////////////
 // $list                                                                    //
 //////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,97 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmsim
+
+import (
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+)
+
+// SetConfig sets the value of a config setting.  If save is true, the value
+// is persisted and survives reboots.
+func (d *Device) SetConfig(name string, val string, save bool) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.cfgVals[name] = val
+	if save {
+		d.cfgSave[name] = val
+	}
+}
+
+// Config retrieves the current value of a config setting.
+func (d *Device) Config(name string) (string, bool) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	val, ok := d.cfgVals[name]
+	return val, ok
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $read                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+func configRead(d *Device, body []byte) interface{} {
+	var req nmp.ConfigReadReq
+	if err := decodeReq(body, &req); err != nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	val, ok := d.cfgVals[req.Name]
+	if !ok {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	rsp := nmp.NewConfigReadRsp()
+	rsp.Val = val
+
+	return rsp
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $write                                                                   //
+//////////////////////////////////////////////////////////////////////////////
+
+func configWrite(d *Device, body []byte) interface{} {
+	var req nmp.ConfigWriteReq
+	if err := decodeReq(body, &req); err != nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	if req.Name != "" {
+		// Only settings the device knows about can be written.
+		if _, ok := d.cfgVals[req.Name]; !ok {
+			return rcRsp(nmp.NMP_ERR_EINVAL)
+		}
+		d.cfgVals[req.Name] = req.Val
+	}
+
+	if req.Save {
+		if req.Name != "" {
+			d.cfgSave[req.Name] = req.Val
+		} else {
+			for k, v := range d.cfgVals {
+				d.cfgSave[k] = v
+			}
+		}
+	}
+
+	return nmp.NewConfigWriteRsp()
+}
@@ -0,0 +1,69 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmsim
+
+import (
+	"encoding/binary"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+)
+
+const COREDUMP_MAGIC = 0x690c47c3
+
+// Reboot reason reported for each crash type.
+var crashRebootRsn = map[string]string{
+	"div0":   "ASSERT",
+	"jump0":  "ASSERT",
+	"ref0":   "ASSERT",
+	"assert": "ASSERT",
+	"wdog":   "WDOG",
+}
+
+// buildCoreDump produces a fake core file describing a crash of the
+// specified type.
+func buildCoreDump(crashType string) []byte {
+	desc := []byte("simulated crash: " + crashType)
+
+	core := make([]byte, 8)
+	binary.LittleEndian.PutUint32(core[0:], COREDUMP_MAGIC)
+	binary.LittleEndian.PutUint32(core[4:], uint32(8+len(desc)))
+
+	return append(core, desc...)
+}
+
+func crash(d *Device, body []byte) interface{} {
+	var req nmp.CrashReq
+	if err := decodeReq(body, &req); err != nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	rsn, ok := crashRebootRsn[req.CrashType]
+	if !ok {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	// A wdog reset does not produce a core dump.
+	if req.CrashType != "wdog" {
+		d.core = buildCoreDump(req.CrashType)
+	}
+	d.rebootRsn = rsn
+
+	return nmp.NewCrashRsp()
+}
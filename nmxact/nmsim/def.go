@@ -0,0 +1,212 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmsim
+
+import (
+	"time"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+)
+
+// Task describes a simulated OS task.  The task's run time and context
+// switch count advance in proportion to its load (0.0 - 1.0).
+type Task struct {
+	Name        string
+	Prio        int
+	StackSize   int
+	StackUse    int
+	Load        float64
+	LastCheckin int
+	NextCheckin int
+}
+
+// Mempool describes a simulated memory pool.
+type Mempool struct {
+	Name      string
+	BlockSize int
+	NumBlocks int
+	NumFree   int
+	MinFree   int
+}
+
+// Layouts accepted when the client sets the device's date and time.
+var dateTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+}
+
+// Layout used when reporting the device's date and time.
+const DATETIME_LAYOUT = "2006-01-02T15:04:05.000000-07:00"
+
+// AddTask adds a task to the simulated device.
+func (d *Device) AddTask(t Task) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.tasks = append(d.tasks, &t)
+}
+
+// AddMempool adds a memory pool to the simulated device.
+func (d *Device) AddMempool(mp Mempool) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.mpools = append(d.mpools, &mp)
+}
+
+// SetMempoolFree changes the number of free blocks in the named memory pool.
+// The pool's low water mark is updated accordingly.
+func (d *Device) SetMempoolFree(name string, nfree int) bool {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	for _, mp := range d.mpools {
+		if mp.Name == name {
+			mp.NumFree = nfree
+			if nfree < mp.MinFree {
+				mp.MinFree = nfree
+			}
+			return true
+		}
+	}
+
+	return false
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $echo                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+func echo(d *Device, body []byte) interface{} {
+	var req nmp.EchoReq
+	if err := decodeReq(body, &req); err != nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	rsp := nmp.NewEchoRsp()
+	rsp.Payload = req.Payload
+
+	return rsp
+}
+
+// ConsoleEcho indicates whether the device's console echoes received
+// characters.
+func (d *Device) ConsoleEcho() bool {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	return d.consEcho
+}
+
+func consEchoCtrl(d *Device, body []byte) interface{} {
+	var req nmp.ConsEchoCtrlReq
+	if err := decodeReq(body, &req); err != nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	d.consEcho = req.Echo != 0
+
+	return nmp.NewConsEchoCtrlRsp()
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $taskstat                                                                //
+//////////////////////////////////////////////////////////////////////////////
+
+func taskStat(d *Device, body []byte) interface{} {
+	ms := float64(d.uptime() / time.Millisecond)
+
+	rsp := nmp.NewTaskStatRsp()
+	rsp.Tasks = map[string]map[string]int{}
+
+	for i, t := range d.tasks {
+		rsp.Tasks[t.Name] = map[string]int{
+			"prio":         t.Prio,
+			"tid":          i,
+			"state":        1,
+			"stkuse":       t.StackUse,
+			"stksiz":       t.StackSize,
+			"cswcnt":       int(ms * t.Load / 10),
+			"runtime":      int(ms * t.Load),
+			"last_checkin": t.LastCheckin,
+			"next_checkin": t.NextCheckin,
+		}
+	}
+
+	return rsp
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $mpstat                                                                  //
+//////////////////////////////////////////////////////////////////////////////
+
+func mempoolStat(d *Device, body []byte) interface{} {
+	rsp := nmp.NewMempoolStatRsp()
+	rsp.Mpools = map[string]map[string]int{}
+
+	for _, mp := range d.mpools {
+		rsp.Mpools[mp.Name] = map[string]int{
+			"blksiz": mp.BlockSize,
+			"nblks":  mp.NumBlocks,
+			"nfree":  mp.NumFree,
+			"min":    mp.MinFree,
+		}
+	}
+
+	return rsp
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $datetime                                                                //
+//////////////////////////////////////////////////////////////////////////////
+
+func dateTimeRead(d *Device, body []byte) interface{} {
+	rsp := nmp.NewDateTimeReadRsp()
+	rsp.DateTime = d.now().Format(DATETIME_LAYOUT)
+
+	return rsp
+}
+
+func dateTimeWrite(d *Device, body []byte) interface{} {
+	var req nmp.DateTimeWriteReq
+	if err := decodeReq(body, &req); err != nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	for _, layout := range dateTimeLayouts {
+		t, err := time.Parse(layout, req.DateTime)
+		if err == nil {
+			d.clockBase = t
+			d.clockSet = time.Now()
+			return nmp.NewDateTimeWriteRsp()
+		}
+	}
+
+	return rcRsp(nmp.NMP_ERR_EINVAL)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $reset                                                                   //
+//////////////////////////////////////////////////////////////////////////////
+
+func reset(d *Device, body []byte) interface{} {
+	d.rebootRsn = "SOFT"
+	return nmp.NewResetRsp()
+}
@@ -0,0 +1,240 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package nmsim implements an in-process simulated Mynewt device.  The
+// simulated device answers newtmgr requests for the default, image, stat,
+// config, log, crash, run, fs, and shell groups.  All device state (flash
+// slots, file system, statistics, logs, etc.) is kept in memory.
+package nmsim
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+)
+
+// Device is a simulated Mynewt device.  A single device can be shared by any
+// number of sessions; all accesses to device state are serialized.
+type Device struct {
+	mtx sync.Mutex
+
+	// Number of times the device has booted.
+	bootCnt int
+
+	// Host time at which the device last booted.
+	bootTime time.Time
+
+	// Amount of time the device takes to boot, and the host time at which
+	// the current boot completes.  Requests that arrive while the device is
+	// booting are ignored.
+	bootDelay time.Duration
+	bootDone  time.Time
+
+	// The device clock is clockBase at host time clockSet.
+	clockBase time.Time
+	clockSet  time.Time
+
+	// If non-empty, the device reboots with this reason once the current
+	// response has been sent.
+	rebootRsn string
+
+	// The highest NMP protocol version that the device supports.
+	nmpVer uint8
+
+	slots  [2]imageSlot
+	upload *imageUploadState
+	core   []byte
+
+	splitMode nmp.SplitMode
+	consEcho  bool
+
+	files   map[string][]byte
+	dirs    map[string]bool
+	fsUp    *fsUploadState
+	stats   []*statGroup
+	cfgVals map[string]string
+	cfgSave map[string]string
+	logs    []*simLog
+	logIdx  uint32
+	logMods map[string]int
+	logLvls map[string]int
+	tests   []runTest
+	shell   map[string]ShellCmdFn
+	tasks   []*Task
+	mpools  []*Mempool
+}
+
+// NewDevice creates a simulated device running a small version 1.0.0 image.  The device
+// comes up with a default set of logs, statistics, tasks, memory pools, and
+// shell commands; callers can add more before opening any sessions.
+func NewDevice() *Device {
+	d := &Device{
+		files:   map[string][]byte{},
+		dirs:    map[string]bool{},
+		cfgVals: map[string]string{},
+		cfgSave: map[string]string{},
+		shell:   map[string]ShellCmdFn{},
+		nmpVer:  nmp.NMP_VER_2,
+	}
+
+	d.logs = []*simLog{
+		newSimLog("reboot_log", nmp.STORAGE_LOG),
+		newSimLog("log", nmp.MEMORY_LOG),
+	}
+
+	d.logMods = map[string]int{}
+	for id, name := range nmp.LogModuleNameMap {
+		d.logMods[name] = id
+	}
+	d.logLvls = map[string]int{}
+	for id, name := range nmp.LogLevelNameMap {
+		d.logLvls[name] = id
+	}
+
+	d.stats = []*statGroup{
+		newStatGroup(STAT_GROUP_MGMT, STAT_MGMT_RX, STAT_MGMT_TX,
+			STAT_MGMT_ERR),
+	}
+
+	d.tasks = []*Task{
+		{Name: "idle", Prio: 255, StackSize: 64, StackUse: 28, Load: 0.9},
+		{Name: "main", Prio: 127, StackSize: 1024, StackUse: 300, Load: 0.1},
+	}
+
+	d.mpools = []*Mempool{
+		{Name: "msys_1", BlockSize: 292, NumBlocks: 12, NumFree: 12,
+			MinFree: 12},
+	}
+
+	d.shell["echo"] = shellEcho
+	d.shell["help"] = d.shellHelp
+
+	d.slots[0] = newImageSlot(BuildImage(ImageVersion{Major: 1},
+		[]byte("nmsim default image")))
+	d.slots[0].confirmed = true
+
+	d.boot(nmp.MODULE_REBOOT, "HARD")
+
+	return d
+}
+
+// boot resets all volatile device state.  It must be called with the device
+// lock held.
+func (d *Device) boot(module int, reason string) {
+	d.swapSlots()
+
+	d.bootCnt++
+	d.bootTime = time.Now()
+	d.bootDone = d.bootTime.Add(d.bootDelay)
+	d.clockBase = time.Unix(0, 0).UTC()
+	d.clockSet = d.bootTime
+
+	d.upload = nil
+	d.fsUp = nil
+	d.consEcho = true
+
+	// A split application under test only runs for a single boot.
+	if d.splitMode == nmp.SPLIT_MODE_TEST {
+		d.splitMode = nmp.SPLIT_MODE_NONE
+	}
+
+	for _, sg := range d.stats {
+		sg.clear()
+	}
+
+	d.cfgVals = map[string]string{}
+	for k, v := range d.cfgSave {
+		d.cfgVals[k] = v
+	}
+
+	for _, l := range d.logs {
+		if l.typ == nmp.MEMORY_LOG {
+			l.entries = nil
+		}
+	}
+
+	d.appendLog("reboot_log", module, nmp.LEVEL_CRITICAL,
+		fmt.Sprintf("rsn:%s, cnt:%d, img:%s", reason, d.bootCnt,
+			d.slots[0].version))
+}
+
+// now returns the current value of the device's clock.
+func (d *Device) now() time.Time {
+	return d.clockBase.Add(time.Since(d.clockSet))
+}
+
+// Clock returns the current value of the device's clock.
+func (d *Device) Clock() time.Time {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	return d.now()
+}
+
+// uptime returns the amount of time that has elapsed since the device last
+// booted.
+func (d *Device) uptime() time.Duration {
+	return time.Since(d.bootTime)
+}
+
+// Reboot simulates a soft reset of the device.
+func (d *Device) Reboot() {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.boot(nmp.MODULE_REBOOT, "SOFT")
+}
+
+// SetNmpVer sets the highest NMP protocol version that the device supports.
+// A version 1 device ignores the version bits in request headers, as older
+// firmware does.
+func (d *Device) SetNmpVer(ver uint8) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.nmpVer = ver
+}
+
+// SetBootDelay sets the amount of time the device takes to boot, starting
+// with the next boot.  The device doesn't respond to requests until it has
+// finished booting.
+func (d *Device) SetBootDelay(delay time.Duration) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.bootDelay = delay
+}
+
+// booting indicates whether the device is still booting.
+func (d *Device) booting() bool {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	return time.Now().Before(d.bootDone)
+}
+
+// BootCount returns the number of times the device has booted.
+func (d *Device) BootCount() int {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	return d.bootCnt
+}
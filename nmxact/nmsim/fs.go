@@ -0,0 +1,388 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmsim
+
+import (
+	"crypto/sha256"
+	"hash/crc32"
+	"path"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+)
+
+// Maximum amount of file data returned in a single download response.
+const FS_DOWNLOAD_MAX_CHUNK = 512
+
+// Maximum number of directory entries returned in a single ls response.
+const FS_LS_MAX_ENTRIES = 8
+
+type fsUploadState struct {
+	name string
+	len  int
+}
+
+// WriteFile creates or replaces a file in the simulated file system.
+func (d *Device) WriteFile(name string, data []byte) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.files[name] = append([]byte(nil), data...)
+}
+
+// ReadFile retrieves the contents of a file in the simulated file system.
+func (d *Device) ReadFile(name string) ([]byte, bool) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	data, ok := d.files[name]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), data...), true
+}
+
+// fsPath normalizes an absolute path.  It returns "" if the path is not
+// absolute.
+func fsPath(name string) string {
+	if !strings.HasPrefix(name, "/") {
+		return ""
+	}
+	return path.Clean(name)
+}
+
+// isDir indicates whether the specified normalized path is a directory.
+// Directories are either created explicitly or implied by the files they
+// contain.
+func (d *Device) isDir(name string) bool {
+	if name == "/" || d.dirs[name] {
+		return true
+	}
+
+	prefix := name + "/"
+	for f := range d.files {
+		if strings.HasPrefix(f, prefix) {
+			return true
+		}
+	}
+	for dir := range d.dirs {
+		if strings.HasPrefix(dir, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dirChild returns the entry of a directory that contains the specified
+// path, or "" if the path is not inside the directory.
+func dirChild(dir string, p string) string {
+	if !strings.HasPrefix(p, "/") {
+		return ""
+	}
+
+	for p != "/" {
+		parent := path.Dir(p)
+		if parent == dir {
+			return p
+		}
+		p = parent
+	}
+
+	return ""
+}
+
+// dirEntries lists the contents of a directory, sorted by name.
+func (d *Device) dirEntries(dir string) []nmp.FsEntry {
+	m := map[string]nmp.FsEntry{}
+
+	add := func(p string) {
+		child := dirChild(dir, p)
+		if child == "" {
+			return
+		}
+
+		name := path.Base(child)
+		if data, ok := d.files[child]; ok {
+			m[name] = nmp.FsEntry{
+				Name: name,
+				Type: nmp.FS_ENTRY_TYPE_FILE,
+				Len:  uint32(len(data)),
+			}
+		} else {
+			m[name] = nmp.FsEntry{
+				Name: name,
+				Type: nmp.FS_ENTRY_TYPE_DIR,
+			}
+		}
+	}
+
+	for f := range d.files {
+		add(f)
+	}
+	for sub := range d.dirs {
+		add(sub)
+	}
+
+	entries := make([]nmp.FsEntry, 0, len(m))
+	for _, e := range m {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+
+	return entries
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $download                                                                //
+//////////////////////////////////////////////////////////////////////////////
+
+func fsDownload(d *Device, body []byte) interface{} {
+	var req nmp.FsDownloadReq
+	if err := decodeReq(body, &req); err != nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	data, ok := d.files[req.Name]
+	if !ok {
+		return rcRsp(nmp.NMP_ERR_ENOENT)
+	}
+	if int(req.Off) > len(data) {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	end := int(req.Off) + FS_DOWNLOAD_MAX_CHUNK
+	if end > len(data) {
+		end = len(data)
+	}
+
+	rsp := nmp.NewFsDownloadRsp()
+	rsp.Off = req.Off
+	if req.Off == 0 {
+		rsp.Len = uint32(len(data))
+	}
+	rsp.Data = data[req.Off:end]
+
+	return rsp
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $upload                                                                  //
+//////////////////////////////////////////////////////////////////////////////
+
+func fsUpload(d *Device, body []byte) interface{} {
+	var req nmp.FsUploadReq
+	if err := decodeReq(body, &req); err != nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	if req.Name == "" {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	if req.Off == 0 {
+		d.files[req.Name] = []byte{}
+		d.fsUp = &fsUploadState{
+			name: req.Name,
+			len:  int(req.Len),
+		}
+	}
+
+	u := d.fsUp
+	if u == nil || u.name != req.Name {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	rsp := nmp.NewFsUploadRsp()
+
+	data := d.files[u.name]
+	if int(req.Off) != len(data) {
+		// Unexpected offset; tell the client what we need next.
+		rsp.Off = uint32(len(data))
+		return rsp
+	}
+
+	if len(data)+len(req.Data) > u.len {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	data = append(data, req.Data...)
+	d.files[u.name] = data
+	if len(data) == u.len {
+		d.fsUp = nil
+	}
+
+	rsp.Off = uint32(len(data))
+	return rsp
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $stat                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+func fsStat(d *Device, body []byte) interface{} {
+	var req nmp.FsStatReq
+	if err := decodeReq(body, &req); err != nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	data, ok := d.files[fsPath(req.Name)]
+	if !ok {
+		return rcRsp(nmp.NMP_ERR_ENOENT)
+	}
+
+	rsp := nmp.NewFsStatRsp()
+	rsp.Len = uint32(len(data))
+
+	return rsp
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $hash                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+func fsHash(d *Device, body []byte) interface{} {
+	var req nmp.FsHashReq
+	if err := decodeReq(body, &req); err != nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	data, ok := d.files[fsPath(req.Name)]
+	if !ok {
+		return rcRsp(nmp.NMP_ERR_ENOENT)
+	}
+	if int(req.Off) > len(data) {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	end := len(data)
+	if req.Len != 0 && int(req.Off+req.Len) < end {
+		end = int(req.Off + req.Len)
+	}
+	data = data[req.Off:end]
+
+	rsp := nmp.NewFsHashRsp()
+	rsp.Type = req.Type
+	rsp.Off = req.Off
+	rsp.Len = uint32(len(data))
+
+	switch req.Type {
+	case "", nmp.FS_HASH_CRC32:
+		rsp.Type = nmp.FS_HASH_CRC32
+		rsp.Output = crc32.ChecksumIEEE(data)
+
+	case nmp.FS_HASH_SHA256:
+		sum := sha256.Sum256(data)
+		rsp.Output = sum[:]
+
+	default:
+		return rcRsp(nmp.NMP_ERR_ENOTSUP)
+	}
+
+	return rsp
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $ls                                                                      //
+//////////////////////////////////////////////////////////////////////////////
+
+func fsLs(d *Device, body []byte) interface{} {
+	var req nmp.FsLsReq
+	if err := decodeReq(body, &req); err != nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	dir := fsPath(req.Name)
+	if dir == "" || !d.isDir(dir) {
+		return rcRsp(nmp.NMP_ERR_ENOENT)
+	}
+
+	entries := d.dirEntries(dir)
+	if int(req.Off) > len(entries) {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+	entries = entries[req.Off:]
+	if len(entries) > FS_LS_MAX_ENTRIES {
+		entries = entries[:FS_LS_MAX_ENTRIES]
+	}
+
+	rsp := nmp.NewFsLsRsp()
+	rsp.Entries = entries
+
+	return rsp
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $unlink                                                                  //
+//////////////////////////////////////////////////////////////////////////////
+
+func fsUnlink(d *Device, body []byte) interface{} {
+	var req nmp.FsUnlinkReq
+	if err := decodeReq(body, &req); err != nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	name := fsPath(req.Name)
+	if _, ok := d.files[name]; ok {
+		delete(d.files, name)
+		return nmp.NewFsUnlinkRsp()
+	}
+
+	if name == "" || !d.isDir(name) {
+		return rcRsp(nmp.NMP_ERR_ENOENT)
+	}
+
+	// Only empty directories can be removed.
+	if name == "/" || len(d.dirEntries(name)) > 0 {
+		return rcRsp(nmp.NMP_ERR_EBADSTATE)
+	}
+	delete(d.dirs, name)
+
+	return nmp.NewFsUnlinkRsp()
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $mkdir                                                                   //
+//////////////////////////////////////////////////////////////////////////////
+
+func fsMkdir(d *Device, body []byte) interface{} {
+	var req nmp.FsMkdirReq
+	if err := decodeReq(body, &req); err != nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	name := fsPath(req.Name)
+	if name == "" {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+	if _, ok := d.files[name]; ok || d.isDir(name) {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+	if !d.isDir(path.Dir(name)) {
+		return rcRsp(nmp.NMP_ERR_ENOENT)
+	}
+
+	d.dirs[name] = true
+
+	return nmp.NewFsMkdirRsp()
+}
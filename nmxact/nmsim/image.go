@@ -0,0 +1,393 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmsim
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmimage"
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// $defs                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+// Maximum size of an image that fits in a flash slot.
+const IMAGE_SLOT_SIZE = 1024 * 1024
+
+// Maximum amount of core dump data returned in a single response.
+const CORE_LOAD_MAX_CHUNK = 512
+
+// ImageVersion is the version number in an image header.
+type ImageVersion = nmimage.ImageVersion
+
+type imageSlot struct {
+	data      []byte
+	hash      []byte
+	version   ImageVersion
+	bootable  bool
+	pending   bool
+	permanent bool
+	confirmed bool
+}
+
+type imageUploadState struct {
+	data []byte
+	off  int
+	sha  []byte
+}
+
+// BuildImage produces a minimal Mynewt image containing the specified body.
+// The image consists of a header, the body, and a SHA256 TLV.
+func BuildImage(ver ImageVersion, body []byte) []byte {
+	hdr := make([]byte, nmimage.IMAGE_HEADER_SIZE)
+	binary.LittleEndian.PutUint32(hdr[0:], nmimage.IMAGE_HEADER_MAGIC)
+	binary.LittleEndian.PutUint16(hdr[8:], nmimage.IMAGE_HEADER_SIZE)
+	binary.LittleEndian.PutUint32(hdr[12:], uint32(len(body)))
+	hdr[20] = ver.Major
+	hdr[21] = ver.Minor
+	binary.LittleEndian.PutUint16(hdr[22:], ver.Rev)
+	binary.LittleEndian.PutUint32(hdr[24:], ver.BuildNum)
+
+	img := append(hdr, body...)
+	hash := sha256.Sum256(img)
+
+	tlv := make([]byte, 8)
+	binary.LittleEndian.PutUint16(tlv[0:], nmimage.IMAGE_TLV_INFO_MAGIC)
+	binary.LittleEndian.PutUint16(tlv[2:], uint16(4+4+len(hash)))
+	tlv[4] = nmimage.IMAGE_TLV_SHA256
+	binary.LittleEndian.PutUint16(tlv[6:], uint16(len(hash)))
+
+	img = append(img, tlv...)
+	img = append(img, hash[:]...)
+
+	return img
+}
+
+// imageHash retrieves an image's SHA256 TLV.  If the data is not a valid
+// image, the hash of the full data is returned instead.
+func imageHash(data []byte) []byte {
+	if img, err := nmimage.ParseImage(data); err == nil {
+		if hash, err := img.Hash(); err == nil {
+			return hash
+		}
+	}
+
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
+
+func newImageSlot(data []byte) imageSlot {
+	hdr, _ := nmimage.ParseImageHdr(data)
+
+	return imageSlot{
+		data:     data,
+		hash:     imageHash(data),
+		version:  hdr.Vers,
+		bootable: hdr.Flags&nmimage.IMAGE_F_NON_BOOTABLE == 0,
+	}
+}
+
+// slot1Busy indicates whether the secondary slot contents are needed by the
+// boot loader (i.e., the image is pending, or it is the fallback image for an
+// image being tested).
+func (d *Device) slot1Busy() bool {
+	return d.slots[1].pending ||
+		(d.slots[1].data != nil && !d.slots[0].confirmed)
+}
+
+// swapSlots emulates the boot loader.  A pending image in the secondary slot
+// is swapped into the primary slot; an unconfirmed test image is reverted.
+// It must be called with the device lock held.
+func (d *Device) swapSlots() {
+	s0 := &d.slots[0]
+	s1 := &d.slots[1]
+
+	if s1.pending && s1.data != nil {
+		perm := s1.permanent
+		*s0, *s1 = *s1, *s0
+		s0.pending = false
+		s0.permanent = false
+		s0.confirmed = perm
+		s1.confirmed = false
+	} else if s1.data != nil && !s0.confirmed {
+		*s0, *s1 = *s1, *s0
+		s0.confirmed = true
+		s1.confirmed = false
+	}
+}
+
+// SetImage writes an image to the specified slot (0 or 1).  Writing to slot 0
+// replaces the running image; it takes effect immediately and is marked as
+// confirmed.
+func (d *Device) SetImage(slot int, data []byte) error {
+	if slot < 0 || slot >= len(d.slots) {
+		return fmt.Errorf("invalid image slot: %d", slot)
+	}
+	if len(data) > IMAGE_SLOT_SIZE {
+		return fmt.Errorf("image too large for slot: %d > %d",
+			len(data), IMAGE_SLOT_SIZE)
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.slots[slot] = newImageSlot(append([]byte(nil), data...))
+	if slot == 0 {
+		d.slots[0].confirmed = true
+	}
+
+	return nil
+}
+
+// Image returns a copy of the contents of the specified slot.
+func (d *Device) Image(slot int) []byte {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if slot < 0 || slot >= len(d.slots) {
+		return nil
+	}
+	return append([]byte(nil), d.slots[slot].data...)
+}
+
+// SetCoreDump installs a core dump, replacing any existing one.
+func (d *Device) SetCoreDump(core []byte) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.core = append([]byte(nil), core...)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $state                                                                   //
+//////////////////////////////////////////////////////////////////////////////
+
+func (d *Device) imageStateRsp() *nmp.ImageStateRsp {
+	rsp := nmp.NewImageStateRsp()
+	rsp.Images = []nmp.ImageStateEntry{}
+
+	for i, s := range d.slots {
+		if s.data == nil {
+			continue
+		}
+		rsp.Images = append(rsp.Images, nmp.ImageStateEntry{
+			Image:     0,
+			Slot:      i,
+			Version:   s.version.String(),
+			Hash:      s.hash,
+			Bootable:  s.bootable,
+			Pending:   s.pending,
+			Confirmed: s.confirmed,
+			Active:    i == 0,
+			Permanent: s.permanent,
+		})
+	}
+	rsp.SplitStatus = nmp.NOT_APPLICABLE
+
+	return rsp
+}
+
+func imageStateRead(d *Device, body []byte) interface{} {
+	return d.imageStateRsp()
+}
+
+func imageStateWrite(d *Device, body []byte) interface{} {
+	var req nmp.ImageStateWriteReq
+	if err := decodeReq(body, &req); err != nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	if len(req.Hash) == 0 {
+		if !req.Confirm {
+			return rcRsp(nmp.NMP_ERR_EINVAL)
+		}
+		// Confirm the running image.
+		d.slots[0].confirmed = true
+		return d.imageStateRsp()
+	}
+
+	switch {
+	case d.slots[0].data != nil && bytes.Equal(req.Hash, d.slots[0].hash):
+		if !req.Confirm {
+			return rcRsp(nmp.NMP_ERR_EINVAL)
+		}
+		d.slots[0].confirmed = true
+
+	case d.slots[1].data != nil && bytes.Equal(req.Hash, d.slots[1].hash):
+		if !d.slots[1].bootable {
+			return rcRsp(nmp.NMP_ERR_EINVAL)
+		}
+		d.slots[1].pending = true
+		d.slots[1].permanent = req.Confirm
+
+	default:
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	return d.imageStateRsp()
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $upload                                                                  //
+//////////////////////////////////////////////////////////////////////////////
+
+func imageUpload(d *Device, body []byte) interface{} {
+	var req nmp.ImageUploadReq
+	if err := decodeReq(body, &req); err != nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	if req.ImageNum != 0 {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	rsp := nmp.NewImageUploadRsp()
+
+	if req.Off == 0 {
+		if d.slot1Busy() {
+			return rcRsp(nmp.NMP_ERR_EBADSTATE)
+		}
+		if req.Len == 0 || req.Len > IMAGE_SLOT_SIZE {
+			return rcRsp(nmp.NMP_ERR_EINVAL)
+		}
+
+		// If this is a continuation of an interrupted upload, tell the
+		// client where to resume from.
+		u := d.upload
+		if u != nil && len(req.DataSha) > 0 &&
+			bytes.Equal(u.sha, req.DataSha) && len(u.data) == int(req.Len) {
+
+			rsp.Off = uint32(u.off)
+			return rsp
+		}
+
+		if req.Upgrade {
+			hdr, err := nmimage.ParseImageHdr(req.Data)
+			if err != nil || hdr.Vers.Compare(d.slots[0].version) <= 0 {
+				return rcRsp(nmp.NMP_ERR_EBADSTATE)
+			}
+		}
+
+		d.slots[1] = imageSlot{}
+		d.upload = &imageUploadState{
+			data: make([]byte, req.Len),
+			sha:  req.DataSha,
+		}
+	}
+
+	u := d.upload
+	if u == nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	if int(req.Off) != u.off {
+		// Unexpected offset; tell the client what we need next.
+		rsp.Off = uint32(u.off)
+		return rsp
+	}
+
+	if u.off+len(req.Data) > len(u.data) {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	copy(u.data[u.off:], req.Data)
+	u.off += len(req.Data)
+
+	// Like the real image manager, keep the final offset around after the
+	// upload completes so that a retransmitted last chunk is acknowledged
+	// rather than rejected.
+	if u.off == len(u.data) {
+		d.slots[1] = newImageSlot(u.data)
+	}
+
+	rsp.Off = uint32(u.off)
+	return rsp
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $erase                                                                   //
+//////////////////////////////////////////////////////////////////////////////
+
+func imageErase(d *Device, body []byte) interface{} {
+	if d.slot1Busy() {
+		return rcRsp(nmp.NMP_ERR_EBADSTATE)
+	}
+
+	d.slots[1] = imageSlot{}
+	d.upload = nil
+
+	return nmp.NewImageEraseRsp()
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $corelist                                                                //
+//////////////////////////////////////////////////////////////////////////////
+
+func coreList(d *Device, body []byte) interface{} {
+	if d.core == nil {
+		return rcRsp(nmp.NMP_ERR_ENOENT)
+	}
+
+	return nmp.NewCoreListRsp()
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $coreload                                                                //
+//////////////////////////////////////////////////////////////////////////////
+
+func coreLoad(d *Device, body []byte) interface{} {
+	var req nmp.CoreLoadReq
+	if err := decodeReq(body, &req); err != nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	if d.core == nil {
+		return rcRsp(nmp.NMP_ERR_ENOENT)
+	}
+	if int(req.Off) > len(d.core) {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	end := int(req.Off) + CORE_LOAD_MAX_CHUNK
+	if end > len(d.core) {
+		end = len(d.core)
+	}
+
+	rsp := nmp.NewCoreLoadRsp()
+	rsp.Off = req.Off
+	rsp.Len = uint32(len(d.core))
+	rsp.Data = d.core[req.Off:end]
+
+	return rsp
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $coreerase                                                               //
+//////////////////////////////////////////////////////////////////////////////
+
+func coreErase(d *Device, body []byte) interface{} {
+	d.core = nil
+	return nmp.NewCoreEraseRsp()
+}
@@ -0,0 +1,264 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmsim
+
+import (
+	"fmt"
+	"time"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+)
+
+// Approximate number of bytes of log entries returned in a single log show
+// response.  If more entries are available, the response indicates this
+// with a status of 1.
+const LOG_SHOW_MAX_BYTES = 400
+
+// Approximate encoded size of a log entry, excluding its message.
+const LOG_ENTRY_OVERHEAD = 40
+
+type simLog struct {
+	name    string
+	typ     int
+	entries []nmp.LogEntry
+}
+
+func newSimLog(name string, typ int) *simLog {
+	return &simLog{
+		name: name,
+		typ:  typ,
+	}
+}
+
+func (d *Device) findLog(name string) *simLog {
+	for _, l := range d.logs {
+		if l.name == name {
+			return l
+		}
+	}
+
+	return nil
+}
+
+// appendLogEntry adds an entry to the named log.  It must be called with the
+// device lock held.
+func (d *Device) appendLogEntry(name string, module int, level int,
+	typ nmp.LogEntryType, msg []byte) error {
+
+	l := d.findLog(name)
+	if l == nil {
+		return fmt.Errorf("unknown log: %s", name)
+	}
+
+	e := nmp.LogEntry{
+		Index:     d.logIdx,
+		Timestamp: d.now().UnixNano() / int64(time.Microsecond),
+		Module:    uint8(module),
+		Level:     uint8(level),
+		Type:      typ,
+		Msg:       msg,
+	}
+	if len(d.slots[0].hash) >= 4 {
+		e.ImgHash = d.slots[0].hash[:4]
+	}
+
+	d.logIdx++
+	l.entries = append(l.entries, e)
+
+	return nil
+}
+
+// appendLog adds a string entry to the named log.  It must be called with
+// the device lock held.
+func (d *Device) appendLog(name string, module int, level int, msg string) {
+	d.appendLogEntry(name, module, level, nmp.LOG_ENTRY_TYPE_STRING,
+		[]byte(msg))
+}
+
+// AddLog creates an empty log of the specified type (nmp.STREAM_LOG,
+// nmp.MEMORY_LOG, or nmp.STORAGE_LOG).  Memory logs are cleared whenever
+// the device reboots.
+func (d *Device) AddLog(name string, typ int) error {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if d.findLog(name) != nil {
+		return fmt.Errorf("duplicate log: %s", name)
+	}
+
+	d.logs = append(d.logs, newSimLog(name, typ))
+	return nil
+}
+
+// AddLogModule defines a log module that the device reports in its module
+// list.
+func (d *Device) AddLogModule(id int, name string) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.logMods[name] = id
+}
+
+// AddLogLevel defines a log level that the device reports in its level list.
+func (d *Device) AddLogLevel(id int, name string) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.logLvls[name] = id
+}
+
+// AppendLog adds an entry to the named log.  The entry is timestamped with
+// the device's current time.
+func (d *Device) AppendLog(name string, module int, level int,
+	typ nmp.LogEntryType, msg []byte) error {
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	return d.appendLogEntry(name, module, level, typ,
+		append([]byte(nil), msg...))
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $show                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+func logShow(d *Device, body []byte) interface{} {
+	var req nmp.LogShowReq
+	if err := decodeReq(body, &req); err != nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	var logs []*simLog
+	if req.Name != "" {
+		l := d.findLog(req.Name)
+		if l == nil {
+			return rcRsp(nmp.NMP_ERR_ENOENT)
+		}
+		logs = []*simLog{l}
+	} else {
+		for _, l := range d.logs {
+			if l.typ != nmp.STREAM_LOG {
+				logs = append(logs, l)
+			}
+		}
+	}
+
+	rsp := nmp.NewLogShowRsp()
+	rsp.NextIndex = d.logIdx
+	rsp.Logs = []nmp.LogShowLog{}
+
+	budget := LOG_SHOW_MAX_BYTES
+	added := 0
+	for _, l := range logs {
+		sl := nmp.LogShowLog{
+			Name:    l.name,
+			Type:    l.typ,
+			Entries: []nmp.LogEntry{},
+		}
+
+		entries := l.entries
+		if req.Timestamp == -1 && len(entries) > 0 {
+			// Only report the most recent entry.
+			entries = entries[len(entries)-1:]
+		}
+
+		for _, e := range entries {
+			if e.Index < req.Index ||
+				(req.Timestamp > 0 && e.Timestamp < req.Timestamp) {
+
+				continue
+			}
+
+			// Always report at least one entry so that the client makes
+			// progress.
+			sz := LOG_ENTRY_OVERHEAD + len(e.Msg)
+			if sz > budget && added > 0 {
+				rsp.Rc = 1
+				break
+			}
+
+			sl.Entries = append(sl.Entries, e)
+			budget -= sz
+			added++
+		}
+
+		rsp.Logs = append(rsp.Logs, sl)
+		if rsp.Rc != 0 {
+			break
+		}
+	}
+
+	return rsp
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $list                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+func logList(d *Device, body []byte) interface{} {
+	rsp := nmp.NewLogListRsp()
+	rsp.List = make([]string, len(d.logs))
+	for i, l := range d.logs {
+		rsp.List[i] = l.name
+	}
+
+	return rsp
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $module list                                                             //
+//////////////////////////////////////////////////////////////////////////////
+
+func logModuleList(d *Device, body []byte) interface{} {
+	rsp := nmp.NewLogModuleListRsp()
+	rsp.Map = make(map[string]int, len(d.logMods))
+	for name, id := range d.logMods {
+		rsp.Map[name] = id
+	}
+
+	return rsp
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $level list                                                              //
+//////////////////////////////////////////////////////////////////////////////
+
+func logLevelList(d *Device, body []byte) interface{} {
+	rsp := nmp.NewLogLevelListRsp()
+	rsp.Map = make(map[string]int, len(d.logLvls))
+	for name, id := range d.logLvls {
+		rsp.Map[name] = id
+	}
+
+	return rsp
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $clear                                                                   //
+//////////////////////////////////////////////////////////////////////////////
+
+func logClear(d *Device, body []byte) interface{} {
+	for _, l := range d.logs {
+		l.entries = nil
+	}
+
+	return nmp.NewLogClearRsp()
+}
@@ -0,0 +1,98 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmsim
+
+import (
+	"fmt"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+)
+
+// Name of the log that test results are written to.
+const RUN_LOG_NAME = "log"
+
+// RunTestFn implements a simulated test.  A nil return indicates the test
+// passed.
+type RunTestFn func() error
+
+type runTest struct {
+	name string
+	fn   RunTestFn
+}
+
+// AddRunTest registers a test that can be executed with the run command.
+func (d *Device) AddRunTest(name string, fn RunTestFn) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.tests = append(d.tests, runTest{name, fn})
+}
+
+// execTest runs a single test and logs its result.  It must be called with
+// the device lock held.
+func (d *Device) execTest(t runTest, token string) {
+	var msg string
+	if err := t.fn(); err != nil {
+		msg = fmt.Sprintf("%s [FAIL] %s: %s", token, t.name, err.Error())
+	} else {
+		msg = fmt.Sprintf("%s [pass] %s", token, t.name)
+	}
+
+	d.appendLog(RUN_LOG_NAME, nmp.MODULE_TEST, nmp.LEVEL_INFO, msg)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $test                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+func runTestExec(d *Device, body []byte) interface{} {
+	var req nmp.RunTestReq
+	if err := decodeReq(body, &req); err != nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	found := false
+	for _, t := range d.tests {
+		if req.Testname == "all" || req.Testname == t.name {
+			d.execTest(t, req.Token)
+			found = true
+		}
+	}
+
+	if !found && req.Testname != "all" {
+		return rcRsp(nmp.NMP_ERR_ENOENT)
+	}
+
+	return nmp.NewRunTestRsp()
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $list                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+func runList(d *Device, body []byte) interface{} {
+	rsp := nmp.NewRunListRsp()
+	rsp.List = make([]string, len(d.tests))
+	for i, t := range d.tests {
+		rsp.List[i] = t.name
+	}
+
+	return rsp
+}
@@ -0,0 +1,354 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmsim
+
+import (
+	"strings"
+
+	"github.com/runtimeco/go-coap"
+	log "github.com/sirupsen/logrus"
+	"github.com/ugorji/go/codec"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
+	"mynewt.apache.org/newtmgr/nmxact/omp"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
+)
+
+// A handler processes the body of a request and returns the response body.
+// Handlers are called with the device lock held.
+type handlerFn func(d *Device, body []byte) interface{}
+
+// These aliases just allow the handler map to fit within 79 columns.
+const op_w = nmp.NMP_OP_WRITE
+const op_r = nmp.NMP_OP_READ
+const gr_def = nmp.NMP_GROUP_DEFAULT
+const gr_img = nmp.NMP_GROUP_IMAGE
+const gr_sta = nmp.NMP_GROUP_STAT
+const gr_cfg = nmp.NMP_GROUP_CONFIG
+const gr_log = nmp.NMP_GROUP_LOG
+const gr_cra = nmp.NMP_GROUP_CRASH
+const gr_spl = nmp.NMP_GROUP_SPLIT
+const gr_run = nmp.NMP_GROUP_RUN
+const gr_fil = nmp.NMP_GROUP_FS
+const gr_she = nmp.NMP_GROUP_SHELL
+
+func ogi(op uint8, group uint16, id uint8) nmp.Ogi {
+	return nmp.Ogi{Op: op, Group: group, Id: id}
+}
+
+var handlerMap = map[nmp.Ogi]handlerFn{
+	ogi(op_w, gr_def, nmp.NMP_ID_DEF_ECHO):           echo,
+	ogi(op_w, gr_def, nmp.NMP_ID_DEF_CONS_ECHO_CTRL): consEchoCtrl,
+	ogi(op_r, gr_def, nmp.NMP_ID_DEF_TASKSTAT):       taskStat,
+	ogi(op_r, gr_def, nmp.NMP_ID_DEF_MPSTAT):         mempoolStat,
+	ogi(op_r, gr_def, nmp.NMP_ID_DEF_DATETIME_STR):   dateTimeRead,
+	ogi(op_w, gr_def, nmp.NMP_ID_DEF_DATETIME_STR):   dateTimeWrite,
+	ogi(op_w, gr_def, nmp.NMP_ID_DEF_RESET):          reset,
+	ogi(op_w, gr_img, nmp.NMP_ID_IMAGE_UPLOAD):       imageUpload,
+	ogi(op_r, gr_img, nmp.NMP_ID_IMAGE_STATE):        imageStateRead,
+	ogi(op_w, gr_img, nmp.NMP_ID_IMAGE_STATE):        imageStateWrite,
+	ogi(op_r, gr_img, nmp.NMP_ID_IMAGE_CORELIST):     coreList,
+	ogi(op_r, gr_img, nmp.NMP_ID_IMAGE_CORELOAD):     coreLoad,
+	ogi(op_w, gr_img, nmp.NMP_ID_IMAGE_CORELOAD):     coreErase,
+	ogi(op_w, gr_img, nmp.NMP_ID_IMAGE_ERASE):        imageErase,
+	ogi(op_r, gr_sta, nmp.NMP_ID_STAT_READ):          statRead,
+	ogi(op_r, gr_sta, nmp.NMP_ID_STAT_LIST):          statList,
+	ogi(op_r, gr_cfg, nmp.NMP_ID_CONFIG_VAL):         configRead,
+	ogi(op_w, gr_cfg, nmp.NMP_ID_CONFIG_VAL):         configWrite,
+	ogi(op_r, gr_log, nmp.NMP_ID_LOG_SHOW):           logShow,
+	ogi(op_w, gr_log, nmp.NMP_ID_LOG_CLEAR):          logClear,
+	ogi(op_r, gr_log, nmp.NMP_ID_LOG_MODULE_LIST):    logModuleList,
+	ogi(op_r, gr_log, nmp.NMP_ID_LOG_LEVEL_LIST):     logLevelList,
+	ogi(op_r, gr_log, nmp.NMP_ID_LOG_LIST):           logList,
+	ogi(op_w, gr_cra, nmp.NMP_ID_CRASH_TRIGGER):      crash,
+	ogi(op_r, gr_spl, nmp.NMP_ID_SPLIT_SPLIT):        splitRead,
+	ogi(op_w, gr_spl, nmp.NMP_ID_SPLIT_SPLIT):        splitWrite,
+	ogi(op_w, gr_run, nmp.NMP_ID_RUN_TEST):           runTestExec,
+	ogi(op_r, gr_run, nmp.NMP_ID_RUN_LIST):           runList,
+	ogi(op_r, gr_fil, nmp.NMP_ID_FS_FILE):            fsDownload,
+	ogi(op_w, gr_fil, nmp.NMP_ID_FS_FILE):            fsUpload,
+	ogi(op_r, gr_fil, nmp.NMP_ID_FS_STAT):            fsStat,
+	ogi(op_r, gr_fil, nmp.NMP_ID_FS_HASH):            fsHash,
+	ogi(op_r, gr_fil, nmp.NMP_ID_FS_LS):              fsLs,
+	ogi(op_w, gr_fil, nmp.NMP_ID_FS_UNLINK):          fsUnlink,
+	ogi(op_w, gr_fil, nmp.NMP_ID_FS_MKDIR):           fsMkdir,
+	ogi(op_w, gr_she, nmp.NMP_ID_SHELL_EXEC):         shellExec,
+}
+
+// rcMap is the body of a response that only conveys a status code.
+type rcMap map[string]interface{}
+
+func rcRsp(rc int) rcMap {
+	return rcMap{"rc": rc}
+}
+
+// groupErrRsp converts a handler's failure response into the form that
+// version 2 devices use: the status code is reported in an "err" map along
+// with the group that produced it.
+func groupErrRsp(group uint16, rsp interface{}) interface{} {
+	rm, ok := rsp.(rcMap)
+	if !ok || rm["rc"] == nmp.NMP_ERR_OK {
+		return rsp
+	}
+
+	return rcMap{
+		"err": map[string]interface{}{
+			"group": group,
+			"rc":    rm["rc"],
+		},
+	}
+}
+
+func decodeReq(body []byte, req interface{}) error {
+	return codec.NewDecoderBytes(body, new(codec.CborHandle)).Decode(req)
+}
+
+// process executes a single request and returns the header and encoded body
+// of the response.
+func (d *Device) process(hdr *nmp.NmpHdr, body []byte) (*nmp.NmpHdr, []byte) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.incStat(STAT_GROUP_MGMT, STAT_MGMT_RX, 1)
+
+	// Respond using the request's protocol version if the device supports
+	// it.
+	ver := hdr.Version
+	if ver > d.nmpVer {
+		ver = d.nmpVer
+	}
+
+	var rsp interface{}
+	fn := handlerMap[ogi(hdr.Op, hdr.Group, hdr.Id)]
+	if fn == nil {
+		rsp = rcRsp(nmp.NMP_ERR_ENOTSUP)
+	} else {
+		rsp = fn(d, body)
+		if ver >= nmp.NMP_VER_2 {
+			rsp = groupErrRsp(hdr.Group, rsp)
+		}
+	}
+
+	if _, ok := rsp.(rcMap); ok {
+		d.incStat(STAT_GROUP_MGMT, STAT_MGMT_ERR, 1)
+	}
+
+	rspBody, err := nmp.BodyBytes(rsp)
+	if err != nil {
+		log.Debugf("nmsim failed to encode response: %s", err.Error())
+		rspBody, _ = nmp.BodyBytes(rcRsp(nmp.NMP_ERR_EUNKNOWN))
+	}
+
+	d.incStat(STAT_GROUP_MGMT, STAT_MGMT_TX, 1)
+
+	// Some commands (reset, crash) reboot the device once the response has
+	// been built.
+	if d.rebootRsn != "" {
+		d.boot(nmp.MODULE_REBOOT, d.rebootRsn)
+		d.rebootRsn = ""
+	}
+
+	rspHdr := &nmp.NmpHdr{
+		Op:      hdr.Op + 1,
+		Version: ver,
+		Flags:   0,
+		Len:     uint16(len(rspBody)),
+		Group:   hdr.Group,
+		Seq:     hdr.Seq,
+		Id:      hdr.Id,
+	}
+
+	return rspHdr, rspBody
+}
+
+// Server is the device end of a single management connection.  It
+// reassembles incoming requests and produces encoded responses.
+type Server struct {
+	d     *Device
+	proto sesn.MgmtProto
+	isTcp bool
+
+	// Used for plain NMP.
+	nr *nmp.Reassembler
+
+	// Holds a partially received CoAP-over-TCP message.
+	buf []byte
+}
+
+// NewServer creates the device end of a connection using the specified
+// management protocol.  isTcp indicates whether OMP requests use the TCP
+// encoding of CoAP.
+func (d *Device) NewServer(proto sesn.MgmtProto, isTcp bool) *Server {
+	return &Server{
+		d:     d,
+		proto: proto,
+		isTcp: isTcp,
+		nr:    nmp.NewReassembler(),
+	}
+}
+
+// Rx processes a fragment of incoming data.  It returns the encoded
+// responses, if any, that the device sends back.
+func (s *Server) Rx(frag []byte) [][]byte {
+	// A device that is still booting doesn't hear anything, including the
+	// rest of any message that was in progress when it reset.
+	if s.d.booting() {
+		s.nr = nmp.NewReassembler()
+		s.buf = nil
+		return nil
+	}
+
+	if s.proto == sesn.MGMT_PROTO_NMP {
+		pkt := s.nr.RxFrag(frag)
+		if pkt == nil {
+			return nil
+		}
+
+		rsp := s.rxNmp(pkt)
+		if rsp == nil {
+			return nil
+		}
+		return [][]byte{rsp}
+	}
+
+	var msgs []coap.Message
+	if s.isTcp {
+		s.buf = append(s.buf, frag...)
+		for {
+			m, rest, err := coap.PullTcp(s.buf)
+			if err != nil {
+				log.Debugf("nmsim discarding invalid CoAP data: %s",
+					err.Error())
+				s.buf = nil
+				break
+			}
+			if m == nil {
+				break
+			}
+			s.buf = rest
+			msgs = append(msgs, m)
+		}
+	} else {
+		m, err := coap.ParseDgramMessage(frag)
+		if err != nil {
+			log.Debugf("nmsim discarding invalid CoAP data: %s", err.Error())
+			return nil
+		}
+		msgs = append(msgs, m)
+	}
+
+	var rsps [][]byte
+	for _, m := range msgs {
+		if rsp := s.rxCoap(m); rsp != nil {
+			rsps = append(rsps, rsp)
+		}
+	}
+
+	return rsps
+}
+
+func (s *Server) rxNmp(pkt []byte) []byte {
+	hdr, err := nmp.DecodeNmpHdr(pkt)
+	if err != nil {
+		return nil
+	}
+
+	rspHdr, rspBody := s.d.process(hdr, pkt[nmp.NMP_HDR_SIZE:])
+	return append(rspHdr.Bytes(), rspBody...)
+}
+
+func (s *Server) rxCoap(m coap.Message) []byte {
+	// Ignore everything except requests.
+	if m.Code() != coap.GET && m.Code() != coap.PUT &&
+		m.Code() != coap.POST && m.Code() != coap.DELETE {
+
+		return nil
+	}
+
+	mp := coap.MessageParams{
+		Type:      coap.NonConfirmable,
+		MessageID: m.MessageID(),
+		Token:     m.Token(),
+	}
+	if m.IsConfirmable() {
+		mp.Type = coap.Acknowledgement
+	}
+
+	if m.PathString() != strings.TrimPrefix(nmxutil.OmpRes, "/") {
+		mp.Code = coap.NotFound
+		return s.encodeCoap(mp)
+	}
+
+	var om omp.OicMsg
+	err := codec.NewDecoderBytes(m.Payload(), new(codec.CborHandle)).Decode(&om)
+	if err != nil || om.Hdr == nil {
+		mp.Code = coap.BadRequest
+		return s.encodeCoap(mp)
+	}
+
+	hdr, err := nmp.DecodeNmpHdr(om.Hdr)
+	if err != nil {
+		mp.Code = coap.BadRequest
+		return s.encodeCoap(mp)
+	}
+
+	rspHdr, rspBody := s.d.process(hdr, m.Payload())
+
+	// The NMP header is conveyed inside the CBOR map.
+	fields, err := nmxutil.DecodeCborMap(rspBody)
+	if err != nil {
+		mp.Code = coap.InternalServerError
+		return s.encodeCoap(mp)
+	}
+	fields["_h"] = rspHdr.Bytes()
+
+	payload, err := nmxutil.EncodeCborMap(fields)
+	if err != nil {
+		mp.Code = coap.InternalServerError
+		return s.encodeCoap(mp)
+	}
+
+	if hdr.Op == nmp.NMP_OP_READ {
+		mp.Code = coap.Content
+	} else {
+		mp.Code = coap.Changed
+	}
+	mp.Payload = payload
+
+	return s.encodeCoap(mp)
+}
+
+func (s *Server) encodeCoap(mp coap.MessageParams) []byte {
+	var m coap.Message
+	if s.isTcp {
+		m = coap.NewTcpMessage(mp)
+	} else {
+		m = coap.NewDgramMessage(mp)
+	}
+
+	b, err := m.MarshalBinary()
+	if err != nil {
+		log.Debugf("nmsim failed to encode CoAP response: %s", err.Error())
+		return nil
+	}
+
+	return b
+}
@@ -0,0 +1,89 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmsim
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+)
+
+// ShellCmdFn implements a simulated shell command.  It returns the command's
+// output and status code.
+type ShellCmdFn func(argv []string) (string, int)
+
+// AddShellCmd registers a shell command, replacing any existing command
+// with the same name.
+func (d *Device) AddShellCmd(name string, fn ShellCmdFn) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.shell[name] = fn
+}
+
+func shellEcho(argv []string) (string, int) {
+	return strings.Join(argv[1:], " ") + "\n", 0
+}
+
+// shellHelp lists the available commands.  It is called with the device
+// lock held.
+func (d *Device) shellHelp(argv []string) (string, int) {
+	names := make([]string, 0, len(d.shell))
+	for name := range d.shell {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	s := "Available commands:\n"
+	for _, name := range names {
+		s += "  " + name + "\n"
+	}
+
+	return s, 0
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $exec                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+func shellExec(d *Device, body []byte) interface{} {
+	var req nmp.ShellExecReq
+	if err := decodeReq(body, &req); err != nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	if len(req.Argv) == 0 {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	rsp := nmp.NewShellExecRsp()
+
+	fn := d.shell[req.Argv[0]]
+	if fn == nil {
+		rsp.O = fmt.Sprintf("Unrecognized command: %s\n", req.Argv[0])
+		rsp.Rc = nmp.NMP_ERR_ENOENT
+		return rsp
+	}
+
+	rsp.O, rsp.Rc = fn(req.Argv)
+	return rsp
+}
@@ -0,0 +1,77 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmsim
+
+import (
+	"mynewt.apache.org/newtmgr/nmxact/loopback"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
+)
+
+// XportCfg configures a simulator transport.  The embedded loopback
+// configuration controls the link between the client and the device (MTU,
+// CoAP encoding, impairments); its handler factory is filled in
+// automatically.
+type XportCfg struct {
+	loopback.XportCfg
+
+	// The device that sessions connect to.  If nil, a new device is
+	// created when the transport is constructed.
+	Device *Device
+}
+
+func NewXportCfg() *XportCfg {
+	return &XportCfg{
+		XportCfg: *loopback.NewXportCfg(),
+	}
+}
+
+// SimXport is a loopback transport whose sessions connect to a simulated
+// device.
+type SimXport struct {
+	*loopback.LoopbackXport
+	dev *Device
+}
+
+func NewSimXport(cfg *XportCfg) *SimXport {
+	if cfg.Device == nil {
+		cfg.Device = NewDevice()
+	}
+
+	lcfg := cfg.XportCfg
+	lcfg.NewHandler = cfg.Device.NewHandler
+
+	return &SimXport{
+		LoopbackXport: loopback.NewLoopbackXport(&lcfg),
+		dev:           cfg.Device,
+	}
+}
+
+// Device returns the simulated device that this transport connects to.
+func (sx *SimXport) Device() *Device {
+	return sx.dev
+}
+
+// NewHandler creates the device end of a loopback connection.  It can be
+// used as a loopback.HandlerFactory.
+func (d *Device) NewHandler(proto sesn.MgmtProto,
+	isTcp bool) loopback.Handler {
+
+	return d.NewServer(proto, isTcp)
+}
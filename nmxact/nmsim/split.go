@@ -0,0 +1,60 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmsim
+
+import (
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+)
+
+// The simulated device never has a split application installed, so the split
+// status is always "N/A".  The split mode is still tracked so that clients
+// can exercise the split commands.
+
+//////////////////////////////////////////////////////////////////////////////
+// $read                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+func splitRead(d *Device, body []byte) interface{} {
+	rsp := nmp.NewSplitReadRsp()
+	rsp.Mode = d.splitMode
+	rsp.Status = nmp.NOT_APPLICABLE
+
+	return rsp
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $write                                                                   //
+//////////////////////////////////////////////////////////////////////////////
+
+func splitWrite(d *Device, body []byte) interface{} {
+	var req nmp.SplitWriteReq
+	if err := decodeReq(body, &req); err != nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	switch req.Mode {
+	case nmp.SPLIT_MODE_NONE, nmp.SPLIT_MODE_TEST, nmp.SPLIT_MODE_RUN:
+		d.splitMode = req.Mode
+	default:
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	return nmp.NewSplitWriteRsp()
+}
@@ -0,0 +1,163 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmsim
+
+import (
+	"fmt"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+)
+
+// Statistics maintained by the simulated management subsystem.
+const STAT_GROUP_MGMT = "mgmt"
+const STAT_MGMT_RX = "rx_reqs"
+const STAT_MGMT_TX = "tx_rsps"
+const STAT_MGMT_ERR = "rx_errs"
+
+type statGroup struct {
+	name   string
+	fields []string
+	vals   map[string]uint64
+}
+
+func newStatGroup(name string, fields ...string) *statGroup {
+	sg := &statGroup{
+		name:   name,
+		fields: fields,
+	}
+	sg.clear()
+
+	return sg
+}
+
+func (sg *statGroup) clear() {
+	sg.vals = make(map[string]uint64, len(sg.fields))
+	for _, f := range sg.fields {
+		sg.vals[f] = 0
+	}
+}
+
+func (d *Device) findStatGroup(name string) *statGroup {
+	for _, sg := range d.stats {
+		if sg.name == name {
+			return sg
+		}
+	}
+
+	return nil
+}
+
+// incStat increments a statistic.  It must be called with the device lock
+// held.
+func (d *Device) incStat(group string, field string, delta uint64) {
+	if sg := d.findStatGroup(group); sg != nil {
+		if _, ok := sg.vals[field]; ok {
+			sg.vals[field] += delta
+		}
+	}
+}
+
+// AddStatGroup registers a group of statistics.  All statistics start at
+// zero and are reset whenever the device reboots.
+func (d *Device) AddStatGroup(name string, fields ...string) error {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if d.findStatGroup(name) != nil {
+		return fmt.Errorf("duplicate stat group: %s", name)
+	}
+
+	d.stats = append(d.stats, newStatGroup(name, fields...))
+	return nil
+}
+
+// SetStat sets the value of a single statistic.
+func (d *Device) SetStat(group string, field string, val uint64) error {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	sg := d.findStatGroup(group)
+	if sg == nil {
+		return fmt.Errorf("unknown stat group: %s", group)
+	}
+	if _, ok := sg.vals[field]; !ok {
+		return fmt.Errorf("unknown stat: %s.%s", group, field)
+	}
+
+	sg.vals[field] = val
+	return nil
+}
+
+// IncStat increments a single statistic.
+func (d *Device) IncStat(group string, field string, delta uint64) error {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	sg := d.findStatGroup(group)
+	if sg == nil {
+		return fmt.Errorf("unknown stat group: %s", group)
+	}
+	if _, ok := sg.vals[field]; !ok {
+		return fmt.Errorf("unknown stat: %s.%s", group, field)
+	}
+
+	sg.vals[field] += delta
+	return nil
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $read                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+func statRead(d *Device, body []byte) interface{} {
+	var req nmp.StatReadReq
+	if err := decodeReq(body, &req); err != nil {
+		return rcRsp(nmp.NMP_ERR_EINVAL)
+	}
+
+	sg := d.findStatGroup(req.Name)
+	if sg == nil {
+		return rcRsp(nmp.NMP_ERR_ENOENT)
+	}
+
+	rsp := nmp.NewStatReadRsp()
+	rsp.Name = sg.name
+	rsp.Group = sg.name
+	rsp.Fields = make(map[string]interface{}, len(sg.vals))
+	for k, v := range sg.vals {
+		rsp.Fields[k] = v
+	}
+
+	return rsp
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $list                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+func statList(d *Device, body []byte) interface{} {
+	rsp := nmp.NewStatListRsp()
+	rsp.List = make([]string, len(d.stats))
+	for i, sg := range d.stats {
+		rsp.List[i] = sg.name
+	}
+
+	return rsp
+}
@@ -36,6 +36,24 @@ type Listener struct {
 	stopCh chan struct{}
 }
 
+// Passes a response to the NMP listener.  Duplicates are dropped while the
+// client has yet to read the previous response.
+func (ompl *Listener) sendRsp(rsp nmp.NmpRsp) {
+	select {
+	case ompl.nmpl.RspChan <- rsp:
+	case <-ompl.stopCh:
+	default:
+	}
+}
+
+func (ompl *Listener) sendErr(err error) {
+	select {
+	case ompl.nmpl.ErrChan <- err:
+	case <-ompl.stopCh:
+	default:
+	}
+}
+
 // The dispatcher is the owner of the listeners it points to.  Only the
 // dispatcher writes to these listeners.
 type Dispatcher struct {
@@ -88,7 +106,6 @@ func (d *Dispatcher) addOmpListener(seq uint8) (*Listener, error) {
 
 	d.wg.Add(1)
 	go func() {
-		defer d.RemoveCoapListener(mc)
 		defer d.wg.Done()
 
 		// Listen for events.  All feedback is sent to the client via the NMP
@@ -96,19 +113,25 @@ func (d *Dispatcher) addOmpListener(seq uint8) (*Listener, error) {
 		// OMP/NMP agnostic.
 		for {
 			select {
-			case m := <-ompl.coapl.RspChan:
+			case m, ok := <-ompl.coapl.RspChan:
+				if !ok {
+					return
+				}
 				rsp, err := DecodeOmp(m, d.rxFilter)
 				if err != nil {
-					ompl.nmpl.ErrChan <- err
+					ompl.sendErr(err)
 				} else if rsp != nil {
-					ompl.nmpl.RspChan <- rsp
+					ompl.sendRsp(rsp)
 				} else {
 					/* no error, no response */
 				}
 
-			case err := <-ompl.coapl.ErrChan:
+			case err, ok := <-ompl.coapl.ErrChan:
+				if !ok {
+					return
+				}
 				if err != nil {
-					ompl.nmpl.ErrChan <- err
+					ompl.sendErr(err)
 				}
 
 			case <-ompl.stopCh:
@@ -132,6 +155,7 @@ func (d *Dispatcher) Stop() {
 	for seq, ompl := range d.seqListenerMap {
 		delete(d.seqListenerMap, seq)
 		close(ompl.stopCh)
+		d.RemoveCoapListener(ompl.coapl.Criteria)
 	}
 	d.wg.Wait()
 }
@@ -178,6 +202,10 @@ func (d *Dispatcher) RemoveNmpListener(seq uint8) *nmp.Listener {
 	delete(d.seqListenerMap, seq)
 	close(ompl.stopCh)
 
+	// Remove the CoAP listener before returning so that a retry with the
+	// same sequence number can register its own.
+	d.RemoveCoapListener(ompl.coapl.Criteria)
+
 	nmxutil.LogRemoveNmpListener(d.logDepth, seq)
 	return ompl.nmpl
 }
@@ -50,6 +50,7 @@ type OnCloseFn func(s Sesn, err error)
 type PeerSpec struct {
 	Ble bledefs.BleDev
 	Udp string
+	Tcp string
 }
 
 type SesnCfgBleCentral struct {
@@ -0,0 +1,132 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package tcp
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/runtimeco/go-coap"
+	log "github.com/sirupsen/logrus"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+)
+
+const MAX_PACKET_SIZE = 2048
+const CONNECT_TIMEOUT = 10 * time.Second
+
+// Extracts the first complete NMP frame from a stream buffer.  A nil frame
+// is returned if the buffer does not contain a complete frame yet.
+func pullNmp(buf []byte) ([]byte, []byte, error) {
+	hdr, err := nmp.DecodeNmpHdr(buf)
+	if err != nil {
+		// Incomplete header.
+		return nil, buf, nil
+	}
+
+	total := nmp.NMP_HDR_SIZE + int(hdr.Len)
+	if len(buf) < total {
+		return nil, buf, nil
+	}
+
+	return buf[:total], buf[total:], nil
+}
+
+// Extracts the first complete CoAP-over-TCP message from a stream buffer.  A
+// nil message is returned if the buffer does not contain a complete message
+// yet.
+func pullCoap(buf []byte) ([]byte, []byte, error) {
+	m, rest, err := coap.PullTcp(buf)
+	if err != nil {
+		return nil, buf, err
+	}
+	if m == nil {
+		return nil, buf, nil
+	}
+
+	return buf[:len(buf)-len(rest)], rest, nil
+}
+
+// readStream reads from r until the read fails.  Incoming data is split into
+// complete messages with pull, and each message is passed to dispatchCb.
+// The returned error indicates why reading stopped.
+func readStream(r io.Reader, pull func([]byte) ([]byte, []byte, error),
+	dispatchCb func(data []byte)) error {
+
+	data := make([]byte, MAX_PACKET_SIZE)
+	var buf []byte
+
+	for {
+		nr, err := r.Read(data)
+		if err != nil {
+			// Connection closed or read error.
+			return err
+		}
+
+		log.Debugf("Received %d bytes", nr)
+		buf = append(buf, data[:nr]...)
+
+		for {
+			msg, rest, err := pull(buf)
+			if err != nil {
+				// The stream is corrupt; there is no way to resync.
+				return fmt.Errorf("Invalid data from TCP peer: %s",
+					err.Error())
+			}
+			if msg == nil {
+				break
+			}
+
+			buf = rest
+			dispatchCb(msg)
+		}
+	}
+}
+
+// Connect establishes a TCP connection with the specified peer.  Incoming
+// data is split into complete messages (NMP frames or, if isCoap is set,
+// CoAP-over-TCP messages), and each message is passed to dispatchCb.  When
+// the connection fails or gets closed, closeCb is called with the
+// connection and the cause.  The connection is passed to closeCb because the
+// callback may run before Connect returns.
+func Connect(peerString string, isCoap bool, dispatchCb func(data []byte),
+	closeCb func(conn *net.TCPConn, err error)) (*net.TCPConn, error) {
+
+	c, err := net.DialTimeout("tcp", peerString, CONNECT_TIMEOUT)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to TCP peer %s: %s",
+			peerString, err.Error())
+	}
+	conn := c.(*net.TCPConn)
+
+	pull := pullNmp
+	if isCoap {
+		pull = pullCoap
+	}
+
+	go func() {
+		err := readStream(conn, pull, dispatchCb)
+		closeCb(conn, err)
+	}()
+
+	return conn, nil
+}
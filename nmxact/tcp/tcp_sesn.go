@@ -0,0 +1,254 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package tcp
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/runtimeco/go-coap"
+
+	"mynewt.apache.org/newtmgr/nmxact/mgmt"
+	"mynewt.apache.org/newtmgr/nmxact/nmcoap"
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
+	"mynewt.apache.org/newtmgr/nmxact/omp"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
+)
+
+type TcpSesn struct {
+	cfg  sesn.SesnCfg
+	conn *net.TCPConn
+	txvr *mgmt.Transceiver
+
+	// This mutex ensures:
+	//     * accesses to conn and txvr are protected.
+	m sync.Mutex
+}
+
+func NewTcpSesn(cfg sesn.SesnCfg) (*TcpSesn, error) {
+	if cfg.MgmtProto != sesn.MGMT_PROTO_NMP &&
+		cfg.MgmtProto != sesn.MGMT_PROTO_OMP {
+
+		return nil, fmt.Errorf("Invalid management protocol for TCP "+
+			"session: %s", cfg.MgmtProto)
+	}
+
+	s := &TcpSesn{
+		cfg: cfg,
+	}
+	txvr, err := mgmt.NewTransceiver(cfg.TxFilter, cfg.RxFilter, true,
+		cfg.MgmtProto, 3)
+	if err != nil {
+		return nil, err
+	}
+	s.txvr = txvr
+
+	return s, nil
+}
+
+func (s *TcpSesn) Open() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.conn != nil {
+		return nmxutil.NewSesnAlreadyOpenError(
+			"Attempt to open an already-open TCP session")
+	}
+
+	txvr, err := mgmt.NewTransceiver(s.cfg.TxFilter, s.cfg.RxFilter, true,
+		s.cfg.MgmtProto, 3)
+	if err != nil {
+		return err
+	}
+
+	// The reader may fail before Connect returns.  onDisconnect blocks on
+	// the session mutex until s.conn has been assigned below.
+	conn, err := Connect(s.cfg.PeerSpec.Tcp,
+		s.cfg.MgmtProto == sesn.MGMT_PROTO_OMP,
+		func(data []byte) {
+			txvr.DispatchNmpRsp(data)
+		},
+		s.onDisconnect)
+	if err != nil {
+		txvr.Stop()
+		return err
+	}
+
+	s.txvr = txvr
+	s.conn = conn
+	return nil
+}
+
+// onDisconnect cleans up after the peer closes the connection or the
+// connection fails.  Pending requests fail immediately rather than timing
+// out.
+func (s *TcpSesn) onDisconnect(conn *net.TCPConn, err error) {
+	s.m.Lock()
+	if s.conn != conn {
+		// The session was closed locally.
+		s.m.Unlock()
+		return
+	}
+	s.conn = nil
+	txvr := s.txvr
+	s.m.Unlock()
+
+	conn.Close()
+	txvr.ErrorAll(nmxutil.NewSesnClosedError(
+		fmt.Sprintf("TCP connection closed: %s", err.Error())))
+	txvr.Stop()
+
+	if s.cfg.OnCloseCb != nil {
+		s.cfg.OnCloseCb(s, err)
+	}
+}
+
+func (s *TcpSesn) Close() error {
+	s.m.Lock()
+	if s.conn == nil {
+		s.m.Unlock()
+		return nmxutil.NewSesnClosedError(
+			"Attempt to close an unopened TCP session")
+	}
+
+	conn := s.conn
+	txvr := s.txvr
+	s.conn = nil
+	s.m.Unlock()
+
+	conn.Close()
+	txvr.ErrorAll(fmt.Errorf("closed"))
+	txvr.Stop()
+	return nil
+}
+
+func (s *TcpSesn) IsOpen() bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.conn != nil
+}
+
+func (s *TcpSesn) mtu() int {
+	mtu := MAX_PACKET_SIZE - nmp.NMP_HDR_SIZE
+	if s.cfg.MgmtProto == sesn.MGMT_PROTO_OMP {
+		mtu -= omp.OMP_MSG_OVERHEAD
+	}
+	return mtu
+}
+
+func (s *TcpSesn) MtuIn() int {
+	return s.mtu()
+}
+
+func (s *TcpSesn) MtuOut() int {
+	return s.mtu()
+}
+
+// tx writes raw data to the connection.
+func (s *TcpSesn) tx(b []byte) error {
+	s.m.Lock()
+	conn := s.conn
+	s.m.Unlock()
+
+	if conn == nil {
+		return nmxutil.NewSesnClosedError(
+			"Attempt to transmit over closed TCP session")
+	}
+
+	_, err := conn.Write(b)
+	return err
+}
+
+func (s *TcpSesn) transceiver() *mgmt.Transceiver {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.txvr
+}
+
+func (s *TcpSesn) TxRxMgmt(m *nmp.NmpMsg,
+	timeout time.Duration) (nmp.NmpRsp, error) {
+
+	if !s.IsOpen() {
+		return nil, nmxutil.NewSesnClosedError(
+			"Attempt to transmit over closed TCP session")
+	}
+
+	return s.transceiver().TxRxMgmt(s.tx, m, s.MtuOut(), timeout)
+}
+
+func (s *TcpSesn) TxRxMgmtAsync(m *nmp.NmpMsg,
+	timeout time.Duration, ch chan nmp.NmpRsp, errc chan error) error {
+
+	if !s.IsOpen() {
+		return nmxutil.NewSesnClosedError(
+			"Attempt to transmit over closed TCP session")
+	}
+
+	return s.transceiver().TxRxMgmtAsync(s.tx, m, s.MtuOut(), timeout,
+		ch, errc)
+}
+
+func (s *TcpSesn) AbortRx(seq uint8) error {
+	s.transceiver().AbortRx(seq)
+	return nil
+}
+
+func (s *TcpSesn) TxCoap(m coap.Message) error {
+	return s.transceiver().TxCoap(s.tx, m, s.MtuOut())
+}
+
+func (s *TcpSesn) MgmtProto() sesn.MgmtProto {
+	return s.cfg.MgmtProto
+}
+
+func (s *TcpSesn) ListenCoap(mc nmcoap.MsgCriteria) (*nmcoap.Listener, error) {
+	return s.transceiver().ListenCoap(mc)
+}
+
+func (s *TcpSesn) StopListenCoap(mc nmcoap.MsgCriteria) {
+	s.transceiver().StopListenCoap(mc)
+}
+
+func (s *TcpSesn) CoapIsTcp() bool {
+	return true
+}
+
+func (s *TcpSesn) RxAccept() (sesn.Sesn, *sesn.SesnCfg, error) {
+	return nil, nil, fmt.Errorf("Op not implemented yet")
+}
+
+func (s *TcpSesn) RxCoap(opt sesn.TxOptions) (coap.Message, error) {
+	return nil, fmt.Errorf("Op not implemented yet")
+}
+
+func (s *TcpSesn) Filters() (nmcoap.TxMsgFilter, nmcoap.RxMsgFilter) {
+	return s.transceiver().Filters()
+}
+
+func (s *TcpSesn) SetFilters(txFilter nmcoap.TxMsgFilter,
+	rxFilter nmcoap.RxMsgFilter) {
+
+	s.transceiver().SetFilters(txFilter, rxFilter)
+}
@@ -0,0 +1,331 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package tcp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/nmsim"
+	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
+	"mynewt.apache.org/newtmgr/nmxact/omp"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
+	"mynewt.apache.org/newtmgr/nmxact/xact"
+)
+
+func TestMain(m *testing.M) {
+	// The listener log is verbose by default.
+	nmxutil.SetLogLevel(log.WarnLevel)
+	os.Exit(m.Run())
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $reassembly                                                              //
+//////////////////////////////////////////////////////////////////////////////
+
+// chunkReader returns one chunk per read, then io.EOF.
+type chunkReader struct {
+	chunks [][]byte
+	off    int
+}
+
+func (r *chunkReader) Read(b []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(b, r.chunks[0][r.off:])
+	r.off += n
+	if r.off == len(r.chunks[0]) {
+		r.chunks = r.chunks[1:]
+		r.off = 0
+	}
+	return n, nil
+}
+
+// encodeEcho produces a complete echo request in the specified encoding.
+func encodeEcho(t *testing.T, isCoap bool, seq uint8,
+	payload string) []byte {
+
+	t.Helper()
+
+	r := nmp.NewEchoReq()
+	r.Payload = payload
+	r.Hdr().Seq = seq
+
+	var b []byte
+	var err error
+	if isCoap {
+		b, err = omp.EncodeOmpTcp(nil, r.Msg())
+	} else {
+		b, err = nmp.EncodeNmpPlain(r.Msg())
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// Splits data into chunks of the specified size.
+func chunk(data []byte, size int) [][]byte {
+	var chunks [][]byte
+	for len(data) > size {
+		chunks = append(chunks, data[:size])
+		data = data[size:]
+	}
+	if len(data) > 0 {
+		chunks = append(chunks, data)
+	}
+	return chunks
+}
+
+func TestReadStream(t *testing.T) {
+	protos := []struct {
+		name   string
+		isCoap bool
+	}{
+		{"nmp", false},
+		{"coap", true},
+	}
+
+	tests := []struct {
+		name string
+
+		// Converts the encoded messages into the reads the peer produces.
+		reads func(msgs [][]byte) [][]byte
+	}{
+		{"one per read", func(msgs [][]byte) [][]byte {
+			return msgs
+		}},
+		{"split", func(msgs [][]byte) [][]byte {
+			var reads [][]byte
+			for _, m := range msgs {
+				reads = append(reads, chunk(m, 1)...)
+			}
+			return reads
+		}},
+		{"coalesced", func(msgs [][]byte) [][]byte {
+			return [][]byte{bytes.Join(msgs, nil)}
+		}},
+		{"straddling", func(msgs [][]byte) [][]byte {
+			return chunk(bytes.Join(msgs, nil), 7)
+		}},
+	}
+
+	for _, p := range protos {
+		for _, tt := range tests {
+			t.Run(p.name+"/"+tt.name, func(t *testing.T) {
+				var msgs [][]byte
+				for i := 0; i < 5; i++ {
+					payload := strings.Repeat("x", i*40)
+					msgs = append(msgs,
+						encodeEcho(t, p.isCoap, uint8(i), payload))
+				}
+
+				var rxed [][]byte
+				r := &chunkReader{chunks: tt.reads(msgs)}
+				pull := pullNmp
+				if p.isCoap {
+					pull = pullCoap
+				}
+
+				err := readStream(r, pull, func(data []byte) {
+					rxed = append(rxed, append([]byte(nil), data...))
+				})
+				if err != io.EOF {
+					t.Fatalf("readStream returned %v; want EOF", err)
+				}
+
+				if len(rxed) != len(msgs) {
+					t.Fatalf("dispatched %d messages; want %d",
+						len(rxed), len(msgs))
+				}
+				for i := range msgs {
+					if !bytes.Equal(rxed[i], msgs[i]) {
+						t.Fatalf("message %d mismatch:\nhave %x\nwant %x",
+							i, rxed[i], msgs[i])
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestReadStreamPartial(t *testing.T) {
+	// A truncated trailing message is never dispatched.
+	msg := encodeEcho(t, false, 0, "hello")
+	r := &chunkReader{chunks: [][]byte{msg, msg[:len(msg)-1]}}
+
+	cnt := 0
+	err := readStream(r, pullNmp, func(data []byte) { cnt++ })
+	if err != io.EOF {
+		t.Fatalf("readStream returned %v; want EOF", err)
+	}
+	if cnt != 1 {
+		t.Fatalf("dispatched %d messages; want 1", cnt)
+	}
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $session                                                                 //
+//////////////////////////////////////////////////////////////////////////////
+
+// listen starts a TCP server on the loopback interface.  Each accepted
+// connection is passed to handle.
+func listen(t *testing.T, handle func(c net.Conn)) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go handle(c)
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+// serveSim answers requests on a connection with a simulated device.
+func serveSim(d *nmsim.Device, proto sesn.MgmtProto) func(c net.Conn) {
+	return func(c net.Conn) {
+		defer c.Close()
+
+		srv := d.NewServer(proto, true)
+		pull := pullNmp
+		if proto == sesn.MGMT_PROTO_OMP {
+			pull = pullCoap
+		}
+
+		readStream(c, pull, func(data []byte) {
+			for _, rsp := range srv.Rx(data) {
+				if _, err := c.Write(rsp); err != nil {
+					return
+				}
+			}
+		})
+	}
+}
+
+func newSesn(t *testing.T, addr string, proto sesn.MgmtProto,
+	onClose sesn.OnCloseFn) *TcpSesn {
+
+	t.Helper()
+
+	sc := sesn.NewSesnCfg()
+	sc.MgmtProto = proto
+	sc.PeerSpec.Tcp = addr
+	sc.OnCloseCb = onClose
+
+	s, err := NewTcpSesn(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestSesnEcho(t *testing.T) {
+	for _, proto := range []sesn.MgmtProto{
+		sesn.MGMT_PROTO_NMP, sesn.MGMT_PROTO_OMP,
+	} {
+		t.Run(fmt.Sprintf("%s", proto), func(t *testing.T) {
+			addr := listen(t, serveSim(nmsim.NewDevice(), proto))
+			s := newSesn(t, addr, proto, nil)
+			if err := s.Open(); err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			for _, size := range []int{0, 1, 100, 1000} {
+				c := xact.NewEchoCmd()
+				c.SetTxOptions(sesn.TxOptions{
+					Timeout: 2 * time.Second,
+					Tries:   1,
+				})
+				c.Payload = strings.Repeat("e", size)
+
+				res, err := c.Run(s)
+				if err != nil {
+					t.Fatalf("echo %d: %s", size, err.Error())
+				}
+				rsp := res.(*xact.EchoResult).Rsp
+				if rsp.Payload != c.Payload {
+					t.Fatalf("echo %d: payload mismatch", size)
+				}
+			}
+		})
+	}
+}
+
+func TestSesnPeerClose(t *testing.T) {
+	// The peer hangs up immediately, possibly before Open returns.
+	addr := listen(t, func(c net.Conn) { c.Close() })
+
+	closed := make(chan error, 1)
+	s := newSesn(t, addr, sesn.MGMT_PROTO_NMP,
+		func(s sesn.Sesn, err error) { closed <- err })
+
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("close callback not called")
+	}
+
+	if s.IsOpen() {
+		t.Fatalf("session still open after the peer hung up")
+	}
+}
+
+func TestSesnMtu(t *testing.T) {
+	nmpMtu := newSesn(t, "", sesn.MGMT_PROTO_NMP, nil).MtuOut()
+	ompMtu := newSesn(t, "", sesn.MGMT_PROTO_OMP, nil).MtuOut()
+
+	if nmpMtu != MAX_PACKET_SIZE-nmp.NMP_HDR_SIZE {
+		t.Fatalf("NMP MTU is %d; want %d",
+			nmpMtu, MAX_PACKET_SIZE-nmp.NMP_HDR_SIZE)
+	}
+	if ompMtu != nmpMtu-omp.OMP_MSG_OVERHEAD {
+		t.Fatalf("OMP MTU is %d; want %d",
+			ompMtu, nmpMtu-omp.OMP_MSG_OVERHEAD)
+	}
+}
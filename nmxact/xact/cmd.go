@@ -22,6 +22,7 @@ package xact
 import (
 	"fmt"
 
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
 	"mynewt.apache.org/newtmgr/nmxact/sesn"
 )
 
@@ -38,11 +39,23 @@ type Cmd interface {
 	SetTxOptions(opt sesn.TxOptions)
 }
 
+// Optionally implemented by commands that can report a nonzero NMP status
+// code as an error.  This is kept out of Cmd so that implementations outside
+// this package don't need to provide it.  All commands built on CmdBase
+// implement it.
+type RcErrCmd interface {
+	// If enabled, Run reports a nonzero NMP status code as an
+	// *nmp.NmpRcError.  The result is still returned alongside the error.
+	RcErr() bool
+	SetRcErr(rcErr bool)
+}
+
 type CmdBase struct {
 	txOptions sesn.TxOptions
 	curNmpSeq uint8
 	curSesn   sesn.Sesn
 	abortErr  error
+	rcErr     bool
 }
 
 func NewCmdBase() CmdBase {
@@ -59,6 +72,24 @@ func (c *CmdBase) SetTxOptions(opt sesn.TxOptions) {
 	c.txOptions = opt
 }
 
+func (c *CmdBase) RcErr() bool {
+	return c.rcErr
+}
+
+func (c *CmdBase) SetRcErr(rcErr bool) {
+	c.rcErr = rcErr
+}
+
+// Called by NMP commands when they complete.  Converts a nonzero status code
+// to an error if the command is configured to do so.
+func (c *CmdBase) done(res Result) (Result, error) {
+	if c.rcErr && res.Status() != nmp.NMP_ERR_OK {
+		return res, nmp.NewNmpRcError(res.Status())
+	}
+
+	return res, nil
+}
+
 func (c *CmdBase) Abort() error {
 	if c.curSesn != nil {
 		if err := c.curSesn.AbortRx(c.curNmpSeq); err != nil {
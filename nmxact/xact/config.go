@@ -63,7 +63,7 @@ func (c *ConfigReadCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newConfigReadResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
 }
 
 //////////////////////////////////////////////////////////////////////////////
@@ -109,5 +109,5 @@ func (c *ConfigWriteCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newConfigWriteResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
 }
@@ -104,5 +104,5 @@ func (c *CrashCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newCrashResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
 }
@@ -20,10 +20,37 @@
 package xact
 
 import (
+	"fmt"
+	"sort"
+	"time"
+
 	"mynewt.apache.org/newtmgr/nmxact/nmp"
 	"mynewt.apache.org/newtmgr/nmxact/sesn"
 )
 
+// Layouts that a device may use when reporting its date and time.  Devices
+// that have no notion of a timezone omit the UTC offset.
+var DateTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+}
+
+// Layout used when writing the date and time to a device.  Mynewt accepts at
+// most microsecond precision.
+const DATETIME_WRITE_LAYOUT = "2006-01-02T15:04:05.000000Z07:00"
+
+// Parses a date and time string reported by a device.
+func ParseDateTime(s string) (time.Time, error) {
+	for _, layout := range DateTimeLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid datetime: %s", s)
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 // $read                                                                     //
 ///////////////////////////////////////////////////////////////////////////////
@@ -61,7 +88,7 @@ func (c *DateTimeReadCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newDateTimeReadResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
 }
 
 ///////////////////////////////////////////////////////////////////////////////
@@ -103,5 +130,185 @@ func (c *DateTimeWriteCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newDateTimeWriteResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// $sync                                                                     //
+///////////////////////////////////////////////////////////////////////////////
+
+const DATETIME_SYNC_DFLT_ROUNDS = 5
+
+// The result of a single datetime read.
+type DateTimeSample struct {
+	// The device's clock, as reported.
+	Device time.Time
+
+	// The host's clock when the request was sent and when the response was
+	// received.
+	Sent     time.Time
+	Received time.Time
+}
+
+func (s *DateTimeSample) Rtt() time.Duration {
+	return s.Received.Sub(s.Sent)
+}
+
+// The difference between the device's clock and the host's clock.  The
+// device is assumed to have read its clock halfway through the round trip,
+// so the error is at most half the round trip time.
+func (s *DateTimeSample) Offset() time.Duration {
+	mid := s.Sent.Add(s.Rtt() / 2)
+	return s.Device.Sub(mid)
+}
+
+// Sets a device's clock to the host's UTC time, compensating for link
+// latency.  The command reads the device's clock Rounds times to estimate the
+// clock offset and the round trip time, then writes the host's time plus half
+// the median round trip time, so the value is correct when the device
+// receives it.  Finally, it reads the device's clock once more to measure the
+// residual error.
+//
+// If DryRun is set, the device's clock is measured but not written.
+type DateTimeSyncCmd struct {
+	CmdBase
+	Rounds int
+	DryRun bool
+}
+
+func NewDateTimeSyncCmd() *DateTimeSyncCmd {
+	return &DateTimeSyncCmd{
+		CmdBase: NewCmdBase(),
+		Rounds:  DATETIME_SYNC_DFLT_ROUNDS,
+	}
+}
+
+type DateTimeSyncResult struct {
+	// The reads performed before writing the clock.
+	Samples []DateTimeSample
+
+	// The clock offset estimated from the read with the shortest round trip,
+	// which is the least affected by queuing delays.
+	Offset time.Duration
+
+	// The shortest and median round trip times.
+	MinRtt    time.Duration
+	MedianRtt time.Duration
+
+	// The value written to the device; empty for a dry run.
+	DateTime string
+
+	// The read performed after writing the clock; nil for a dry run.
+	Verify *DateTimeSample
+
+	Rc int
+}
+
+func newDateTimeSyncResult() *DateTimeSyncResult {
+	return &DateTimeSyncResult{}
+}
+
+func (r *DateTimeSyncResult) Status() int {
+	return r.Rc
+}
+
+// Reads the device's clock.  A non-zero rc indicates the device rejected the
+// request.
+func (c *DateTimeSyncCmd) read(s sesn.Sesn) (DateTimeSample, int, error) {
+	cmd := NewDateTimeReadCmd()
+	cmd.SetTxOptions(c.TxOptions())
+
+	sample := DateTimeSample{
+		Sent: time.Now(),
+	}
+	res, err := cmd.Run(s)
+	if err != nil {
+		if gerr := nmp.ToNmpGroup(err); gerr != nil {
+			return sample, gerr.Rc, nil
+		}
+		return sample, 0, err
+	}
+	sample.Received = time.Now()
+
+	rsp := res.(*DateTimeReadResult).Rsp
+	if rsp.Rc != 0 {
+		return sample, rsp.Rc, nil
+	}
+
+	t, err := ParseDateTime(rsp.DateTime)
+	if err != nil {
+		return sample, 0, err
+	}
+	sample.Device = t
+
+	return sample, 0, nil
+}
+
+func (c *DateTimeSyncCmd) Run(s sesn.Sesn) (Result, error) {
+	if c.Rounds < 1 {
+		return nil, fmt.Errorf("invalid round count: %d", c.Rounds)
+	}
+
+	res := newDateTimeSyncResult()
+
+	for i := 0; i < c.Rounds; i++ {
+		sample, rc, err := c.read(s)
+		if err != nil {
+			return nil, err
+		}
+		if rc != 0 {
+			res.Rc = rc
+			return c.done(res)
+		}
+		res.Samples = append(res.Samples, sample)
+	}
+
+	rtts := make([]time.Duration, len(res.Samples))
+	best := res.Samples[0]
+	for i, sample := range res.Samples {
+		rtts[i] = sample.Rtt()
+		if sample.Rtt() < best.Rtt() {
+			best = sample
+		}
+	}
+	sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+
+	res.Offset = best.Offset()
+	res.MinRtt = rtts[0]
+	res.MedianRtt = rtts[len(rtts)/2]
+
+	if c.DryRun {
+		return c.done(res)
+	}
+
+	wc := NewDateTimeWriteCmd()
+	wc.SetTxOptions(c.TxOptions())
+	wc.DateTime = time.Now().Add(res.MedianRtt / 2).UTC().
+		Format(DATETIME_WRITE_LAYOUT)
+	res.DateTime = wc.DateTime
+
+	wres, err := wc.Run(s)
+	if err != nil {
+		if gerr := nmp.ToNmpGroup(err); gerr != nil {
+			res.Rc = gerr.Rc
+			return c.done(res)
+		}
+		return nil, err
+	}
+	if wres.Status() != 0 {
+		res.Rc = wres.Status()
+		return c.done(res)
+	}
+
+	sample, rc, err := c.read(s)
+	if err != nil {
+		return nil, err
+	}
+	if rc != 0 {
+		res.Rc = rc
+		return c.done(res)
+	}
+	res.Verify = &sample
+
+	return c.done(res)
 }
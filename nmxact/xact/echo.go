@@ -59,5 +59,45 @@ func (c *EchoCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newEchoResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
+}
+
+type ConsEchoCtrlCmd struct {
+	CmdBase
+	Echo bool
+}
+
+func NewConsEchoCtrlCmd() *ConsEchoCtrlCmd {
+	return &ConsEchoCtrlCmd{
+		CmdBase: NewCmdBase(),
+	}
+}
+
+type ConsEchoCtrlResult struct {
+	Rsp *nmp.ConsEchoCtrlRsp
+}
+
+func newConsEchoCtrlResult() *ConsEchoCtrlResult {
+	return &ConsEchoCtrlResult{}
+}
+
+func (r *ConsEchoCtrlResult) Status() int {
+	return r.Rsp.Rc
+}
+
+func (c *ConsEchoCtrlCmd) Run(s sesn.Sesn) (Result, error) {
+	r := nmp.NewConsEchoCtrlReq()
+	if c.Echo {
+		r.Echo = 1
+	}
+
+	rsp, err := txReq(s, r.Msg(), &c.CmdBase)
+	if err != nil {
+		return nil, err
+	}
+	srsp := rsp.(*nmp.ConsEchoCtrlRsp)
+
+	res := newConsEchoCtrlResult()
+	res.Rsp = srsp
+	return c.done(res)
 }
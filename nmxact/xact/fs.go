@@ -21,6 +21,7 @@ package xact
 
 import (
 	"fmt"
+	"io"
 
 	"mynewt.apache.org/newtmgr/nmxact/mgmt"
 	"mynewt.apache.org/newtmgr/nmxact/nmp"
@@ -32,9 +33,19 @@ import (
 //////////////////////////////////////////////////////////////////////////////
 
 type FsDownloadProgressCb func(c *FsDownloadCmd, r *nmp.FsDownloadRsp)
+
+// If Writer is not nil, the file contents are written to it as they arrive
+// and the responses in the result do not retain them.  Otherwise, the
+// contents are only available in the responses.
+//
+// The download starts at offset Off.  If Len is nonzero, at most Len bytes
+// are downloaded; otherwise the download continues to the end of the file.
 type FsDownloadCmd struct {
 	CmdBase
 	Name       string
+	Off        int
+	Len        int
+	Writer     io.Writer
 	ProgressCb FsDownloadProgressCb
 }
 
@@ -46,6 +57,13 @@ func NewFsDownloadCmd() *FsDownloadCmd {
 
 type FsDownloadResult struct {
 	Rsps []*nmp.FsDownloadRsp
+
+	// The size of the file, as reported by the device.  The device only
+	// reports the size in response to a request for offset 0.
+	Len int
+
+	// The number of bytes downloaded.
+	Count int
 }
 
 func newFsDownloadResult() *FsDownloadResult {
@@ -59,9 +77,14 @@ func (r *FsDownloadResult) Status() int {
 
 func (c *FsDownloadCmd) Run(s sesn.Sesn) (Result, error) {
 	res := newFsDownloadResult()
-	off := 0
+	off := c.Off
 
 	for {
+		if c.Len > 0 && res.Count >= c.Len {
+			// Requested range complete.
+			break
+		}
+
 		r := nmp.NewFsDownloadReq()
 		r.Name = c.Name
 		r.Off = uint32(off)
@@ -77,6 +100,15 @@ func (c *FsDownloadCmd) Run(s sesn.Sesn) (Result, error) {
 			break
 		}
 
+		if frsp.Off == 0 {
+			res.Len = int(frsp.Len)
+		}
+
+		// Discard anything past the end of the requested range.
+		if c.Len > 0 && res.Count+len(frsp.Data) > c.Len {
+			frsp.Data = frsp.Data[:c.Len-res.Count]
+		}
+
 		if c.ProgressCb != nil {
 			c.ProgressCb(c, frsp)
 		}
@@ -87,9 +119,17 @@ func (c *FsDownloadCmd) Run(s sesn.Sesn) (Result, error) {
 		}
 
 		off = int(frsp.Off) + len(frsp.Data)
+		res.Count += len(frsp.Data)
+
+		if c.Writer != nil {
+			if _, err := c.Writer.Write(frsp.Data); err != nil {
+				return nil, err
+			}
+			frsp.Data = nil
+		}
 	}
 
-	return res, nil
+	return c.done(res)
 }
 
 //////////////////////////////////////////////////////////////////////////////
@@ -97,10 +137,15 @@ func (c *FsDownloadCmd) Run(s sesn.Sesn) (Result, error) {
 //////////////////////////////////////////////////////////////////////////////
 
 type FsUploadProgressCb func(c *FsUploadCmd, r *nmp.FsUploadRsp)
+
+// The file contents are read from Reader, which contains Size bytes.  If
+// Reader is nil, the contents are taken from Data instead.
 type FsUploadCmd struct {
 	CmdBase
 	Name       string
 	Data       []byte
+	Reader     io.ReaderAt
+	Size       int
 	ProgressCb FsUploadProgressCb
 }
 
@@ -138,12 +183,12 @@ func buildFsUploadReq(name string, fileSz int, chunk []byte,
 	return r
 }
 
-func nextFsUploadReq(s sesn.Sesn, name string, data []byte, off int) (
-	*nmp.FsUploadReq, error) {
+func nextFsUploadReq(s sesn.Sesn, name string, src io.ReaderAt, size int,
+	off int) (*nmp.FsUploadReq, error) {
 
 	// First, build a request without data to determine how much data could
 	// fit.
-	empty := buildFsUploadReq(name, len(data), nil, off)
+	empty := buildFsUploadReq(name, size, nil, off)
 	emptyEnc, err := mgmt.EncodeMgmt(s, empty.Msg())
 	if err != nil {
 		return nil, err
@@ -155,15 +200,15 @@ func nextFsUploadReq(s sesn.Sesn, name string, data []byte, off int) (
 			"MTU too low to fit any file data")
 	}
 
-	if off+room > len(data) {
-		// Final chunk.
-		room = len(data) - off
+	chunk, err := readChunk(src, size, off, room)
+	if err != nil {
+		return nil, err
 	}
 
 	// Assume all the unused space can hold file data.  This assumption may not
 	// be valid for some encodings (e.g., CBOR uses variable length fields to
 	// encodes byte string lengths).
-	r := buildFsUploadReq(name, len(data), data[off:off+room], off)
+	r := buildFsUploadReq(name, size, chunk, off)
 	enc, err := mgmt.EncodeMgmt(s, r.Msg())
 	if err != nil {
 		return nil, err
@@ -172,17 +217,20 @@ func nextFsUploadReq(s sesn.Sesn, name string, data []byte, off int) (
 	oversize := len(enc) - s.MtuOut()
 	if oversize > 0 {
 		// Request too big.  Reduce the amount of file data.
-		r = buildFsUploadReq(name, len(data), data[off:off+room-oversize], off)
+		r = buildFsUploadReq(name, size, chunk[:len(chunk)-oversize], off)
 	}
 
 	return r, nil
 }
 
 func (c *FsUploadCmd) Run(s sesn.Sesn) (Result, error) {
+	src, size := uploadSrc(c.Reader, c.Size, c.Data)
 	res := newFsUploadResult()
 
-	for off := 0; off < len(c.Data); {
-		r, err := nextFsUploadReq(s, c.Name, c.Data, off)
+	// An empty file still takes a single request to create.
+	off := 0
+	for {
+		r, err := nextFsUploadReq(s, c.Name, src, size, off)
 		if err != nil {
 			return nil, err
 		}
@@ -200,10 +248,260 @@ func (c *FsUploadCmd) Run(s sesn.Sesn) (Result, error) {
 		}
 
 		res.Rsps = append(res.Rsps, crsp)
-		if crsp.Rc != 0 {
+		if crsp.Rc != 0 || off >= size {
+			break
+		}
+	}
+
+	return c.done(res)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $stat                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+type FsStatCmd struct {
+	CmdBase
+	Name string
+}
+
+func NewFsStatCmd() *FsStatCmd {
+	return &FsStatCmd{
+		CmdBase: NewCmdBase(),
+	}
+}
+
+type FsStatResult struct {
+	Rsp *nmp.FsStatRsp
+}
+
+func newFsStatResult() *FsStatResult {
+	return &FsStatResult{}
+}
+
+func (r *FsStatResult) Status() int {
+	return r.Rsp.Rc
+}
+
+func (c *FsStatCmd) Run(s sesn.Sesn) (Result, error) {
+	r := nmp.NewFsStatReq()
+	r.Name = c.Name
+
+	rsp, err := txReq(s, r.Msg(), &c.CmdBase)
+	if err != nil {
+		return nil, err
+	}
+	srsp := rsp.(*nmp.FsStatRsp)
+
+	res := newFsStatResult()
+	res.Rsp = srsp
+	return c.done(res)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $hash                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+// Calculates a hash or checksum of a file, or of a part of it.  A Len of 0
+// indicates the rest of the file.
+type FsHashCmd struct {
+	CmdBase
+	Name string
+	Type string
+	Off  int
+	Len  int
+}
+
+func NewFsHashCmd() *FsHashCmd {
+	return &FsHashCmd{
+		CmdBase: NewCmdBase(),
+		Type:    nmp.FS_HASH_SHA256,
+	}
+}
+
+type FsHashResult struct {
+	Rsp *nmp.FsHashRsp
+}
+
+func newFsHashResult() *FsHashResult {
+	return &FsHashResult{}
+}
+
+func (r *FsHashResult) Status() int {
+	return r.Rsp.Rc
+}
+
+func (c *FsHashCmd) Run(s sesn.Sesn) (Result, error) {
+	r := nmp.NewFsHashReq()
+	r.Name = c.Name
+	r.Type = c.Type
+	r.Off = uint32(c.Off)
+	r.Len = uint32(c.Len)
+
+	rsp, err := txReq(s, r.Msg(), &c.CmdBase)
+	if err != nil {
+		return nil, err
+	}
+	srsp := rsp.(*nmp.FsHashRsp)
+
+	res := newFsHashResult()
+	res.Rsp = srsp
+	return c.done(res)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $ls                                                                      //
+//////////////////////////////////////////////////////////////////////////////
+
+// Lists the contents of a directory.  Large directories are listed over
+// several requests; each request asks for the entries following those
+// already received.  Listing stops at an empty page, at a page shorter than
+// the one before it, or at a page with no new entries (e.g., from a device
+// that ignores the requested offset).
+type FsLsCmd struct {
+	CmdBase
+	Name string
+}
+
+func NewFsLsCmd() *FsLsCmd {
+	return &FsLsCmd{
+		CmdBase: NewCmdBase(),
+	}
+}
+
+type FsLsResult struct {
+	Rsps    []*nmp.FsLsRsp
+	Entries []nmp.FsEntry
+}
+
+func newFsLsResult() *FsLsResult {
+	return &FsLsResult{}
+}
+
+func (r *FsLsResult) Status() int {
+	rsp := r.Rsps[len(r.Rsps)-1]
+	return rsp.Rc
+}
+
+func (c *FsLsCmd) Run(s sesn.Sesn) (Result, error) {
+	res := newFsLsResult()
+	seen := map[string]bool{}
+	prevLen := 0
+
+	for {
+		r := nmp.NewFsLsReq()
+		r.Name = c.Name
+		r.Off = uint32(len(res.Entries))
+
+		rsp, err := txReq(s, r.Msg(), &c.CmdBase)
+		if err != nil {
+			return nil, err
+		}
+		frsp := rsp.(*nmp.FsLsRsp)
+		res.Rsps = append(res.Rsps, frsp)
+
+		if frsp.Rc != 0 {
+			break
+		}
+
+		added := 0
+		for _, e := range frsp.Entries {
+			if !seen[e.Name] {
+				seen[e.Name] = true
+				res.Entries = append(res.Entries, e)
+				added++
+			}
+		}
+
+		if added == 0 || len(frsp.Entries) < prevLen {
 			break
 		}
+		prevLen = len(frsp.Entries)
+	}
+
+	return c.done(res)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $unlink                                                                  //
+//////////////////////////////////////////////////////////////////////////////
+
+type FsUnlinkCmd struct {
+	CmdBase
+	Name string
+}
+
+func NewFsUnlinkCmd() *FsUnlinkCmd {
+	return &FsUnlinkCmd{
+		CmdBase: NewCmdBase(),
+	}
+}
+
+type FsUnlinkResult struct {
+	Rsp *nmp.FsUnlinkRsp
+}
+
+func newFsUnlinkResult() *FsUnlinkResult {
+	return &FsUnlinkResult{}
+}
+
+func (r *FsUnlinkResult) Status() int {
+	return r.Rsp.Rc
+}
+
+func (c *FsUnlinkCmd) Run(s sesn.Sesn) (Result, error) {
+	r := nmp.NewFsUnlinkReq()
+	r.Name = c.Name
+
+	rsp, err := txReq(s, r.Msg(), &c.CmdBase)
+	if err != nil {
+		return nil, err
+	}
+	srsp := rsp.(*nmp.FsUnlinkRsp)
+
+	res := newFsUnlinkResult()
+	res.Rsp = srsp
+	return c.done(res)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $mkdir                                                                   //
+//////////////////////////////////////////////////////////////////////////////
+
+type FsMkdirCmd struct {
+	CmdBase
+	Name string
+}
+
+func NewFsMkdirCmd() *FsMkdirCmd {
+	return &FsMkdirCmd{
+		CmdBase: NewCmdBase(),
+	}
+}
+
+type FsMkdirResult struct {
+	Rsp *nmp.FsMkdirRsp
+}
+
+func newFsMkdirResult() *FsMkdirResult {
+	return &FsMkdirResult{}
+}
+
+func (r *FsMkdirResult) Status() int {
+	return r.Rsp.Rc
+}
+
+func (c *FsMkdirCmd) Run(s sesn.Sesn) (Result, error) {
+	r := nmp.NewFsMkdirReq()
+	r.Name = c.Name
+
+	rsp, err := txReq(s, r.Msg(), &c.CmdBase)
+	if err != nil {
+		return nil, err
 	}
+	srsp := rsp.(*nmp.FsMkdirRsp)
 
-	return res, nil
+	res := newFsMkdirResult()
+	res.Rsp = srsp
+	return c.done(res)
 }
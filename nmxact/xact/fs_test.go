@@ -0,0 +1,132 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package xact
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
+)
+
+// lsSesn answers directory listing requests with pages produced by a
+// function of the requested offset.  Only the methods used by FsLsCmd are
+// implemented.
+type lsSesn struct {
+	sesn.Sesn
+	page func(off int) []nmp.FsEntry
+	reqs int
+}
+
+func (s *lsSesn) TxRxMgmt(m *nmp.NmpMsg,
+	timeout time.Duration) (nmp.NmpRsp, error) {
+
+	s.reqs++
+	if s.reqs > 100 {
+		return nil, fmt.Errorf("too many listing requests")
+	}
+
+	req := m.Body.(*nmp.FsLsReq)
+	rsp := nmp.NewFsLsRsp()
+	rsp.Entries = s.page(int(req.Off))
+	return rsp, nil
+}
+
+func lsEntries(first int, n int) []nmp.FsEntry {
+	var entries []nmp.FsEntry
+	for i := first; i < first+n; i++ {
+		entries = append(entries, nmp.FsEntry{
+			Name: fmt.Sprintf("f%03d", i),
+			Type: nmp.FS_ENTRY_TYPE_FILE,
+		})
+	}
+	return entries
+}
+
+// lsPages pages through total entries, pageSz at a time.
+func lsPages(total int, pageSz int) func(off int) []nmp.FsEntry {
+	return func(off int) []nmp.FsEntry {
+		n := total - off
+		if n > pageSz {
+			n = pageSz
+		}
+		return lsEntries(off, n)
+	}
+}
+
+func TestFsLsPaging(t *testing.T) {
+	tests := []struct {
+		name    string
+		page    func(off int) []nmp.FsEntry
+		entries int
+		reqs    int
+	}{
+		{"empty", lsPages(0, 8), 0, 1},
+		{"one short page", lsPages(3, 8), 3, 2},
+		{"one full page", lsPages(8, 8), 8, 2},
+		{"several pages", lsPages(20, 8), 20, 3},
+		{"exact pages", lsPages(16, 8), 16, 3},
+
+		// A device that ignores the offset keeps returning the first page.
+		{"offset ignored", func(off int) []nmp.FsEntry {
+			return lsEntries(0, 8)
+		}, 8, 2},
+
+		// A device that returns overlapping pages; the short second page
+		// ends the listing.
+		{"overlap", func(off int) []nmp.FsEntry {
+			if off > 0 {
+				off -= 2
+			}
+			return lsPages(12, 8)(off)
+		}, 12, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &lsSesn{page: tt.page}
+
+			c := NewFsLsCmd()
+			c.SetTxOptions(simTxOptions())
+			c.Name = "/"
+
+			res, err := c.Run(s)
+			if err != nil {
+				t.Fatalf("ls failed: %s", err.Error())
+			}
+
+			lres := res.(*FsLsResult)
+			if len(lres.Entries) != tt.entries {
+				t.Fatalf("got %d entries; want %d",
+					len(lres.Entries), tt.entries)
+			}
+			for i, e := range lres.Entries {
+				if want := fmt.Sprintf("f%03d", i); e.Name != want {
+					t.Fatalf("entry %d is %s; want %s", i, e.Name, want)
+				}
+			}
+			if s.reqs != tt.reqs {
+				t.Fatalf("sent %d requests; want %d", s.reqs, tt.reqs)
+			}
+		})
+	}
+}
@@ -20,18 +20,21 @@
 package xact
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"fmt"
+	"io"
+	"time"
 
 	pb "gopkg.in/cheggaaa/pb.v1"
 
 	log "github.com/sirupsen/logrus"
 	"mynewt.apache.org/newtmgr/nmxact/mgmt"
+	"mynewt.apache.org/newtmgr/nmxact/nmimage"
 	"mynewt.apache.org/newtmgr/nmxact/nmp"
 	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
 	"mynewt.apache.org/newtmgr/nmxact/sesn"
 	"sync"
-	"sync/atomic"
 )
 
 //////////////////////////////////////////////////////////////////////////////
@@ -46,10 +49,20 @@ const IMAGE_UPLOAD_DEF_MAX_WS = 5
 const IMAGE_UPLOAD_STATUS_EXPECTED = 0
 const IMAGE_UPLOAD_STATUS_RQ = 1
 
+// The number of times an upload is continued from the device's last
+// acknowledged offset without the device making any progress before the
+// upload fails.
+const IMAGE_UPLOAD_MAX_STALLS = 5
+
 type ImageUploadProgressFn func(c *ImageUploadCmd, r *nmp.ImageUploadRsp)
+
+// The image to upload is read from Reader, which contains Size bytes.  If
+// Reader is nil, the image is taken from Data instead.
 type ImageUploadCmd struct {
 	CmdBase
 	Data       []byte
+	Reader     io.ReaderAt
+	Size       int
 	StartOff   int
 	Upgrade    bool
 	ProgressCb ImageUploadProgressFn
@@ -65,6 +78,19 @@ type ImageUploadIntTracker struct {
 	WCap     int
 	Off      int
 	MaxRxOff int32
+
+	// The first nonzero status code the device responded with.
+	rc int
+
+	// The group error that the device rejected the upload with, if any.
+	rcErr error
+
+	// The most recent error reported for an outstanding request.
+	lastErr error
+
+	// Set once the upload command has returned; later responses are
+	// ignored.
+	finished bool
 }
 
 type ImageUploadResult struct {
@@ -89,6 +115,44 @@ func (r *ImageUploadResult) Status() int {
 	}
 }
 
+// uploadSrc returns the source of an upload's data.  If no reader is
+// specified, the data comes from the byte slice.
+func uploadSrc(r io.ReaderAt, size int, data []byte) (io.ReaderAt, int) {
+	if r == nil {
+		return bytes.NewReader(data), len(data)
+	}
+
+	return r, size
+}
+
+// readChunk reads at most maxLen bytes starting at the specified offset.
+func readChunk(src io.ReaderAt, size int, off int,
+	maxLen int) ([]byte, error) {
+
+	buf := make([]byte, min(size-off, maxLen))
+	n, err := src.ReadAt(buf, int64(off))
+	if n < len(buf) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("Failed to read upload data at offset %d: %s",
+			off, err.Error())
+	}
+
+	return buf, nil
+}
+
+// imageUploadHash calculates the SHA256 of the image being uploaded.
+func imageUploadHash(src io.ReaderAt, size int) ([]byte, error) {
+	h := sha256.New()
+	sr := io.NewSectionReader(src, 0, int64(size))
+	if _, err := io.Copy(h, sr); err != nil {
+		return nil, fmt.Errorf("Failed to read upload data: %s", err.Error())
+	}
+
+	return h.Sum(nil), nil
+}
+
 func buildImageUploadReq(imageSz int, hash []byte, upgrade bool, chunk []byte,
 	off int, imageNum int, seq uint8) *nmp.ImageUploadReq {
 
@@ -113,11 +177,10 @@ func min(a, b int) int {
 	return b
 }
 
-func encodeUploadReq(s sesn.Sesn, hash []byte, upgrade bool, data []byte,
-	off int, chunklen int, imageNum int, seq uint8) ([]byte, error) {
+func encodeUploadReq(s sesn.Sesn, hash []byte, upgrade bool, imageSz int,
+	chunk []byte, off int, imageNum int, seq uint8) ([]byte, error) {
 
-	r := buildImageUploadReq(len(data), hash, upgrade, data[off:off+chunklen],
-		off, imageNum, seq)
+	r := buildImageUploadReq(imageSz, hash, upgrade, chunk, off, imageNum, seq)
 	enc, err := mgmt.EncodeMgmt(s, r.Msg())
 	if err != nil {
 		return nil, err
@@ -126,16 +189,17 @@ func encodeUploadReq(s sesn.Sesn, hash []byte, upgrade bool, data []byte,
 	return enc, nil
 }
 
-func findChunkLen(s sesn.Sesn, hash []byte, upgrade bool, data []byte,
-	off int, imageNum int, seq uint8) (int, error) {
+func findChunkLen(s sesn.Sesn, hash []byte, upgrade bool, imageSz int,
+	chunk []byte, off int, imageNum int, seq uint8) (int, error) {
 
-	// Let's start by encoding max allowed chunk len and we will see how many
-	// bytes we need to cut
-	chunklen := min(len(data)-off, IMAGE_UPLOAD_MAX_CHUNK)
+	// Let's start by encoding the entire chunk we read and we will see how
+	// many bytes we need to cut
+	chunklen := len(chunk)
 
 	// Keep reducing the chunk size until the request fits the MTU.
 	for {
-		enc, err := encodeUploadReq(s, hash, upgrade, data, off, chunklen, imageNum, seq)
+		enc, err := encodeUploadReq(s, hash, upgrade, imageSz,
+			chunk[:chunklen], off, imageNum, seq)
 		if err != nil {
 			return 0, err
 		}
@@ -157,9 +221,11 @@ func findChunkLen(s sesn.Sesn, hash []byte, upgrade bool, data []byte,
 	return chunklen, nil
 }
 
-func nextImageUploadReq(s sesn.Sesn, upgrade bool, data []byte, off int, imageNum int) (
-	*nmp.ImageUploadReq, error) {
-	var hash []byte = nil
+// nextImageUploadReq builds the request carrying the image data at the
+// specified offset.  hash is the SHA256 of the entire image; it is only sent
+// with the first chunk.
+func nextImageUploadReq(s sesn.Sesn, upgrade bool, src io.ReaderAt,
+	size int, hash []byte, off int, imageNum int) (*nmp.ImageUploadReq, error) {
 
 	// Ensure we produce consistent requests while we calculate the chunk
 	// length.
@@ -169,16 +235,21 @@ func nextImageUploadReq(s sesn.Sesn, upgrade bool, data []byte, off int, imageNu
 		defer txFilter.Unfreeze()
 	}
 
-	// For 1st chunk we'll need valid data hash
-	if off == 0 {
-		sha := sha256.Sum256(data)
-		hash = sha[:]
+	// Only the 1st chunk carries the data hash
+	if off != 0 {
+		hash = nil
+	}
+
+	chunk, err := readChunk(src, size, off, IMAGE_UPLOAD_MAX_CHUNK)
+	if err != nil {
+		return nil, err
 	}
 
 	seq := nmxutil.NextNmpSeq()
 
 	// Find chunk length
-	chunklen, err := findChunkLen(s, hash, upgrade, data, off, imageNum, seq)
+	chunklen, err := findChunkLen(s, hash, upgrade, size, chunk, off,
+		imageNum, seq)
 	if err != nil {
 		return nil, err
 	}
@@ -187,7 +258,8 @@ func nextImageUploadReq(s sesn.Sesn, upgrade bool, data []byte, off int, imageNu
 	// fit we'll recalculate without hash
 	if off == 0 && chunklen < IMAGE_UPLOAD_MIN_1ST_CHUNK {
 		hash = nil
-		chunklen, err = findChunkLen(s, hash, upgrade, data, off, imageNum, seq)
+		chunklen, err = findChunkLen(s, hash, upgrade, size, chunk, off,
+			imageNum, seq)
 		if err != nil {
 			return nil, err
 		}
@@ -201,8 +273,8 @@ func nextImageUploadReq(s sesn.Sesn, upgrade bool, data []byte, off int, imageNu
 			s.MtuOut(), chunklen)
 	}
 
-	r := buildImageUploadReq(len(data), hash, upgrade,
-		data[off:off+chunklen], off, imageNum, seq)
+	r := buildImageUploadReq(size, hash, upgrade, chunk[:chunklen], off,
+		imageNum, seq)
 
 	// Request above should encode just fine since we calculate proper chunk
 	// length but (at least for now) let's double check it
@@ -267,13 +339,24 @@ func (t *ImageUploadIntTracker) HandleResponse(c *ImageUploadCmd, rsp nmp.NmpRsp
 	defer t.Mutex.Unlock()
 	wFull := false
 
+	if t.finished {
+		return false
+	}
+
 	if rsp != nil {
 		irsp := rsp.(*nmp.ImageUploadRsp)
 		res.Rsps = append(res.Rsps, irsp)
-		t.UpdateTracker(int(irsp.Off), IMAGE_UPLOAD_STATUS_RQ)
+		if irsp.Rc != 0 {
+			// The device rejected the upload.
+			if t.rc == 0 {
+				t.rc = irsp.Rc
+			}
+		} else {
+			t.UpdateTracker(int(irsp.Off), IMAGE_UPLOAD_STATUS_RQ)
 
-		if t.MaxRxOff < int32(irsp.Off) {
-			t.MaxRxOff = int32(irsp.Off)
+			if t.MaxRxOff < int32(irsp.Off) {
+				t.MaxRxOff = int32(irsp.Off)
+			}
 		}
 		if c.ProgressCb != nil {
 			c.ProgressCb(c, irsp)
@@ -306,11 +389,25 @@ func (t *ImageUploadIntTracker) HandleError(off int, err error) bool {
 	t.Mutex.Lock()
 	defer t.Mutex.Unlock()
 	log.Debugf("HandleError off %v error %v", off, err)
+	if t.finished {
+		return false
+	}
+	t.lastErr = err
 	var wFull = false
 	if t.WCap == t.WCount {
 		wFull = true
 	}
 
+	// A version 2 device rejected the upload; retransmitting won't help.
+	if gerr := nmp.ToNmpGroup(err); gerr != nil {
+		if t.rc == 0 {
+			t.rc = gerr.Rc
+			t.rcErr = err
+		}
+		t.WCount -= 1
+		return wFull && t.WCap > t.WCount
+	}
+
 	if t.WCount > IMAGE_UPLOAD_START_WS+1 {
 		t.WCap -= 1
 	}
@@ -327,21 +424,75 @@ func (t *ImageUploadIntTracker) HandleError(off int, err error) bool {
 }
 
 func (c *ImageUploadCmd) Run(s sesn.Sesn) (Result, error) {
+	src, size := uploadSrc(c.Reader, c.Size, c.Data)
+	hash, err := imageUploadHash(src, size)
+	if err != nil {
+		return nil, err
+	}
+
 	res := newImageUploadResult()
 	ch := make(chan int)
 	rspc := make(chan nmp.NmpRsp, c.MaxWinSz)
 	errc := make(chan error, c.MaxWinSz)
 
+	// Signalled whenever an outstanding request completes.
+	evc := make(chan struct{}, 1)
+
+	// Closed when the upload ends so that late responses are discarded.
+	donec := make(chan struct{})
+	defer close(donec)
+
 	t := ImageUploadIntTracker{
 		TuneWS:   true,
 		WCount:   0,
 		WCap:     IMAGE_UPLOAD_START_WS,
 		Off:      c.StartOff,
 		RspMap:   make(map[int]int),
-		MaxRxOff: 0,
+		MaxRxOff: int32(c.StartOff),
 	}
 
-	for int(atomic.LoadInt32(&t.MaxRxOff)) < len(c.Data) {
+	stalls := 0
+	stallOff := -1
+
+	for {
+		t.Mutex.Lock()
+		if t.rc != 0 || int(t.MaxRxOff) >= size {
+			t.Mutex.Unlock()
+			break
+		}
+
+		// Once every chunk has been sent, wait for the outstanding
+		// requests to complete.  If none are outstanding and the device
+		// still hasn't received everything, the tail of the upload was
+		// lost; continue from the last offset the device acknowledged.
+		if t.Off >= size {
+			if t.WCount > 0 {
+				t.Mutex.Unlock()
+				<-evc
+				continue
+			}
+
+			if int(t.MaxRxOff) == stallOff {
+				stalls++
+			} else {
+				stalls = 1
+				stallOff = int(t.MaxRxOff)
+			}
+			if stalls > IMAGE_UPLOAD_MAX_STALLS {
+				err := t.lastErr
+				t.Mutex.Unlock()
+				if err == nil {
+					err = fmt.Errorf("ImageUpload stalled at %d/%d bytes",
+						stallOff, size)
+				}
+				return nil, err
+			}
+
+			t.Off = int(t.MaxRxOff)
+			t.RspMap = make(map[int]int)
+		}
+		t.Mutex.Unlock()
+
 		// Block if window is full
 		if !t.CheckWindow() {
 			ch <- 1
@@ -349,12 +500,16 @@ func (c *ImageUploadCmd) Run(s sesn.Sesn) (Result, error) {
 
 		t.ProcessMissedChunks()
 
-		if t.Off == len(c.Data) {
+		// The device may have rejected the upload while we were waiting
+		// for the window to open.
+		t.Mutex.Lock()
+		if t.rc != 0 || t.Off >= size {
+			t.Mutex.Unlock()
 			continue
 		}
 
-		t.Mutex.Lock()
-		r, err := nextImageUploadReq(s, c.Upgrade, c.Data, t.Off, c.ImageNum)
+		r, err := nextImageUploadReq(s, c.Upgrade, src, size, hash, t.Off,
+			c.ImageNum)
 		if err != nil {
 			t.Mutex.Unlock()
 			return nil, err
@@ -367,36 +522,56 @@ func (c *ImageUploadCmd) Run(s sesn.Sesn) (Result, error) {
 		err = txReqAsync(s, r.Msg(), &c.CmdBase, rspc, errc)
 		if err != nil {
 			log.Debugf("err txReqAsync %v", err)
+			t.WCount -= 1
+			t.finished = true
 			t.Mutex.Unlock()
-			break
+			return nil, err
 		}
 		// Mark the expected offset in successful tx of this chunk. i.e off + len
 		t.UpdateTracker(int(r.Off)+len(r.Data), IMAGE_UPLOAD_STATUS_EXPECTED)
 		t.Mutex.Unlock()
 
 		go func(off int) {
+			var sig bool
 			select {
 			case err := <-errc:
-				sig := t.HandleError(off, err)
-				if sig {
-					<-ch
-				}
-				return
+				sig = t.HandleError(off, err)
 			case rsp := <-rspc:
-				sig := t.HandleResponse(c, rsp, res)
-				if sig {
-					<-ch
-				}
+				sig = t.HandleResponse(c, rsp, res)
+			case <-donec:
 				return
 			}
+
+			select {
+			case evc <- struct{}{}:
+			default:
+			}
+
+			if sig {
+				select {
+				case <-ch:
+				case <-donec:
+				}
+			}
 		}(int(r.Off))
 	}
 
-	if int(t.MaxRxOff) == len(c.Data) {
-		return res, nil
+	// Stop the remaining handlers from touching the result.
+	t.Mutex.Lock()
+	t.finished = true
+	maxRxOff := int(t.MaxRxOff)
+	rc := t.rc
+	rcErr := t.rcErr
+	t.Mutex.Unlock()
+
+	if rcErr != nil {
+		return nil, rcErr
+	}
+	if rc != 0 || maxRxOff == size {
+		return c.done(res)
 	} else {
 		return nil, fmt.Errorf("ImageUpload unexpected error after %d/%d bytes",
-			t.MaxRxOff, len(c.Data))
+			maxRxOff, size)
 	}
 }
 
@@ -417,10 +592,15 @@ func (c *ImageUploadCmd) Run(s sesn.Sesn) (Result, error) {
 //    to step 5.
 // 5. Execute the upload command.  If the connection drops before the final
 //    part is uploaded, reconnect and retry the previous part.
+//
+// If StartOff is nonzero, the command continues an interrupted upload from
+// that offset and the erase step is skipped.
 
 type ImageUpgradeCmd struct {
 	CmdBase
 	Data        []byte
+	Reader      io.ReaderAt
+	Size        int
 	NoErase     bool
 	ProgressCb  ImageUploadProgressFn
 	LastOff     uint32
@@ -428,6 +608,7 @@ type ImageUpgradeCmd struct {
 	ProgressBar *pb.ProgressBar
 	ImageNum    int
 	MaxWinSz    int
+	StartOff    int
 }
 
 type ImageUpgradeResult struct {
@@ -489,7 +670,7 @@ func (c *ImageUpgradeCmd) runErase(s sesn.Sesn) (*ImageEraseResult, error) {
 }
 
 func (c *ImageUpgradeCmd) runUpload(s sesn.Sesn) (*ImageUploadResult, error) {
-	startOff := 0
+	startOff := c.StartOff
 	progressCb := func(uc *ImageUploadCmd, r *nmp.ImageUploadRsp) {
 		if r.Rc == 0 {
 			startOff = int(r.Off)
@@ -504,6 +685,8 @@ func (c *ImageUpgradeCmd) runUpload(s sesn.Sesn) (*ImageUploadResult, error) {
 		}
 		cmd := NewImageUploadCmd()
 		cmd.Data = c.Data
+		cmd.Reader = c.Reader
+		cmd.Size = c.Size
 		cmd.StartOff = startOff
 		cmd.Upgrade = c.Upgrade
 		cmd.ProgressCb = progressCb
@@ -529,7 +712,7 @@ func (c *ImageUpgradeCmd) Run(s sesn.Sesn) (Result, error) {
 	var eres *ImageEraseResult = nil
 	var err error
 
-	if c.NoErase == false {
+	if c.NoErase == false && c.StartOff == 0 {
 		eres, err = c.runErase(s)
 		if err != nil {
 			return nil, err
@@ -545,7 +728,128 @@ func (c *ImageUpgradeCmd) Run(s sesn.Sesn) (Result, error) {
 	upgradeRes := newImageUpgradeResult()
 	upgradeRes.EraseRes = eres
 	upgradeRes.UploadRes = ures
-	return upgradeRes, nil
+	return c.done(upgradeRes)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $resume                                                                  //
+//////////////////////////////////////////////////////////////////////////////
+
+// Image resume determines where an interrupted upload of an image can be
+// continued from.  Off is the last offset known to have been acknowledged
+// before the upload was interrupted; the device may have received more.  The
+// device's partial upload is checked as follows:
+// 1. Send the chunk at Off.  If the device accepts it, or replies that it
+//    already has more of the image, the partial upload still matches and the
+//    upload continues from the offset the device replies with.
+// 2. Otherwise, send the first chunk along with the image's SHA256.  A device
+//    that recognizes the hash of its partial upload replies with the offset
+//    it needs next.  A device that doesn't starts the upload over.
+//
+// The result's Off field indicates where the upload command should start.
+// Resumed is false if the device had to start over.
+
+type ImageResumeCmd struct {
+	CmdBase
+	Data     []byte
+	Reader   io.ReaderAt
+	Size     int
+	Off      int
+	Upgrade  bool
+	ImageNum int
+}
+
+type ImageResumeResult struct {
+	Rsp     *nmp.ImageUploadRsp
+	Off     int
+	Resumed bool
+}
+
+func NewImageResumeCmd() *ImageResumeCmd {
+	return &ImageResumeCmd{
+		CmdBase: NewCmdBase(),
+	}
+}
+
+func newImageResumeResult() *ImageResumeResult {
+	return &ImageResumeResult{}
+}
+
+func (r *ImageResumeResult) Status() int {
+	return r.Rsp.Rc
+}
+
+// probe sends the chunk at c.Off.  It returns nil if the device doesn't
+// have at least c.Off bytes of the upload.
+func (c *ImageResumeCmd) probe(s sesn.Sesn, src io.ReaderAt,
+	size int) (*nmp.ImageUploadRsp, error) {
+
+	r, err := nextImageUploadReq(s, c.Upgrade, src, size, nil, c.Off,
+		c.ImageNum)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp, err := txReq(s, r.Msg(), &c.CmdBase)
+	if err != nil {
+		if nmp.IsNmpGroup(err) {
+			// No upload in progress.
+			return nil, nil
+		}
+		return nil, err
+	}
+	irsp := rsp.(*nmp.ImageUploadRsp)
+
+	// A device that is further along than c.Off ignores the chunk and
+	// replies with the offset it needs next.
+	if irsp.Rc != 0 || int(irsp.Off) <= c.Off || int(irsp.Off) > size {
+		log.Debugf("image resume probe mismatch: off=%d rc=%d rsp-off=%d",
+			c.Off, irsp.Rc, irsp.Off)
+		return nil, nil
+	}
+
+	return irsp, nil
+}
+
+func (c *ImageResumeCmd) Run(s sesn.Sesn) (Result, error) {
+	src, size := uploadSrc(c.Reader, c.Size, c.Data)
+	res := newImageResumeResult()
+
+	if c.Off > 0 && c.Off < size {
+		rsp, err := c.probe(s, src, size)
+		if err != nil {
+			return nil, err
+		}
+		if rsp != nil {
+			res.Rsp = rsp
+			res.Off = int(rsp.Off)
+			res.Resumed = true
+			return c.done(res)
+		}
+	}
+
+	hash, err := imageUploadHash(src, size)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := nextImageUploadReq(s, c.Upgrade, src, size, hash, 0, c.ImageNum)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp, err := txReq(s, r.Msg(), &c.CmdBase)
+	if err != nil {
+		return nil, err
+	}
+	irsp := rsp.(*nmp.ImageUploadRsp)
+
+	res.Rsp = irsp
+	if irsp.Rc == 0 {
+		res.Off = int(irsp.Off)
+		res.Resumed = res.Off != len(r.Data)
+	}
+	return c.done(res)
 }
 
 //////////////////////////////////////////////////////////////////////////////
@@ -585,7 +889,7 @@ func (c *ImageStateReadCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newImageStateReadResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
 }
 
 //////////////////////////////////////////////////////////////////////////////
@@ -629,7 +933,7 @@ func (c *ImageStateWriteCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newImageStateWriteResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
 }
 
 //////////////////////////////////////////////////////////////////////////////
@@ -669,7 +973,7 @@ func (c *CoreListCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newCoreListResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
 }
 
 //////////////////////////////////////////////////////////////////////////////
@@ -709,7 +1013,7 @@ func (c *ImageEraseCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newImageEraseResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
 }
 
 //////////////////////////////////////////////////////////////////////////////
@@ -717,13 +1021,21 @@ func (c *ImageEraseCmd) Run(s sesn.Sesn) (Result, error) {
 //////////////////////////////////////////////////////////////////////////////
 
 type CoreLoadProgressFn func(c *CoreLoadCmd, r *nmp.CoreLoadRsp)
+
+// If Writer is not nil, the core contents are written to it as they arrive
+// and the responses in the result do not retain them.  Otherwise, the
+// contents are only available in the responses.
 type CoreLoadCmd struct {
 	CmdBase
+	Writer     io.Writer
 	ProgressCb CoreLoadProgressFn
 }
 
 type CoreLoadResult struct {
 	Rsps []*nmp.CoreLoadRsp
+
+	// The size of the core, as reported by the device.
+	Len int
 }
 
 func NewCoreLoadCmd() *CoreLoadCmd {
@@ -755,6 +1067,10 @@ func (c *CoreLoadCmd) Run(s sesn.Sesn) (Result, error) {
 		}
 		irsp := rsp.(*nmp.CoreLoadRsp)
 
+		if irsp.Rc == 0 && irsp.Off == 0 {
+			res.Len = int(irsp.Len)
+		}
+
 		if c.ProgressCb != nil {
 			c.ProgressCb(c, irsp)
 		}
@@ -770,9 +1086,16 @@ func (c *CoreLoadCmd) Run(s sesn.Sesn) (Result, error) {
 		}
 
 		off = int(irsp.Off) + len(irsp.Data)
+
+		if c.Writer != nil {
+			if _, err := c.Writer.Write(irsp.Data); err != nil {
+				return nil, err
+			}
+			irsp.Data = nil
+		}
 	}
 
-	return res, nil
+	return c.done(res)
 }
 
 //////////////////////////////////////////////////////////////////////////////
@@ -812,5 +1135,378 @@ func (c *CoreEraseCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newCoreEraseResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $deploy                                                                  //
+//////////////////////////////////////////////////////////////////////////////
+
+// Image deploy performs the full sequence for installing a new image:
+// 1. Read the image state to determine which image is running.
+// 2. Upload the image (image upgrade command).
+// 3. Mark the image for test on the next reboot.
+// 4. Reset the device and wait for it to come back.
+// 5. Verify that the device is running the new image.
+// 6. Run the health checks, if any.
+// 7. If the checks pass, confirm the new image.  Otherwise, reset the device
+//    again; the boot loader reverts to the previous image because the new one
+//    was never confirmed.
+
+// Default amount of time to wait for a device to come back after a reset.
+const IMAGE_DEPLOY_DEF_RESET_WAIT = 30 * time.Second
+
+type ImageDeployStage int
+
+const (
+	IMAGE_DEPLOY_STAGE_UPLOAD ImageDeployStage = iota
+	IMAGE_DEPLOY_STAGE_TEST
+	IMAGE_DEPLOY_STAGE_RESET
+	IMAGE_DEPLOY_STAGE_CHECK
+	IMAGE_DEPLOY_STAGE_CONFIRM
+	IMAGE_DEPLOY_STAGE_REVERT
+)
+
+var imageDeployStageNameMap = map[ImageDeployStage]string{
+	IMAGE_DEPLOY_STAGE_UPLOAD:  "upload",
+	IMAGE_DEPLOY_STAGE_TEST:    "test",
+	IMAGE_DEPLOY_STAGE_RESET:   "reset",
+	IMAGE_DEPLOY_STAGE_CHECK:   "check",
+	IMAGE_DEPLOY_STAGE_CONFIRM: "confirm",
+	IMAGE_DEPLOY_STAGE_REVERT:  "revert",
+}
+
+func (s ImageDeployStage) String() string {
+	return imageDeployStageNameMap[s]
+}
+
+// ImageDeployStatCheck is a health check that fails if a statistic exceeds a
+// maximum value.
+type ImageDeployStatCheck struct {
+	Group string
+	Field string
+	Max   uint64
+}
+
+// ImageDeployCheckFn is a custom health check.  It returns nil if the device
+// is healthy.
+type ImageDeployCheckFn func(s sesn.Sesn) error
+
+type ImageDeployStageFn func(c *ImageDeployCmd, stage ImageDeployStage)
+
+type ImageDeployCmd struct {
+	CmdBase
+	Data       []byte
+	NoErase    bool
+	ImageNum   int
+	MaxWinSz   int
+	ProgressCb ImageUploadProgressFn
+	StageCb    ImageDeployStageFn
+
+	// Maximum amount of time to wait for the device to come back after a
+	// reset.
+	ResetWait time.Duration
+
+	// Health checks.  The new image is only confirmed if all of them pass.
+	CheckEcho  bool
+	CheckStats []ImageDeployStatCheck
+	CheckTest  string
+	CheckCb    ImageDeployCheckFn
+}
+
+type ImageDeployResult struct {
+	// Hashes of the new image and the image that was running beforehand.
+	Hash     []byte
+	PrevHash []byte
+
+	UpgradeRes *ImageUpgradeResult
+	StateRes   *ImageStateWriteResult
+
+	// The reason the new image was rejected, if any.
+	CheckErr error
+
+	Confirmed bool
+	Reverted  bool
+}
+
+func NewImageDeployCmd() *ImageDeployCmd {
+	return &ImageDeployCmd{
+		CmdBase:   NewCmdBase(),
+		NoErase:   true,
+		MaxWinSz:  IMAGE_UPLOAD_DEF_MAX_WS,
+		ResetWait: IMAGE_DEPLOY_DEF_RESET_WAIT,
+	}
+}
+
+func newImageDeployResult() *ImageDeployResult {
+	return &ImageDeployResult{}
+}
+
+func (r *ImageDeployResult) Status() int {
+	if r.UpgradeRes != nil && r.UpgradeRes.Status() != 0 {
+		return r.UpgradeRes.Status()
+	} else if r.StateRes != nil {
+		return r.StateRes.Status()
+	} else {
+		return 0
+	}
+}
+
+func (c *ImageDeployCmd) stage(stage ImageDeployStage) {
+	log.Debugf("Image deploy stage: %s", stage)
+	if c.StageCb != nil {
+		c.StageCb(c, stage)
+	}
+}
+
+// runningHash returns the hash of the image that the device is running.
+func (c *ImageDeployCmd) runningHash(rsp *nmp.ImageStateRsp) []byte {
+	for _, img := range rsp.Images {
+		if img.Image == c.ImageNum && img.Active {
+			return img.Hash
+		}
+	}
+
+	return nil
+}
+
+func (c *ImageDeployCmd) readState(s sesn.Sesn,
+	opt sesn.TxOptions) (*nmp.ImageStateRsp, error) {
+
+	cmd := NewImageStateReadCmd()
+	cmd.SetTxOptions(opt)
+	res, err := cmd.Run(s)
+	if err != nil {
+		return nil, err
+	}
+	if res.Status() != 0 {
+		return nil, nmp.NewNmpRcError(res.Status())
+	}
+
+	return res.(*ImageStateReadResult).Rsp, nil
+}
+
+// reset resets the device and waits for it to come back.  It returns the
+// hash of the image that the device boots into.
+func (c *ImageDeployCmd) reset(s sesn.Sesn) ([]byte, error) {
+	cmd := NewResetWaitCmd()
+	cmd.SetTxOptions(c.TxOptions())
+	cmd.MaxWait = c.ResetWait
+	cmd.ImageNum = c.ImageNum
+
+	res, err := cmd.Run(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*ResetWaitResult).Hash, nil
+}
+
+func (c *ImageDeployCmd) checkStat(s sesn.Sesn,
+	sc ImageDeployStatCheck) error {
+
+	cmd := NewStatReadCmd()
+	cmd.SetTxOptions(c.TxOptions())
+	cmd.Name = sc.Group
+	res, err := cmd.Run(s)
+	if err != nil {
+		return err
+	}
+	if res.Status() != 0 {
+		return fmt.Errorf("failed to read stat group %s: %s", sc.Group,
+			nmp.NmpRcToString(res.Status()))
+	}
+
+	rsp := res.(*StatReadResult).Rsp
+	v, ok := rsp.Fields[sc.Field]
+	if !ok {
+		return fmt.Errorf("stat %s:%s not found", sc.Group, sc.Field)
+	}
+
+	val, ok := rsp.FieldUint64(sc.Field)
+	if !ok {
+		return fmt.Errorf("stat %s:%s has unexpected type %T", sc.Group,
+			sc.Field, v)
+	}
+
+	if val > sc.Max {
+		return fmt.Errorf("stat %s:%s is %d; maximum is %d", sc.Group,
+			sc.Field, val, sc.Max)
+	}
+
+	return nil
+}
+
+// check runs the configured health checks.
+func (c *ImageDeployCmd) check(s sesn.Sesn) error {
+	if c.CheckEcho {
+		payload := "image deploy"
+
+		cmd := NewEchoCmd()
+		cmd.SetTxOptions(c.TxOptions())
+		cmd.Payload = payload
+		res, err := cmd.Run(s)
+		if err != nil {
+			return err
+		}
+
+		rsp := res.(*EchoResult).Rsp
+		if rsp.Rc != 0 {
+			return fmt.Errorf("echo failed: %s", nmp.NmpRcToString(rsp.Rc))
+		}
+		if rsp.Payload != payload {
+			return fmt.Errorf("echo returned wrong payload: %q", rsp.Payload)
+		}
+	}
+
+	for _, sc := range c.CheckStats {
+		if err := c.checkStat(s, sc); err != nil {
+			return err
+		}
+	}
+
+	if c.CheckTest != "" {
+		cmd := NewRunTestCmd()
+		cmd.SetTxOptions(c.TxOptions())
+		cmd.Testname = c.CheckTest
+		res, err := cmd.Run(s)
+		if err != nil {
+			return err
+		}
+		if res.Status() != 0 {
+			return fmt.Errorf("test %s failed: %s", c.CheckTest,
+				nmp.NmpRcToString(res.Status()))
+		}
+	}
+
+	if c.CheckCb != nil {
+		if err := c.CheckCb(s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *ImageDeployCmd) writeState(s sesn.Sesn, hash []byte,
+	confirm bool) (*ImageStateWriteResult, error) {
+
+	cmd := NewImageStateWriteCmd()
+	cmd.SetTxOptions(c.TxOptions())
+	cmd.Hash = hash
+	cmd.Confirm = confirm
+	res, err := cmd.Run(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*ImageStateWriteResult), nil
+}
+
+// revert resets the device so that it boots the previous image.
+func (c *ImageDeployCmd) revert(s sesn.Sesn, res *ImageDeployResult) error {
+	c.stage(IMAGE_DEPLOY_STAGE_REVERT)
+
+	hash, err := c.reset(s)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(hash, res.PrevHash) {
+		return fmt.Errorf("device did not revert to image %x; running "+
+			"image is %x", res.PrevHash, hash)
+	}
+
+	res.Reverted = true
+	return nil
+}
+
+// Run deploys the image.  If the new image does not boot or fails a health
+// check, both the result and an error are returned.
+func (c *ImageDeployCmd) Run(s sesn.Sesn) (Result, error) {
+	img, err := nmimage.ParseImage(c.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %s", err.Error())
+	}
+	hash, err := img.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %s", err.Error())
+	}
+
+	res := newImageDeployResult()
+	res.Hash = hash
+
+	srsp, err := c.readState(s, c.TxOptions())
+	if err != nil {
+		return nil, err
+	}
+	res.PrevHash = c.runningHash(srsp)
+	if bytes.Equal(res.PrevHash, res.Hash) {
+		return nil, fmt.Errorf("device is already running image %x", hash)
+	}
+
+	// Upload.
+	c.stage(IMAGE_DEPLOY_STAGE_UPLOAD)
+	ucmd := NewImageUpgradeCmd()
+	ucmd.SetTxOptions(c.TxOptions())
+	ucmd.Data = c.Data
+	ucmd.NoErase = c.NoErase
+	ucmd.ImageNum = c.ImageNum
+	ucmd.MaxWinSz = c.MaxWinSz
+	ucmd.ProgressCb = func(uc *ImageUploadCmd, r *nmp.ImageUploadRsp) {
+		if c.ProgressCb != nil {
+			c.ProgressCb(uc, r)
+		}
+	}
+	ures, err := ucmd.Run(s)
+	if err != nil {
+		return nil, err
+	}
+	res.UpgradeRes = ures.(*ImageUpgradeResult)
+	if res.Status() != 0 {
+		return c.done(res)
+	}
+
+	// Mark the new image for test.
+	c.stage(IMAGE_DEPLOY_STAGE_TEST)
+	res.StateRes, err = c.writeState(s, hash, false)
+	if err != nil {
+		return nil, err
+	}
+	if res.Status() != 0 {
+		return c.done(res)
+	}
+
+	// Boot into the new image.
+	c.stage(IMAGE_DEPLOY_STAGE_RESET)
+	running, err := c.reset(s)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(running, hash) {
+		res.CheckErr = fmt.Errorf("device did not boot new image; running "+
+			"image is %x", running)
+		res.Reverted = bytes.Equal(running, res.PrevHash)
+		return res, res.CheckErr
+	}
+
+	// Verify the new image works before making it permanent.
+	c.stage(IMAGE_DEPLOY_STAGE_CHECK)
+	if err := c.check(s); err != nil {
+		res.CheckErr = fmt.Errorf("health check failed: %s", err.Error())
+		if rerr := c.revert(s, res); rerr != nil {
+			return res, fmt.Errorf("%s; revert failed: %s",
+				res.CheckErr.Error(), rerr.Error())
+		}
+		return res, res.CheckErr
+	}
+
+	c.stage(IMAGE_DEPLOY_STAGE_CONFIRM)
+	res.StateRes, err = c.writeState(s, hash, true)
+	if err != nil {
+		return nil, err
+	}
+	res.Confirmed = res.Status() == 0
+
+	return c.done(res)
 }
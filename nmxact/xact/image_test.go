@@ -0,0 +1,137 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package xact
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// errReaderAt fails every read at or beyond off.
+type errReaderAt struct {
+	r   io.ReaderAt
+	off int64
+	err error
+}
+
+func (e *errReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	if off+int64(len(b)) <= e.off {
+		return e.r.ReadAt(b, off)
+	}
+
+	n := 0
+	if off < e.off {
+		n, _ = e.r.ReadAt(b[:e.off-off], off)
+	}
+	return n, e.err
+}
+
+// eofReaderAt reports io.EOF along with a read that reaches the end of the
+// data, as io.ReaderAt permits.
+type eofReaderAt struct {
+	data []byte
+}
+
+func (e *eofReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	n := copy(b, e.data[off:])
+	if int(off)+n == len(e.data) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func TestReadChunk(t *testing.T) {
+	data := testPattern(1000)
+	errRead := errors.New("flash read failed")
+
+	tests := []struct {
+		name   string
+		src    io.ReaderAt
+		size   int
+		off    int
+		maxLen int
+		want   []byte
+		err    string
+	}{
+		{"first chunk", bytes.NewReader(data), 1000, 0, 100,
+			data[:100], ""},
+		{"middle chunk", bytes.NewReader(data), 1000, 450, 100,
+			data[450:550], ""},
+		{"short tail", bytes.NewReader(data), 1000, 950, 100,
+			data[950:], ""},
+		{"exact tail", bytes.NewReader(data), 1000, 900, 100,
+			data[900:], ""},
+		{"EOF with tail", &eofReaderAt{data}, 1000, 950, 100,
+			data[950:], ""},
+		{"size below source", bytes.NewReader(data), 500, 450, 100,
+			data[450:500], ""},
+		{"source shorter than size", bytes.NewReader(data), 1200, 950, 100,
+			nil, "offset 950: unexpected EOF"},
+		{"read error", &errReaderAt{bytes.NewReader(data), 500, errRead},
+			1000, 450, 100, nil, "offset 450: flash read failed"},
+		{"read error after chunk", &errReaderAt{bytes.NewReader(data), 500,
+			errRead}, 1000, 400, 100, data[400:500], ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunk, err := readChunk(tt.src, tt.size, tt.off, tt.maxLen)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v; want error containing %q",
+						err, tt.err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if !bytes.Equal(chunk, tt.want) {
+				t.Fatalf("got %d bytes; want %d", len(chunk), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestUploadSrc(t *testing.T) {
+	data := testPattern(100)
+
+	// Without a reader, the byte slice is used.
+	src, size := uploadSrc(nil, 5, data)
+	if size != len(data) {
+		t.Fatalf("size=%d; want %d", size, len(data))
+	}
+	if chunk, err := readChunk(src, size, 0, 200); err != nil ||
+		!bytes.Equal(chunk, data) {
+
+		t.Fatalf("slice source doesn't yield the data")
+	}
+
+	// A reader takes precedence, along with its size.
+	r := bytes.NewReader(data[:50])
+	src, size = uploadSrc(r, 50, data)
+	if src != r || size != 50 {
+		t.Fatalf("reader not used")
+	}
+}
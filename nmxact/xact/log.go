@@ -20,6 +20,10 @@
 package xact
 
 import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
 	"mynewt.apache.org/newtmgr/nmxact/nmp"
 	"mynewt.apache.org/newtmgr/nmxact/sesn"
 )
@@ -67,7 +71,14 @@ func (c *LogShowCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newLogShowResult()
 	res.Rsp = srsp
-	return res, nil
+
+	// A status code of 1 means there are more logs to read; it does not
+	// indicate an error.
+	if srsp.Rc == 1 {
+		return res, nil
+	}
+
+	return c.done(res)
 }
 
 //////////////////////////////////////////////////////////////////////////////
@@ -151,7 +162,202 @@ func (c *LogShowFullCmd) Run(s sesn.Sesn) (Result, error) {
 		idx = lastEntry.Index + 1
 	}
 
-	return res, nil
+	return c.done(res)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $tail                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+const LOG_TAIL_DFLT_INTERVAL = time.Second
+
+type LogTailProgressFn func(c *LogTailCmd, r *nmp.LogShowRsp)
+type LogTailErrorFn func(c *LogTailCmd, err error)
+
+// Repeatedly reads a log, reporting new entries as they are added.  The
+// command runs until Stop is closed or a non-transient error occurs.
+// Timeouts and disconnects are reported via ErrorCb; the session is reopened
+// if necessary and polling continues.
+//
+// If FromEnd is set, entries that are already in the log when the command
+// starts are not reported.  Otherwise, reporting begins at Index.
+type LogTailCmd struct {
+	CmdBase
+	Name       string
+	Index      uint32
+	FromEnd    bool
+	Interval   time.Duration
+	Stop       chan struct{}
+	ProgressCb LogTailProgressFn
+	ErrorCb    LogTailErrorFn
+}
+
+func NewLogTailCmd() *LogTailCmd {
+	return &LogTailCmd{
+		CmdBase:  NewCmdBase(),
+		Interval: LOG_TAIL_DFLT_INTERVAL,
+	}
+}
+
+type LogTailResult struct {
+	// The index following the last entry reported.
+	Index uint32
+
+	// The number of entries reported.
+	Count int
+
+	Rc int
+}
+
+func newLogTailResult() *LogTailResult {
+	return &LogTailResult{}
+}
+
+func (r *LogTailResult) Status() int {
+	return r.Rc
+}
+
+// Returns the index of the next entry to be written to the log.
+func (c *LogTailCmd) endIndex(s sesn.Sesn) (uint32, int, error) {
+	cmd := NewLogShowCmd()
+	cmd.SetTxOptions(c.TxOptions())
+	cmd.Name = c.Name
+	cmd.Timestamp = -1
+
+	res, err := cmd.Run(s)
+	if err != nil {
+		return 0, 0, err
+	}
+	rsp := res.(*LogShowResult).Rsp
+	if rsp.Rc != 0 && rsp.Rc != 1 {
+		return 0, rsp.Rc, nil
+	}
+
+	idx := rsp.NextIndex
+	for _, l := range rsp.Logs {
+		for _, e := range l.Entries {
+			if e.Index >= idx {
+				idx = e.Index + 1
+			}
+		}
+	}
+
+	return idx, 0, nil
+}
+
+// Reads all entries starting at the specified index.  It returns the index
+// following the last entry read.
+func (c *LogTailCmd) poll(s sesn.Sesn, res *LogTailResult,
+	idx uint32) (uint32, int, error) {
+
+	cmd := NewLogShowFullCmd()
+	cmd.SetTxOptions(c.TxOptions())
+	cmd.Name = c.Name
+	cmd.Index = idx
+	cmd.ProgressCb = func(_ *LogShowFullCmd, rsp *nmp.LogShowRsp) {
+		if rsp.Rc != 0 && rsp.Rc != 1 {
+			return
+		}
+
+		// A next index lower than the one we are waiting for means the
+		// device has restarted its numbering (e.g., it rebooted or the log
+		// was cleared); start over from the beginning.
+		if rsp.NextIndex != 0 && rsp.NextIndex < idx {
+			log.Debugf("Log tail: index reset from %d to %d",
+				idx, rsp.NextIndex)
+			idx = 0
+		}
+
+		n := 0
+		for _, l := range rsp.Logs {
+			n += len(l.Entries)
+			for _, e := range l.Entries {
+				if e.Index >= idx {
+					idx = e.Index + 1
+				}
+			}
+		}
+
+		if n > 0 {
+			res.Count += n
+			if c.ProgressCb != nil {
+				c.ProgressCb(c, rsp)
+			}
+		}
+	}
+
+	cres, err := cmd.Run(s)
+	if err != nil {
+		return idx, 0, err
+	}
+
+	// A status of 1 indicates that more entries remain; not an error.
+	rc := cres.Status()
+	if rc == 1 {
+		rc = 0
+	}
+
+	return idx, rc, nil
+}
+
+func (c *LogTailCmd) poller() *Poller {
+	return &Poller{
+		Interval: c.Interval,
+		Stop:     c.Stop,
+		ErrorCb: func(err error) {
+			if c.ErrorCb != nil {
+				c.ErrorCb(c, err)
+			}
+		},
+	}
+}
+
+func (c *LogTailCmd) Run(s sesn.Sesn) (Result, error) {
+	res := newLogTailResult()
+
+	idx := c.Index
+	if c.FromEnd {
+		found := false
+		err := c.poller().Run(s, func() (bool, error) {
+			end, rc, err := c.endIndex(s)
+			if err != nil {
+				return false, err
+			}
+			if rc != 0 {
+				res.Rc = rc
+			} else {
+				idx = end
+				found = true
+			}
+			return false, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			res.Index = idx
+			return c.done(res)
+		}
+	}
+
+	err := c.poller().Run(s, func() (bool, error) {
+		next, rc, err := c.poll(s, res, idx)
+		idx = next
+		if err != nil {
+			return false, err
+		}
+		if rc != 0 {
+			res.Rc = rc
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res.Index = idx
+	return c.done(res)
 }
 
 //////////////////////////////////////////////////////////////////////////////
@@ -191,7 +397,7 @@ func (c *LogListCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newLogListResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
 }
 
 //////////////////////////////////////////////////////////////////////////////
@@ -231,7 +437,7 @@ func (c *LogModuleListCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newLogModuleListResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
 }
 
 //////////////////////////////////////////////////////////////////////////////
@@ -271,7 +477,7 @@ func (c *LogLevelListCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newLogLevelListResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
 }
 
 //////////////////////////////////////////////////////////////////////////////
@@ -311,5 +517,5 @@ func (c *LogClearCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newLogClearResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
 }
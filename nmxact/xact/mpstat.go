@@ -20,10 +20,17 @@
 package xact
 
 import (
+	"sort"
+	"time"
+
 	"mynewt.apache.org/newtmgr/nmxact/nmp"
 	"mynewt.apache.org/newtmgr/nmxact/sesn"
 )
 
+//////////////////////////////////////////////////////////////////////////////
+// $stat                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
 type MempoolStatCmd struct {
 	CmdBase
 }
@@ -57,5 +64,244 @@ func (c *MempoolStatCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newMempoolStatResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $track                                                                   //
+//////////////////////////////////////////////////////////////////////////////
+
+const MEMPOOL_TRACK_DFLT_INTERVAL = 10 * time.Second
+
+// A single reading of a device's memory pool statistics.
+type MempoolSample struct {
+	Time   time.Time
+	Mpools map[string]map[string]int
+}
+
+type MempoolTrackProgressFn func(c *MempoolTrackCmd, sample MempoolSample)
+type MempoolTrackErrorFn func(c *MempoolTrackCmd, err error)
+
+// Periodically reads the memory pool statistics from a device.  The command
+// takes a sample every Interval until Duration has elapsed (or indefinitely
+// if Duration is 0), Stop is closed, or a non-transient error occurs.
+// Timeouts and disconnects are reported via ErrorCb; the session is reopened
+// if necessary and sampling continues.
+type MempoolTrackCmd struct {
+	CmdBase
+	Duration   time.Duration
+	Interval   time.Duration
+	Stop       chan struct{}
+	ProgressCb MempoolTrackProgressFn
+	ErrorCb    MempoolTrackErrorFn
+}
+
+func NewMempoolTrackCmd() *MempoolTrackCmd {
+	return &MempoolTrackCmd{
+		CmdBase:  NewCmdBase(),
+		Interval: MEMPOOL_TRACK_DFLT_INTERVAL,
+	}
+}
+
+type MempoolTrackResult struct {
+	Samples []MempoolSample
+	Rc      int
+}
+
+func newMempoolTrackResult() *MempoolTrackResult {
+	return &MempoolTrackResult{}
+}
+
+func (r *MempoolTrackResult) Status() int {
+	return r.Rc
+}
+
+// Fits a trend to each memory pool in the collected samples.
+func (r *MempoolTrackResult) Trends() []MempoolTrend {
+	return MempoolTrends(r.Samples)
+}
+
+// Takes a single sample.  A non-zero rc indicates the device rejected the
+// request.
+func (c *MempoolTrackCmd) sample(s sesn.Sesn) (MempoolSample, int, error) {
+	cmd := NewMempoolStatCmd()
+	cmd.SetTxOptions(c.TxOptions())
+
+	res, err := cmd.Run(s)
+	if err != nil {
+		if gerr := nmp.ToNmpGroup(err); gerr != nil {
+			return MempoolSample{}, gerr.Rc, nil
+		}
+		return MempoolSample{}, 0, err
+	}
+
+	rsp := res.(*MempoolStatResult).Rsp
+	if rsp.Rc != 0 {
+		return MempoolSample{}, rsp.Rc, nil
+	}
+
+	return MempoolSample{
+		Time:   time.Now(),
+		Mpools: rsp.Mpools,
+	}, 0, nil
+}
+
+func (c *MempoolTrackCmd) Run(s sesn.Sesn) (Result, error) {
+	res := newMempoolTrackResult()
+
+	p := &Poller{
+		Interval: c.Interval,
+		Duration: c.Duration,
+		Stop:     c.Stop,
+		ErrorCb: func(err error) {
+			if c.ErrorCb != nil {
+				c.ErrorCb(c, err)
+			}
+		},
+	}
+
+	err := p.Run(s, func() (bool, error) {
+		sample, rc, err := c.sample(s)
+		if err != nil {
+			return false, err
+		}
+		if rc != 0 {
+			res.Rc = rc
+			return false, nil
+		}
+
+		res.Samples = append(res.Samples, sample)
+		if c.ProgressCb != nil {
+			c.ProgressCb(c, sample)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.done(res)
+}
+
+// The trend of a single memory pool over a series of samples.
+type MempoolTrend struct {
+	Name      string
+	BlockSize int
+	NumBlocks int
+
+	// The number of samples the trend was fitted to and the time they span.
+	// Only samples since the device last reset are used.
+	Samples int
+	Span    time.Duration
+
+	// Free and minimum free block counts in the first and last samples.
+	FirstFree int
+	LastFree  int
+	FirstMin  int
+	LastMin   int
+
+	// Least-squares slopes, in blocks per second.
+	FreeSlope float64
+	MinSlope  float64
+
+	// Set if the fitted free and minimum free block counts both fell by at
+	// least one block over the span and the pool ended with fewer free blocks
+	// than it started with.  A leak pushes the minimum down; a pool that is
+	// merely busier at the end of the span does not.
+	Declining bool
+}
+
+// Returns the least-squares slope of ys with respect to xs.
+func mempoolSlope(xs []float64, ys []float64) float64 {
+	n := float64(len(xs))
+	if n < 2 {
+		return 0
+	}
+
+	var sx, sy, sxx, sxy float64
+	for i, _ := range xs {
+		sx += xs[i]
+		sy += ys[i]
+		sxx += xs[i] * xs[i]
+		sxy += xs[i] * ys[i]
+	}
+
+	d := n*sxx - sx*sx
+	if d == 0 {
+		return 0
+	}
+	return (n*sxy - sx*sy) / d
+}
+
+// Fits a linear trend to the free and minimum free block counts of each
+// memory pool in the specified samples.  The minimum free count only
+// decreases while the device is running, so an increase (or a change in the
+// pool's size) indicates a reset; only the samples after the last reset are
+// considered.  The returned trends are sorted by pool name.
+func MempoolTrends(samples []MempoolSample) []MempoolTrend {
+	nameMap := map[string]struct{}{}
+	for _, sample := range samples {
+		for name, _ := range sample.Mpools {
+			nameMap[name] = struct{}{}
+		}
+	}
+
+	names := make([]string, 0, len(nameMap))
+	for name, _ := range nameMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	trends := make([]MempoolTrend, 0, len(names))
+	for _, name := range names {
+		var series []MempoolSample
+		for _, sample := range samples {
+			mp, ok := sample.Mpools[name]
+			if !ok {
+				continue
+			}
+
+			if len(series) > 0 {
+				prev := series[len(series)-1].Mpools[name]
+				if mp["min"] > prev["min"] || mp["nblks"] != prev["nblks"] {
+					series = nil
+				}
+			}
+			series = append(series, sample)
+		}
+
+		first := series[0].Mpools[name]
+		last := series[len(series)-1].Mpools[name]
+
+		t := MempoolTrend{
+			Name:      name,
+			BlockSize: last["blksiz"],
+			NumBlocks: last["nblks"],
+			Samples:   len(series),
+			Span:      series[len(series)-1].Time.Sub(series[0].Time),
+			FirstFree: first["nfree"],
+			LastFree:  last["nfree"],
+			FirstMin:  first["min"],
+			LastMin:   last["min"],
+		}
+
+		xs := make([]float64, len(series))
+		frees := make([]float64, len(series))
+		mins := make([]float64, len(series))
+		for i, sample := range series {
+			xs[i] = sample.Time.Sub(series[0].Time).Seconds()
+			frees[i] = float64(sample.Mpools[name]["nfree"])
+			mins[i] = float64(sample.Mpools[name]["min"])
+		}
+		t.FreeSlope = mempoolSlope(xs, frees)
+		t.MinSlope = mempoolSlope(xs, mins)
+
+		t.Declining = t.FreeSlope*t.Span.Seconds() <= -1 &&
+			t.MinSlope*t.Span.Seconds() <= -1 &&
+			t.LastFree < t.FirstFree
+
+		trends = append(trends, t)
+	}
+
+	return trends
 }
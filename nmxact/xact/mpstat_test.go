@@ -0,0 +1,147 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package xact
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// mpSamples builds one sample per minute of a single 10-block pool with the
+// specified free and minimum free block counts.
+func mpSamples(frees []int, mins []int) []MempoolSample {
+	t0 := time.Unix(1000, 0)
+
+	samples := make([]MempoolSample, len(frees))
+	for i := range frees {
+		samples[i] = MempoolSample{
+			Time: t0.Add(time.Duration(i) * time.Minute),
+			Mpools: map[string]map[string]int{
+				"pool": {
+					"blksiz": 32,
+					"nblks":  10,
+					"nfree":  frees[i],
+					"min":    mins[i],
+				},
+			},
+		}
+	}
+
+	return samples
+}
+
+func TestMempoolTrends(t *testing.T) {
+	tests := []struct {
+		name      string
+		frees     []int
+		mins      []int
+		samples   int
+		freeSlope float64 // Blocks per minute.
+		minSlope  float64
+		declining bool
+	}{
+		{"steady", []int{8, 8, 8, 8}, []int{8, 8, 8, 8},
+			4, 0, 0, false},
+		{"single sample", []int{8}, []int{8},
+			1, 0, 0, false},
+		{"leak", []int{9, 8, 7, 6}, []int{9, 8, 7, 6},
+			4, -1, -1, true},
+
+		// Usage fluctuates within the established low-water mark; the pool
+		// is busier at the end but never reached a new minimum.
+		{"busy at end", []int{8, 9, 7, 9, 6}, []int{5, 5, 5, 5, 5},
+			5, -0.4, 0, false},
+
+		// The minimum fell, but the free count recovered.
+		{"recovered", []int{8, 5, 8, 8}, []int{8, 5, 5, 5},
+			4, 0.3, -0.9, false},
+
+		// The minimum rising indicates a reset; only the samples after it
+		// count.
+		{"reset", []int{9, 3, 9, 8, 7}, []int{9, 3, 9, 8, 7},
+			3, -1, -1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trends := MempoolTrends(mpSamples(tt.frees, tt.mins))
+			if len(trends) != 1 {
+				t.Fatalf("got %d trends; want 1", len(trends))
+			}
+			tr := trends[0]
+
+			if tr.Name != "pool" || tr.BlockSize != 32 || tr.NumBlocks != 10 {
+				t.Fatalf("unexpected pool: %+v", tr)
+			}
+			if tr.Samples != tt.samples {
+				t.Fatalf("fitted %d samples; want %d", tr.Samples,
+					tt.samples)
+			}
+			if tr.LastFree != tt.frees[len(tt.frees)-1] {
+				t.Fatalf("last free %d; want %d", tr.LastFree,
+					tt.frees[len(tt.frees)-1])
+			}
+
+			if d := tr.FreeSlope*60 - tt.freeSlope; math.Abs(d) > 0.05 {
+				t.Fatalf("free slope %.3f/min; want %.3f/min",
+					tr.FreeSlope*60, tt.freeSlope)
+			}
+			if d := tr.MinSlope*60 - tt.minSlope; math.Abs(d) > 0.05 {
+				t.Fatalf("min slope %.3f/min; want %.3f/min",
+					tr.MinSlope*60, tt.minSlope)
+			}
+			if tr.Declining != tt.declining {
+				t.Fatalf("declining=%v; want %v", tr.Declining,
+					tt.declining)
+			}
+		})
+	}
+}
+
+func TestMempoolTrendsMultiplePools(t *testing.T) {
+	samples := mpSamples([]int{9, 8, 7}, []int{9, 8, 7})
+	for i := range samples {
+		samples[i].Mpools["a"] = map[string]int{
+			"blksiz": 16, "nblks": 4, "nfree": 4, "min": 2,
+		}
+	}
+
+	// A pool missing from some samples is fitted to the others.
+	samples[2].Mpools["b"] = map[string]int{
+		"blksiz": 8, "nblks": 2, "nfree": 1, "min": 1,
+	}
+
+	trends := MempoolTrends(samples)
+	if len(trends) != 3 {
+		t.Fatalf("got %d trends; want 3", len(trends))
+	}
+	for i, name := range []string{"a", "b", "pool"} {
+		if trends[i].Name != name {
+			t.Fatalf("trend %d is for %s; want %s", i, trends[i].Name, name)
+		}
+	}
+	if trends[0].Declining || trends[1].Declining || !trends[2].Declining {
+		t.Fatalf("unexpected verdicts: %+v", trends)
+	}
+	if trends[1].Samples != 1 {
+		t.Fatalf("pool b fitted to %d samples; want 1", trends[1].Samples)
+	}
+}
@@ -20,10 +20,19 @@
 package xact
 
 import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
 	"mynewt.apache.org/newtmgr/nmxact/nmp"
 	"mynewt.apache.org/newtmgr/nmxact/sesn"
 )
 
+//////////////////////////////////////////////////////////////////////////////
+// $reset                                                                   //
+//////////////////////////////////////////////////////////////////////////////
+
 type ResetCmd struct {
 	CmdBase
 	Payload string
@@ -58,5 +67,254 @@ func (c *ResetCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newResetResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $wait                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+// Default amount of time to wait for a device to come back after a reset.
+const RESET_WAIT_DFLT_MAX_WAIT = 30 * time.Second
+
+// Default amount of time to wait for the session to drop after a reset.
+// Connectionless transports never report a drop; this also keeps the device
+// from being contacted before it has actually restarted.
+const RESET_WAIT_DFLT_MIN_WAIT = 2 * time.Second
+
+// Bounds of the delay between attempts to contact a device that is
+// resetting.  The delay doubles after each failed attempt.
+const RESET_WAIT_MIN_BACKOFF = 250 * time.Millisecond
+const RESET_WAIT_MAX_BACKOFF = 2 * time.Second
+
+type ResetWaitStage int
+
+const (
+	RESET_WAIT_STAGE_RESET ResetWaitStage = iota
+	RESET_WAIT_STAGE_DISCONNECT
+	RESET_WAIT_STAGE_RECONNECT
+	RESET_WAIT_STAGE_ANSWER
+)
+
+var resetWaitStageNameMap = map[ResetWaitStage]string{
+	RESET_WAIT_STAGE_RESET:      "reset",
+	RESET_WAIT_STAGE_DISCONNECT: "disconnect",
+	RESET_WAIT_STAGE_RECONNECT:  "reconnect",
+	RESET_WAIT_STAGE_ANSWER:     "answer",
+}
+
+func (s ResetWaitStage) String() string {
+	return resetWaitStageNameMap[s]
+}
+
+type ResetWaitStageFn func(c *ResetWaitCmd, stage ResetWaitStage)
+
+// Resets a device and waits for it to finish rebooting:
+//  1. Send a reset request.  A missing response is not an error; the device
+//     may reset before its response is delivered.
+//  2. Wait MinWait before contacting the device, noting whether the session
+//     drops in the meantime.
+//  3. Reopen the session, backing off between failed attempts.
+//  4. Send echo requests until the device answers.
+//  5. Read the image state to determine which image the device booted into.
+//
+// The command fails if the device does not answer within MaxWait of the
+// reset.
+type ResetWaitCmd struct {
+	CmdBase
+	MinWait  time.Duration
+	MaxWait  time.Duration
+	ImageNum int
+	StageCb  ResetWaitStageFn
+}
+
+func NewResetWaitCmd() *ResetWaitCmd {
+	return &ResetWaitCmd{
+		CmdBase: NewCmdBase(),
+		MinWait: RESET_WAIT_DFLT_MIN_WAIT,
+		MaxWait: RESET_WAIT_DFLT_MAX_WAIT,
+	}
+}
+
+type ResetWaitResult struct {
+	// Indicates whether the session was seen to drop after the reset.
+	Disconnected bool
+
+	// Time from the reset request until the device answered an echo
+	// request.  The resolution is limited by the backoff between attempts.
+	BootTime time.Duration
+
+	// Hash of the image the device is running; nil if the device does not
+	// support image management.
+	Hash []byte
+}
+
+func newResetWaitResult() *ResetWaitResult {
+	return &ResetWaitResult{}
+}
+
+func (r *ResetWaitResult) Status() int {
+	return 0
+}
+
+func (c *ResetWaitCmd) stage(stage ResetWaitStage) {
+	log.Debugf("Reset wait stage: %s", stage)
+	if c.StageCb != nil {
+		c.StageCb(c, stage)
+	}
+}
+
+// Returns transmit options for a single attempt that ends by the specified
+// deadline (or shortly after, if the deadline is imminent).
+func (c *ResetWaitCmd) attemptTxOptions(deadline time.Time) sesn.TxOptions {
+	opt := sesn.TxOptions{
+		Timeout: c.TxOptions().Timeout,
+		Tries:   1,
+	}
+
+	left := time.Until(deadline)
+	if left < RESET_WAIT_MIN_BACKOFF {
+		left = RESET_WAIT_MIN_BACKOFF
+	}
+	if left < opt.Timeout {
+		opt.Timeout = left
+	}
+
+	return opt
+}
+
+// Sends a single echo request.  A response with a non-zero status still
+// means the device is up.
+func (c *ResetWaitCmd) ping(s sesn.Sesn, deadline time.Time) error {
+	cmd := NewEchoCmd()
+	cmd.SetTxOptions(c.attemptTxOptions(deadline))
+	cmd.Payload = "reset wait"
+
+	_, err := cmd.Run(s)
+	if err != nil && !nmp.IsNmpGroup(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Reads the hash of the running image.  It returns a nil hash if the device
+// rejects the request.
+func (c *ResetWaitCmd) imageHash(s sesn.Sesn,
+	deadline time.Time) ([]byte, error) {
+
+	cmd := NewImageStateReadCmd()
+	cmd.SetTxOptions(c.attemptTxOptions(deadline))
+
+	res, err := cmd.Run(s)
+	if err != nil {
+		if nmp.IsNmpGroup(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if res.Status() != 0 {
+		return nil, nil
+	}
+
+	for _, img := range res.(*ImageStateReadResult).Rsp.Images {
+		if img.Image == c.ImageNum && img.Active {
+			return img.Hash, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Repeatedly calls fn, reopening the session as necessary and backing off
+// after each transient failure, until fn succeeds or the deadline passes.
+func (c *ResetWaitCmd) retry(s sesn.Sesn, deadline time.Time,
+	fn func() error) error {
+
+	backoff := RESET_WAIT_MIN_BACKOFF
+	for {
+		if !s.IsOpen() {
+			if err := s.Open(); err != nil {
+				log.Debugf("Reset wait: reconnect failed: %s", err.Error())
+			} else {
+				c.stage(RESET_WAIT_STAGE_RECONNECT)
+			}
+		}
+
+		if s.IsOpen() {
+			err := fn()
+			if err == nil {
+				return nil
+			}
+			if !isTransientErr(s, err) {
+				return err
+			}
+			log.Debugf("Reset wait: device not ready: %s", err.Error())
+		}
+
+		left := time.Until(deadline)
+		if left <= 0 {
+			return fmt.Errorf("device did not come back within %s of reset",
+				c.MaxWait)
+		}
+		if backoff > left {
+			backoff = left
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > RESET_WAIT_MAX_BACKOFF {
+			backoff = RESET_WAIT_MAX_BACKOFF
+		}
+	}
+}
+
+func (c *ResetWaitCmd) Run(s sesn.Sesn) (Result, error) {
+	res := newResetWaitResult()
+
+	start := time.Now()
+	deadline := start.Add(c.MaxWait)
+
+	c.stage(RESET_WAIT_STAGE_RESET)
+	cmd := NewResetCmd()
+	cmd.SetTxOptions(c.TxOptions())
+	if _, err := cmd.Run(s); err != nil {
+		if !isTransientErr(s, err) {
+			return nil, err
+		}
+		log.Debugf("Reset wait: no response to reset: %s", err.Error())
+	}
+
+	// Give the device a chance to go down before contacting it.  A session
+	// that drops is reopened below.
+	for {
+		if !res.Disconnected && !s.IsOpen() {
+			res.Disconnected = true
+			c.stage(RESET_WAIT_STAGE_DISCONNECT)
+		}
+		if time.Since(start) >= c.MinWait {
+			break
+		}
+		time.Sleep(RESET_WAIT_MIN_BACKOFF / 5)
+	}
+
+	err := c.retry(s, deadline, func() error {
+		return c.ping(s, deadline)
+	})
+	if err != nil {
+		return nil, err
+	}
+	res.BootTime = time.Since(start)
+	c.stage(RESET_WAIT_STAGE_ANSWER)
+
+	err = c.retry(s, deadline, func() error {
+		hash, err := c.imageHash(s, deadline)
+		res.Hash = hash
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.done(res)
 }
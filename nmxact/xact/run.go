@@ -65,7 +65,7 @@ func (c *RunTestCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newRunTestResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
 }
 
 //////////////////////////////////////////////////////////////////////////////
@@ -105,5 +105,5 @@ func (c *RunListCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newRunListResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
 }
@@ -59,5 +59,5 @@ func (c *ShellExecCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newShellExecResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
 }
@@ -0,0 +1,1201 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package xact
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"mynewt.apache.org/newtmgr/nmxact/loopback"
+	"mynewt.apache.org/newtmgr/nmxact/nmimage"
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/nmsim"
+	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
+)
+
+func TestMain(m *testing.M) {
+	// The listener log is verbose by default.
+	nmxutil.SetLogLevel(log.WarnLevel)
+	os.Exit(m.Run())
+}
+
+// simLink describes how a test session reaches the simulated device.
+type simLink struct {
+	name      string
+	proto     sesn.MgmtProto
+	coapIsTcp bool
+}
+
+// Every command is exercised over each of these links.
+var simLinks = []simLink{
+	{"nmp", sesn.MGMT_PROTO_NMP, false},
+	{"omp", sesn.MGMT_PROTO_OMP, false},
+	{"omp-tcp", sesn.MGMT_PROTO_OMP, true},
+}
+
+// newSimSesn opens a session to the device described by cfg.  The session
+// and its transport are closed when the test completes.
+func newSimSesn(t *testing.T, cfg *nmsim.XportCfg,
+	proto sesn.MgmtProto) sesn.Sesn {
+
+	t.Helper()
+
+	x := nmsim.NewSimXport(cfg)
+	if err := x.Start(); err != nil {
+		t.Fatalf("error starting simulator transport: %s", err.Error())
+	}
+	t.Cleanup(func() { x.Stop() })
+
+	sc := sesn.NewSesnCfg()
+	sc.MgmtProto = proto
+
+	s, err := x.BuildSesn(sc)
+	if err != nil {
+		t.Fatalf("error creating simulator session: %s", err.Error())
+	}
+	if err := s.Open(); err != nil {
+		t.Fatalf("error opening simulator session: %s", err.Error())
+	}
+	t.Cleanup(func() {
+		if s.IsOpen() {
+			s.Close()
+		}
+	})
+
+	return s
+}
+
+// forEachSimLink runs fn as a subtest for every simulator link.  Each
+// subtest gets its own device.
+func forEachSimLink(t *testing.T,
+	fn func(t *testing.T, d *nmsim.Device, s sesn.Sesn)) {
+
+	for _, l := range simLinks {
+		l := l
+		t.Run(l.name, func(t *testing.T) {
+			cfg := nmsim.NewXportCfg()
+			cfg.CoapIsTcp = l.coapIsTcp
+			cfg.Device = nmsim.NewDevice()
+
+			s := newSimSesn(t, cfg, l.proto)
+			fn(t, cfg.Device, s)
+		})
+	}
+}
+
+// simTxOptions keeps failing tests from waiting for the default timeout.
+func simTxOptions() sesn.TxOptions {
+	return sesn.TxOptions{
+		Timeout: 2 * time.Second,
+		Tries:   1,
+	}
+}
+
+// simStatus returns the status code that a command completed with.  Version
+// 2 devices report failures as group errors rather than in the result.
+func simStatus(res Result, err error) (int, error) {
+	if gerr := nmp.ToNmpGroup(err); gerr != nil {
+		return gerr.Rc, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return res.Status(), nil
+}
+
+// testPattern returns size bytes of easily recognizable data.
+func testPattern(size int) []byte {
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = byte(i*7 + i/251)
+	}
+	return b
+}
+
+func TestSimImageUpload(t *testing.T) {
+	tests := []struct {
+		name     string
+		bodySize int
+		maxWinSz int
+	}{
+		{"single chunk", 100, 1},
+		{"many chunks", 20000, 1},
+		{"windowed", 20000, IMAGE_UPLOAD_DEF_MAX_WS},
+	}
+
+	forEachSimLink(t, func(t *testing.T, d *nmsim.Device, s sesn.Sesn) {
+		for _, tt := range tests {
+			img := nmsim.BuildImage(nmsim.ImageVersion{Major: 2},
+				testPattern(tt.bodySize))
+
+			c := NewImageUploadCmd()
+			c.SetTxOptions(simTxOptions())
+			c.Data = img
+			c.MaxWinSz = tt.maxWinSz
+
+			res, err := c.Run(s)
+			if err != nil {
+				t.Fatalf("%s: upload failed: %s", tt.name, err.Error())
+			}
+			if res.Status() != 0 {
+				t.Fatalf("%s: upload status=%d", tt.name, res.Status())
+			}
+			if !bytes.Equal(d.Image(1), img) {
+				t.Fatalf("%s: slot 1 doesn't contain the uploaded image",
+					tt.name)
+			}
+		}
+	})
+}
+
+func TestSimImageUpgrade(t *testing.T) {
+	forEachSimLink(t, func(t *testing.T, d *nmsim.Device, s sesn.Sesn) {
+		old := nmsim.BuildImage(nmsim.ImageVersion{Major: 3}, testPattern(50))
+		if err := d.SetImage(1, old); err != nil {
+			t.Fatal(err)
+		}
+
+		img := nmsim.BuildImage(nmsim.ImageVersion{Major: 2},
+			testPattern(5000))
+
+		c := NewImageUpgradeCmd()
+		c.SetTxOptions(simTxOptions())
+		c.Data = img
+		c.MaxWinSz = IMAGE_UPLOAD_DEF_MAX_WS
+		c.ProgressCb = func(*ImageUploadCmd, *nmp.ImageUploadRsp) {}
+
+		res, err := c.Run(s)
+		if err != nil {
+			t.Fatalf("upgrade failed: %s", err.Error())
+		}
+
+		ures := res.(*ImageUpgradeResult)
+		if ures.EraseRes == nil || ures.EraseRes.Status() != 0 {
+			t.Fatalf("erase step didn't succeed")
+		}
+		if res.Status() != 0 {
+			t.Fatalf("upgrade status=%d", res.Status())
+		}
+		if !bytes.Equal(d.Image(1), img) {
+			t.Fatalf("slot 1 doesn't contain the uploaded image")
+		}
+	})
+}
+
+// A device that rejects an upload stops it at once, whether it reports the
+// status code in the response (version 1) or as a group error (version 2).
+func TestSimImageUploadRejected(t *testing.T) {
+	defer func(ver uint8) { nmp.NmpVer = ver }(nmp.NmpVer)
+
+	tests := []struct {
+		name string
+		ver  uint8
+	}{
+		{"v1", nmp.NMP_VER_1},
+		{"v2", nmp.NMP_VER_2},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			nmp.NmpVer = tt.ver
+
+			forEachSimLink(t, func(t *testing.T, d *nmsim.Device,
+				s sesn.Sesn) {
+
+				d.SetStat(nmsim.STAT_GROUP_MGMT, nmsim.STAT_MGMT_RX, 0)
+
+				// The device only accepts upgrades to a newer version.
+				c := NewImageUploadCmd()
+				c.SetTxOptions(simTxOptions())
+				c.Data = nmsim.BuildImage(nmsim.ImageVersion{Major: 1},
+					testPattern(20000))
+				c.Upgrade = true
+				c.MaxWinSz = IMAGE_UPLOAD_DEF_MAX_WS
+
+				res, err := c.Run(s)
+				if nmp.IsNmpGroup(err) != (tt.ver == nmp.NMP_VER_2) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				rc, err := simStatus(res, err)
+				if err != nil {
+					t.Fatalf("upload failed: %s", err.Error())
+				}
+				if rc != nmp.NMP_ERR_EBADSTATE {
+					t.Fatalf("upload status=%d; want %d",
+						rc, nmp.NMP_ERR_EBADSTATE)
+				}
+
+				if txs := simMgmtRxCnt(t, s) - 1; txs != 1 {
+					t.Fatalf("sent %d upload requests; want 1", txs)
+				}
+			})
+		})
+	}
+}
+
+// simPartialUpload starts uploading img and interrupts the upload partway
+// through.  It returns the last offset that the device acknowledged.
+func simPartialUpload(t *testing.T, s sesn.Sesn, img []byte) int {
+	t.Helper()
+
+	// With a single outstanding request, nothing reaches the device after
+	// the upload is aborted.
+	acked := 0
+	c := NewImageUploadCmd()
+	c.SetTxOptions(simTxOptions())
+	c.Data = img
+	c.MaxWinSz = 1
+	c.ProgressCb = func(c *ImageUploadCmd, rsp *nmp.ImageUploadRsp) {
+		acked = int(rsp.Off)
+		if acked >= len(img)/2 {
+			c.Abort()
+		}
+	}
+
+	if _, err := c.Run(s); err == nil {
+		t.Fatalf("interrupted upload succeeded")
+	}
+	if acked == 0 || acked >= len(img) {
+		t.Fatalf("device acknowledged %d/%d bytes", acked, len(img))
+	}
+
+	return acked
+}
+
+func TestSimImageResume(t *testing.T) {
+	img := nmsim.BuildImage(nmsim.ImageVersion{Major: 2}, testPattern(20000))
+	other := nmsim.BuildImage(nmsim.ImageVersion{Major: 3},
+		testPattern(20000))
+
+	tests := []struct {
+		name string
+		data []byte
+
+		// Offset to resume from, relative to the device's offset.
+		off func(acked int) int
+
+		resumed bool
+	}{
+		// The saved offset lags behind the device's.
+		{"probe behind", img, func(acked int) int { return acked / 2 }, true},
+		{"probe exact", img, func(acked int) int { return acked }, true},
+
+		// Without a saved offset, the device recognizes the image's hash.
+		{"sha", img, func(acked int) int { return 0 }, true},
+
+		// The device starts over for a different image.
+		{"other image", other, func(acked int) int { return 0 }, false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			forEachSimLink(t, func(t *testing.T, d *nmsim.Device,
+				s sesn.Sesn) {
+
+				acked := simPartialUpload(t, s, img)
+				d.SetStat(nmsim.STAT_GROUP_MGMT, nmsim.STAT_MGMT_RX, 0)
+
+				c := NewImageResumeCmd()
+				c.SetTxOptions(simTxOptions())
+				c.Data = tt.data
+				c.Off = tt.off(acked)
+
+				res, err := c.Run(s)
+				if err != nil {
+					t.Fatalf("resume failed: %s", err.Error())
+				}
+				rres := res.(*ImageResumeResult)
+				if rres.Status() != 0 || rres.Resumed != tt.resumed {
+					t.Fatalf("status=%d resumed=%v; want 0 %v",
+						rres.Status(), rres.Resumed, tt.resumed)
+				}
+				if tt.resumed && rres.Off < acked {
+					t.Fatalf("resumed at %d; device has %d", rres.Off,
+						acked)
+				}
+
+				// Each case is settled by a single request: the probe if
+				// there is a saved offset, the hash otherwise.
+				if txs := simMgmtRxCnt(t, s) - 1; txs != 1 {
+					t.Fatalf("resume sent %d requests; want 1", txs)
+				}
+
+				u := NewImageUploadCmd()
+				u.SetTxOptions(simTxOptions())
+				u.Data = tt.data
+				u.StartOff = rres.Off
+				if _, err := u.Run(s); err != nil {
+					t.Fatalf("upload failed: %s", err.Error())
+				}
+				if !bytes.Equal(d.Image(1), tt.data) {
+					t.Fatalf("slot 1 doesn't contain the uploaded image")
+				}
+			})
+		})
+	}
+}
+
+func TestSimFsUploadDownload(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+		off  int
+		len  int
+	}{
+		{"empty", 0, 0, 0},
+		{"small", 100, 0, 0},
+		{"large", 5000, 0, 0},
+		{"range", 5000, 1000, 1500},
+		{"tail", 5000, 4900, 0},
+	}
+
+	forEachSimLink(t, func(t *testing.T, d *nmsim.Device, s sesn.Sesn) {
+		for _, tt := range tests {
+			name := "/cfg/" + tt.name
+			data := testPattern(tt.size)
+
+			uc := NewFsUploadCmd()
+			uc.SetTxOptions(simTxOptions())
+			uc.Name = name
+			uc.Data = data
+
+			res, err := uc.Run(s)
+			if err != nil {
+				t.Fatalf("%s: upload failed: %s", tt.name, err.Error())
+			}
+			if res.Status() != 0 {
+				t.Fatalf("%s: upload status=%d", tt.name, res.Status())
+			}
+			if got, _ := d.ReadFile(name); !bytes.Equal(got, data) {
+				t.Fatalf("%s: device file doesn't match upload", tt.name)
+			}
+
+			var buf bytes.Buffer
+			dc := NewFsDownloadCmd()
+			dc.SetTxOptions(simTxOptions())
+			dc.Name = name
+			dc.Off = tt.off
+			dc.Len = tt.len
+			dc.Writer = &buf
+
+			res, err = dc.Run(s)
+			if err != nil {
+				t.Fatalf("%s: download failed: %s", tt.name, err.Error())
+			}
+			if res.Status() != 0 {
+				t.Fatalf("%s: download status=%d", tt.name, res.Status())
+			}
+
+			want := data[tt.off:]
+			if tt.len > 0 {
+				want = want[:tt.len]
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Fatalf("%s: downloaded %d bytes; want %d matching bytes",
+					tt.name, buf.Len(), len(want))
+			}
+			if dres := res.(*FsDownloadResult); dres.Count != len(want) {
+				t.Fatalf("%s: count=%d; want %d",
+					tt.name, dres.Count, len(want))
+			}
+		}
+	})
+}
+
+// simLogShow reads the named log starting at index idx and returns the
+// entries' messages along with their indices.
+func simLogShow(t *testing.T, s sesn.Sesn, name string,
+	idx uint32) ([]string, []uint32) {
+
+	t.Helper()
+
+	c := NewLogShowFullCmd()
+	c.SetTxOptions(simTxOptions())
+	c.Name = name
+	c.Index = idx
+
+	res, err := c.Run(s)
+	if err != nil {
+		t.Fatalf("log show failed: %s", err.Error())
+	}
+
+	var msgs []string
+	var idxs []uint32
+	for _, rsp := range res.(*LogShowFullResult).Rsps {
+		for _, l := range rsp.Logs {
+			for _, e := range l.Entries {
+				msgs = append(msgs, string(e.Msg))
+				idxs = append(idxs, e.Index)
+			}
+		}
+	}
+
+	return msgs, idxs
+}
+
+func TestSimLogShowFull(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries int
+		skip    int
+	}{
+		{"one response", 2, 0},
+		{"many responses", 60, 0},
+		{"from index", 60, 40},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			forEachSimLink(t, func(t *testing.T, d *nmsim.Device,
+				s sesn.Sesn) {
+
+				if err := d.AddLog("test", nmp.MEMORY_LOG); err != nil {
+					t.Fatal(err)
+				}
+				for i := 0; i < tt.entries; i++ {
+					msg := fmt.Sprintf("entry %d", i)
+					err := d.AppendLog("test", nmp.MODULE_DEFAULT,
+						nmp.LEVEL_INFO, nmp.LOG_ENTRY_TYPE_STRING,
+						[]byte(msg))
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				msgs, idxs := simLogShow(t, s, "test", 0)
+				if len(msgs) != tt.entries {
+					t.Fatalf("got %d entries; want %d",
+						len(msgs), tt.entries)
+				}
+
+				if tt.skip > 0 {
+					msgs, _ = simLogShow(t, s, "test", idxs[tt.skip])
+					if len(msgs) != tt.entries-tt.skip {
+						t.Fatalf("got %d entries from index %d; want %d",
+							len(msgs), idxs[tt.skip], tt.entries-tt.skip)
+					}
+				}
+
+				for i, msg := range msgs {
+					want := fmt.Sprintf("entry %d", i+tt.skip)
+					if msg != want {
+						t.Fatalf("entry %d: got %q; want %q", i, msg, want)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestSimStatRead(t *testing.T) {
+	forEachSimLink(t, func(t *testing.T, d *nmsim.Device, s sesn.Sesn) {
+		err := d.AddStatGroup("ble_phy", "tx_good", "rx_crc_err")
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.SetStat("ble_phy", "tx_good", 1234)
+		d.SetStat("ble_phy", "rx_crc_err", 5)
+
+		tests := []struct {
+			group string
+			rc    int
+			vals  map[string]uint64
+		}{
+			{"ble_phy", 0, map[string]uint64{
+				"tx_good":    1234,
+				"rx_crc_err": 5,
+			}},
+			{"bogus", nmp.NMP_ERR_ENOENT, nil},
+		}
+
+		for _, tt := range tests {
+			c := NewStatReadCmd()
+			c.SetTxOptions(simTxOptions())
+			c.Name = tt.group
+
+			res, err := c.Run(s)
+			rc, err := simStatus(res, err)
+			if err != nil {
+				t.Fatalf("%s: stat read failed: %s", tt.group, err.Error())
+			}
+			if rc != tt.rc {
+				t.Fatalf("%s: status=%d; want %d", tt.group, rc, tt.rc)
+			}
+			if rc != 0 {
+				continue
+			}
+
+			rsp := res.(*StatReadResult).Rsp
+			for k, v := range tt.vals {
+				if got := rsp.Fields[k]; got != v {
+					t.Fatalf("%s: %s=%d; want %d", tt.group, k, got, v)
+				}
+			}
+		}
+	})
+}
+
+func TestSimConfig(t *testing.T) {
+	forEachSimLink(t, func(t *testing.T, d *nmsim.Device, s sesn.Sesn) {
+		d.SetConfig("id/serial", "0001", false)
+
+		tests := []struct {
+			name  string
+			write string
+			save  bool
+			rc    int
+		}{
+			{"id/serial", "", false, 0},
+			{"id/serial", "1234", false, 0},
+			{"id/serial", "5678", true, 0},
+			{"bogus/val", "1", false, nmp.NMP_ERR_EINVAL},
+		}
+
+		for _, tt := range tests {
+			want, _ := d.Config(tt.name)
+
+			if tt.write != "" {
+				wc := NewConfigWriteCmd()
+				wc.SetTxOptions(simTxOptions())
+				wc.Name = tt.name
+				wc.Val = tt.write
+				wc.Save = tt.save
+
+				rc, err := simStatus(wc.Run(s))
+				if err != nil {
+					t.Fatalf("%s: write failed: %s", tt.name, err.Error())
+				}
+				if rc != tt.rc {
+					t.Fatalf("%s: write status=%d; want %d",
+						tt.name, rc, tt.rc)
+				}
+				if rc != 0 {
+					continue
+				}
+				want = tt.write
+			}
+
+			rc := NewConfigReadCmd()
+			rc.SetTxOptions(simTxOptions())
+			rc.Name = tt.name
+
+			res, err := rc.Run(s)
+			if err != nil {
+				t.Fatalf("%s: read failed: %s", tt.name, err.Error())
+			}
+			if res.Status() != 0 {
+				t.Fatalf("%s: read status=%d", tt.name, res.Status())
+			}
+			if got := res.(*ConfigReadResult).Rsp.Val; got != want {
+				t.Fatalf("%s: read %q; want %q", tt.name, got, want)
+			}
+		}
+
+		// Only the saved value survives a reboot.
+		d.Reboot()
+		if val, _ := d.Config("id/serial"); val != "5678" {
+			t.Fatalf("saved value lost after reboot: %q", val)
+		}
+	})
+}
+
+func TestSimShellExec(t *testing.T) {
+	forEachSimLink(t, func(t *testing.T, d *nmsim.Device, s sesn.Sesn) {
+		d.AddShellCmd("fail", func(argv []string) (string, int) {
+			return "failed\n", 3
+		})
+
+		tests := []struct {
+			argv []string
+			out  string
+			rc   int
+		}{
+			{[]string{"echo", "hello", "world"}, "hello world\n", 0},
+			{[]string{"fail"}, "failed\n", 3},
+			{[]string{"bogus"}, "Unrecognized command: bogus\n",
+				nmp.NMP_ERR_ENOENT},
+		}
+
+		for _, tt := range tests {
+			c := NewShellExecCmd()
+			c.SetTxOptions(simTxOptions())
+			c.Argv = tt.argv
+
+			res, err := c.Run(s)
+			if err != nil {
+				t.Fatalf("%v: exec failed: %s", tt.argv, err.Error())
+			}
+
+			rsp := res.(*ShellExecResult).Rsp
+			if rsp.O != tt.out || rsp.Rc != tt.rc {
+				t.Fatalf("%v: got o=%q rc=%d; want o=%q rc=%d",
+					tt.argv, rsp.O, rsp.Rc, tt.out, tt.rc)
+			}
+		}
+	})
+}
+
+func TestSimRcErr(t *testing.T) {
+	forEachSimLink(t, func(t *testing.T, d *nmsim.Device, s sesn.Sesn) {
+		for _, rcErr := range []bool{false, true} {
+			c := NewShellExecCmd()
+			c.SetTxOptions(simTxOptions())
+			c.Argv = []string{"bogus"}
+
+			// Reporting status codes as errors is an optional interface.
+			var cmd Cmd = c
+			rc, ok := cmd.(RcErrCmd)
+			if !ok {
+				t.Fatalf("%T doesn't implement RcErrCmd", cmd)
+			}
+			rc.SetRcErr(rcErr)
+
+			res, err := cmd.Run(s)
+			if res == nil || res.Status() != nmp.NMP_ERR_ENOENT {
+				t.Fatalf("rcErr=%v: unexpected result: %v", rcErr, res)
+			}
+
+			if !rcErr {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+			} else if rerr := nmp.ToNmpRc(err); rerr == nil ||
+				rerr.Rc != nmp.NMP_ERR_ENOENT {
+
+				t.Fatalf("got error %v; want ENOENT", err)
+			}
+		}
+	})
+}
+
+// simMgmtRxCnt returns the number of requests the device has received,
+// including the stat read issued here.
+func simMgmtRxCnt(t *testing.T, s sesn.Sesn) uint64 {
+	t.Helper()
+
+	c := NewStatReadCmd()
+	c.SetTxOptions(simTxOptions())
+	c.Name = nmsim.STAT_GROUP_MGMT
+
+	res, err := c.Run(s)
+	if err != nil {
+		t.Fatalf("stat read failed: %s", err.Error())
+	}
+
+	v, ok := res.(*StatReadResult).Rsp.Fields[nmsim.STAT_MGMT_RX].(uint64)
+	if !ok {
+		t.Fatalf("stat read response lacks %s", nmsim.STAT_MGMT_RX)
+	}
+	return v
+}
+
+func TestSimNmpVer(t *testing.T) {
+	defer func(ver uint8) { nmp.NmpVer = ver }(nmp.NmpVer)
+
+	tests := []struct {
+		name   string
+		reqVer uint8
+		devVer uint8
+
+		// Number of times the device receives a rejected write.
+		rejectTxs uint64
+
+		// Protocol version of responses once the peer version is known.
+		rspVer uint8
+	}{
+		{"v1 to v2 device", nmp.NMP_VER_1, nmp.NMP_VER_2, 1, nmp.NMP_VER_1},
+		{"v1 to v1 device", nmp.NMP_VER_1, nmp.NMP_VER_1, 1, nmp.NMP_VER_1},
+		{"v2 to v2 device", nmp.NMP_VER_2, nmp.NMP_VER_2, 1, nmp.NMP_VER_2},
+
+		// A version 1 header in the response to a failed version 2 request
+		// is the only reason to resend it.
+		{"v2 to v1 device", nmp.NMP_VER_2, nmp.NMP_VER_1, 2, nmp.NMP_VER_1},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			nmp.NmpVer = tt.reqVer
+
+			forEachSimLink(t, func(t *testing.T, d *nmsim.Device,
+				s sesn.Sesn) {
+
+				d.SetNmpVer(tt.devVer)
+
+				// The rejected write is the first request, so the client
+				// doesn't know the device's version yet.
+				d.SetStat(nmsim.STAT_GROUP_MGMT, nmsim.STAT_MGMT_RX, 0)
+
+				c := NewConfigWriteCmd()
+				c.SetTxOptions(simTxOptions())
+				c.Name = "bogus"
+				c.Val = "1"
+
+				rc, err := simStatus(c.Run(s))
+				if err != nil {
+					t.Fatalf("config write failed: %s", err.Error())
+				}
+				if rc != nmp.NMP_ERR_EINVAL {
+					t.Fatalf("config write status=%d; want %d",
+						rc, nmp.NMP_ERR_EINVAL)
+				}
+
+				if txs := simMgmtRxCnt(t, s) - 1; txs != tt.rejectTxs {
+					t.Fatalf("rejected write sent %d times; want %d",
+						txs, tt.rejectTxs)
+				}
+
+				e := NewEchoCmd()
+				e.SetTxOptions(simTxOptions())
+				e.Payload = "ver"
+
+				res, err := e.Run(s)
+				if err != nil {
+					t.Fatalf("echo failed: %s", err.Error())
+				}
+				rsp := res.(*EchoResult).Rsp
+				if rsp.Hdr().Version != tt.rspVer {
+					t.Fatalf("response version %d; want %d",
+						rsp.Hdr().Version, tt.rspVer)
+				}
+			})
+		})
+	}
+}
+
+func TestSimUploadReader(t *testing.T) {
+	forEachSimLink(t, func(t *testing.T, d *nmsim.Device, s sesn.Sesn) {
+		img := nmsim.BuildImage(nmsim.ImageVersion{Major: 2},
+			testPattern(10000))
+
+		ic := NewImageUploadCmd()
+		ic.SetTxOptions(simTxOptions())
+		ic.Reader = bytes.NewReader(img)
+		ic.Size = len(img)
+		ic.MaxWinSz = IMAGE_UPLOAD_DEF_MAX_WS
+
+		if _, err := ic.Run(s); err != nil {
+			t.Fatalf("image upload failed: %s", err.Error())
+		}
+		if !bytes.Equal(d.Image(1), img) {
+			t.Fatalf("slot 1 doesn't contain the uploaded image")
+		}
+
+		data := testPattern(3000)
+		fc := NewFsUploadCmd()
+		fc.SetTxOptions(simTxOptions())
+		fc.Name = "/cfg/reader"
+		fc.Reader = bytes.NewReader(data)
+		fc.Size = len(data)
+
+		if _, err := fc.Run(s); err != nil {
+			t.Fatalf("file upload failed: %s", err.Error())
+		}
+		if got, _ := d.ReadFile(fc.Name); !bytes.Equal(got, data) {
+			t.Fatalf("device file doesn't match upload")
+		}
+
+		// A failing reader aborts the upload.
+		fc = NewFsUploadCmd()
+		fc.SetTxOptions(simTxOptions())
+		fc.Name = "/cfg/short"
+		fc.Reader = bytes.NewReader(data)
+		fc.Size = len(data) + 1
+
+		if _, err := fc.Run(s); err == nil {
+			t.Fatalf("upload from a short reader succeeded")
+		}
+	})
+}
+
+func TestSimFsLs(t *testing.T) {
+	forEachSimLink(t, func(t *testing.T, d *nmsim.Device, s sesn.Sesn) {
+		// Enough entries to need several pages.
+		n := nmsim.FS_LS_MAX_ENTRIES*2 + 3
+		for i := 0; i < n; i++ {
+			d.WriteFile(fmt.Sprintf("/data/f%03d", i), testPattern(i))
+		}
+		d.WriteFile("/data/sub/x", nil)
+
+		c := NewFsLsCmd()
+		c.SetTxOptions(simTxOptions())
+		c.Name = "/data"
+
+		res, err := c.Run(s)
+		rc, err := simStatus(res, err)
+		if err != nil || rc != 0 {
+			t.Fatalf("ls failed: rc=%d err=%v", rc, err)
+		}
+
+		entries := res.(*FsLsResult).Entries
+		if len(entries) != n+1 {
+			t.Fatalf("got %d entries; want %d", len(entries), n+1)
+		}
+		for i := 0; i < n; i++ {
+			e := entries[i]
+			if e.Name != fmt.Sprintf("f%03d", i) || int(e.Len) != i {
+				t.Fatalf("unexpected entry %d: %+v", i, e)
+			}
+		}
+		if e := entries[n]; e.Name != "sub" ||
+			e.Type != nmp.FS_ENTRY_TYPE_DIR {
+
+			t.Fatalf("unexpected entry %d: %+v", n, e)
+		}
+	})
+}
+
+func TestSimMempoolTrack(t *testing.T) {
+	forEachSimLink(t, func(t *testing.T, d *nmsim.Device, s sesn.Sesn) {
+		d.AddMempool(nmsim.Mempool{Name: "leaky", BlockSize: 32,
+			NumBlocks: 10, NumFree: 10, MinFree: 10})
+		d.AddMempool(nmsim.Mempool{Name: "steady", BlockSize: 64,
+			NumBlocks: 4, NumFree: 4, MinFree: 4})
+
+		c := NewMempoolTrackCmd()
+		c.SetTxOptions(simTxOptions())
+		c.Interval = 10 * time.Millisecond
+		c.Duration = 40 * time.Millisecond
+
+		// Leak a block after every sample.
+		free := 10
+		c.ProgressCb = func(c *MempoolTrackCmd, sample MempoolSample) {
+			free--
+			d.SetMempoolFree("leaky", free)
+		}
+
+		res, err := c.Run(s)
+		rc, err := simStatus(res, err)
+		if err != nil || rc != 0 {
+			t.Fatalf("track failed: rc=%d err=%v", rc, err)
+		}
+
+		tres := res.(*MempoolTrackResult)
+		if n := len(tres.Samples); n < 3 {
+			t.Fatalf("collected %d samples; want at least 3", n)
+		}
+
+		declining := map[string]bool{}
+		for _, tr := range tres.Trends() {
+			declining[tr.Name] = tr.Declining
+		}
+		if !declining["leaky"] || declining["steady"] {
+			t.Fatalf("unexpected verdicts: %v", declining)
+		}
+	})
+}
+
+func TestSimImageDeploy(t *testing.T) {
+	img := nmsim.BuildImage(nmsim.ImageVersion{Major: 2}, testPattern(5000))
+
+	tests := []struct {
+		name     string
+		running  bool
+		checkErr error
+
+		stages    []ImageDeployStage
+		confirmed bool
+		reverted  bool
+	}{
+		{
+			name: "confirm",
+			stages: []ImageDeployStage{
+				IMAGE_DEPLOY_STAGE_UPLOAD,
+				IMAGE_DEPLOY_STAGE_TEST,
+				IMAGE_DEPLOY_STAGE_RESET,
+				IMAGE_DEPLOY_STAGE_CHECK,
+				IMAGE_DEPLOY_STAGE_CONFIRM,
+			},
+			confirmed: true,
+		},
+		{
+			name:     "failed check",
+			checkErr: fmt.Errorf("unhealthy"),
+			stages: []ImageDeployStage{
+				IMAGE_DEPLOY_STAGE_UPLOAD,
+				IMAGE_DEPLOY_STAGE_TEST,
+				IMAGE_DEPLOY_STAGE_RESET,
+				IMAGE_DEPLOY_STAGE_CHECK,
+				IMAGE_DEPLOY_STAGE_REVERT,
+			},
+			reverted: true,
+		},
+		{
+			name:    "already running",
+			running: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Each reset takes a couple of seconds.
+			t.Parallel()
+
+			cfg := nmsim.NewXportCfg()
+			cfg.Device = nmsim.NewDevice()
+			d := cfg.Device
+			s := newSimSesn(t, cfg, sesn.MGMT_PROTO_NMP)
+
+			if tt.running {
+				if err := d.SetImage(0, img); err != nil {
+					t.Fatal(err)
+				}
+			}
+			prev := d.Image(0)
+
+			var stages []ImageDeployStage
+			c := NewImageDeployCmd()
+			c.SetTxOptions(simTxOptions())
+			c.Data = img
+			c.CheckEcho = true
+			c.CheckCb = func(s sesn.Sesn) error { return tt.checkErr }
+			c.StageCb = func(c *ImageDeployCmd, stage ImageDeployStage) {
+				stages = append(stages, stage)
+			}
+
+			res, err := c.Run(s)
+			if tt.running {
+				if err == nil || res != nil {
+					t.Fatalf("deploy of running image: res=%v err=%v",
+						res, err)
+				}
+				if len(stages) != 0 || d.Image(1) != nil {
+					t.Fatalf("deploy of running image touched the device")
+				}
+				return
+			}
+
+			if (err != nil) != (tt.checkErr != nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fmt.Sprint(stages) != fmt.Sprint(tt.stages) {
+				t.Fatalf("stages %v; want %v", stages, tt.stages)
+			}
+
+			dres := res.(*ImageDeployResult)
+			if dres.Confirmed != tt.confirmed ||
+				dres.Reverted != tt.reverted {
+
+				t.Fatalf("confirmed=%v reverted=%v; want %v %v",
+					dres.Confirmed, dres.Reverted, tt.confirmed,
+					tt.reverted)
+			}
+
+			want := prev
+			if tt.confirmed {
+				want = img
+			}
+			if !bytes.Equal(d.Image(0), want) {
+				t.Fatalf("device is running the wrong image")
+			}
+
+			// The running image is confirmed either way, so the next
+			// reset keeps it.
+			sc := NewImageStateReadCmd()
+			sc.SetTxOptions(simTxOptions())
+			sres, err := sc.Run(s)
+			if err != nil {
+				t.Fatalf("image state read failed: %s", err.Error())
+			}
+			for _, e := range sres.(*ImageStateReadResult).Rsp.Images {
+				if e.Slot == 0 && !e.Confirmed {
+					t.Fatalf("running image isn't confirmed")
+				}
+			}
+		})
+	}
+}
+
+func TestSimDateTimeSync(t *testing.T) {
+	const latency = 20 * time.Millisecond
+
+	// The estimates are good to well within the one-way latency that they
+	// compensate for.
+	const tolerance = latency / 2
+
+	within := func(d time.Duration) bool {
+		return d > -tolerance && d < tolerance
+	}
+
+	for _, dryRun := range []bool{false, true} {
+		cfg := nmsim.NewXportCfg()
+		cfg.Device = nmsim.NewDevice()
+		cfg.Tx = loopback.LinkCfg{Latency: latency}
+		cfg.Rx = loopback.LinkCfg{Latency: latency}
+		d := cfg.Device
+		s := newSimSesn(t, cfg, sesn.MGMT_PROTO_NMP)
+
+		c := NewDateTimeSyncCmd()
+		c.SetTxOptions(simTxOptions())
+		c.Rounds = 3
+		c.DryRun = dryRun
+
+		// The device's clock starts out far behind the host's.
+		offset := d.Clock().Sub(time.Now())
+
+		res, err := c.Run(s)
+		if err != nil || res.Status() != 0 {
+			t.Fatalf("dry=%v: sync failed: res=%v err=%v", dryRun,
+				res, err)
+		}
+		sres := res.(*DateTimeSyncResult)
+
+		if len(sres.Samples) != c.Rounds {
+			t.Fatalf("dry=%v: %d samples; want %d", dryRun,
+				len(sres.Samples), c.Rounds)
+		}
+		if sres.MinRtt < 2*latency || sres.MedianRtt < sres.MinRtt {
+			t.Fatalf("dry=%v: implausible round trips: min=%s median=%s",
+				dryRun, sres.MinRtt, sres.MedianRtt)
+		}
+		if !within(sres.Offset - offset) {
+			t.Fatalf("dry=%v: estimated offset %s; actual %s", dryRun,
+				sres.Offset, offset)
+		}
+
+		if dryRun {
+			if sres.DateTime != "" || sres.Verify != nil {
+				t.Fatalf("dry run wrote the clock")
+			}
+			if !within(d.Clock().Sub(time.Now()) - offset) {
+				t.Fatalf("dry run changed the device's clock")
+			}
+			continue
+		}
+
+		// The written value accounts for the time it takes to reach the
+		// device, so the device's clock now matches the host's.
+		if _, err := ParseDateTime(sres.DateTime); err != nil {
+			t.Fatalf("wrote invalid time %q: %s", sres.DateTime,
+				err.Error())
+		}
+		if diff := d.Clock().Sub(time.Now()); !within(diff) {
+			t.Fatalf("device clock is off by %s after sync", diff)
+		}
+		if sres.Verify == nil || !within(sres.Verify.Offset()) {
+			t.Fatalf("residual offset not measured: %+v", sres.Verify)
+		}
+	}
+}
+
+func TestSimResetWait(t *testing.T) {
+	img := nmsim.BuildImage(nmsim.ImageVersion{Major: 2}, testPattern(500))
+	parsed, err := nmimage.ParseImage(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := parsed.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		bootDelay time.Duration
+		minWait   time.Duration
+		maxWait   time.Duration
+
+		// Whether the device comes back in time.
+		ok bool
+	}{
+		{"slow boot", 500 * time.Millisecond, 0, 5 * time.Second, true},
+		{"min wait", 0, 300 * time.Millisecond, 5 * time.Second, true},
+		{"timeout", time.Hour, 0, 300 * time.Millisecond, false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := nmsim.NewXportCfg()
+			cfg.Device = nmsim.NewDevice()
+			d := cfg.Device
+			s := newSimSesn(t, cfg, sesn.MGMT_PROTO_NMP)
+
+			// The device swaps in a new image as it boots.
+			if err := d.SetImage(1, img); err != nil {
+				t.Fatal(err)
+			}
+			wc := NewImageStateWriteCmd()
+			wc.SetTxOptions(simTxOptions())
+			wc.Hash = hash
+			if rc, err := simStatus(wc.Run(s)); err != nil || rc != 0 {
+				t.Fatalf("image test failed: rc=%d err=%v", rc, err)
+			}
+			d.SetBootDelay(tt.bootDelay)
+
+			c := NewResetWaitCmd()
+			c.SetTxOptions(sesn.TxOptions{
+				Timeout: 100 * time.Millisecond,
+				Tries:   1,
+			})
+			c.MinWait = tt.minWait
+			c.MaxWait = tt.maxWait
+
+			start := time.Now()
+			res, err := c.Run(s)
+			elapsed := time.Since(start)
+
+			if d.BootCount() != 2 {
+				t.Fatalf("device booted %d times; want 2", d.BootCount())
+			}
+
+			if !tt.ok {
+				if err == nil {
+					t.Fatalf("reset wait succeeded; want timeout")
+				}
+				if elapsed > tt.maxWait+time.Second {
+					t.Fatalf("gave up after %s; max wait is %s", elapsed,
+						tt.maxWait)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("reset wait failed: %s", err.Error())
+			}
+
+			rres := res.(*ResetWaitResult)
+			if rres.BootTime < tt.bootDelay || rres.BootTime < tt.minWait ||
+				rres.BootTime > elapsed {
+
+				t.Fatalf("boot time %s; device took %s, min wait %s, "+
+					"command took %s", rres.BootTime, tt.bootDelay,
+					tt.minWait, elapsed)
+			}
+			if !bytes.Equal(rres.Hash, hash) {
+				t.Fatalf("running image hash %x; want %x", rres.Hash, hash)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package xact
+
+import (
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// $read                                                                    //
+//////////////////////////////////////////////////////////////////////////////
+
+type SplitReadCmd struct {
+	CmdBase
+}
+
+type SplitReadResult struct {
+	Rsp *nmp.SplitReadRsp
+}
+
+func NewSplitReadCmd() *SplitReadCmd {
+	return &SplitReadCmd{
+		CmdBase: NewCmdBase(),
+	}
+}
+
+func newSplitReadResult() *SplitReadResult {
+	return &SplitReadResult{}
+}
+
+func (r *SplitReadResult) Status() int {
+	return r.Rsp.Rc
+}
+
+func (c *SplitReadCmd) Run(s sesn.Sesn) (Result, error) {
+	r := nmp.NewSplitReadReq()
+
+	rsp, err := txReq(s, r.Msg(), &c.CmdBase)
+	if err != nil {
+		return nil, err
+	}
+	srsp := rsp.(*nmp.SplitReadRsp)
+
+	res := newSplitReadResult()
+	res.Rsp = srsp
+	return c.done(res)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $write                                                                   //
+//////////////////////////////////////////////////////////////////////////////
+
+type SplitWriteCmd struct {
+	CmdBase
+	Mode nmp.SplitMode
+}
+
+type SplitWriteResult struct {
+	Rsp *nmp.SplitWriteRsp
+}
+
+func NewSplitWriteCmd() *SplitWriteCmd {
+	return &SplitWriteCmd{
+		CmdBase: NewCmdBase(),
+	}
+}
+
+func newSplitWriteResult() *SplitWriteResult {
+	return &SplitWriteResult{}
+}
+
+func (r *SplitWriteResult) Status() int {
+	return r.Rsp.Rc
+}
+
+func (c *SplitWriteCmd) Run(s sesn.Sesn) (Result, error) {
+	r := nmp.NewSplitWriteReq()
+	r.Mode = c.Mode
+
+	rsp, err := txReq(s, r.Msg(), &c.CmdBase)
+	if err != nil {
+		return nil, err
+	}
+	srsp := rsp.(*nmp.SplitWriteRsp)
+
+	res := newSplitWriteResult()
+	res.Rsp = srsp
+	return c.done(res)
+}
@@ -63,7 +63,7 @@ func (c *StatReadCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newStatReadResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
 }
 
 //////////////////////////////////////////////////////////////////////////////
@@ -103,5 +103,5 @@ func (c *StatListCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newStatListResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
 }
@@ -57,5 +57,5 @@ func (c *TaskStatCmd) Run(s sesn.Sesn) (Result, error) {
 
 	res := newTaskStatResult()
 	res.Rsp = srsp
-	return res, nil
+	return c.done(res)
 }
@@ -20,8 +20,11 @@
 package xact
 
 import (
+	"time"
+
 	log "github.com/sirupsen/logrus"
 	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
 	"mynewt.apache.org/newtmgr/nmxact/sesn"
 )
 
@@ -69,3 +72,91 @@ func txReqAsync(s sesn.Sesn, m *nmp.NmpMsg, c *CmdBase, ch chan nmp.NmpRsp, errc
 		return nil
 	}
 }
+
+// Indicates whether the specified error is likely to go away on its own,
+// possibly after the session is reopened.  Commands that poll a device over
+// a long period use this to ride out timeouts and disconnects.
+func isTransientErr(s sesn.Sesn, err error) bool {
+	return nmxutil.IsRspTimeout(err) ||
+		nmxutil.IsSesnClosed(err) ||
+		nmxutil.IsBleSesnDisconnect(err) ||
+		nmxutil.IsXport(err) ||
+		!s.IsOpen()
+}
+
+// Poller repeatedly calls a function on behalf of a command that polls a
+// device over a long period.  Transient errors are reported via ErrorCb
+// rather than ending the polling, and a session that has closed is reopened
+// before the next call.
+type Poller struct {
+	// The time between the starts of successive calls.  A call that
+	// overruns its slot delays the next one; missed calls are not made up.
+	Interval time.Duration
+
+	// The maximum number of calls (0 for no limit).
+	Count int
+
+	// No call starts later than this after the first (0 for no limit).
+	Duration time.Duration
+
+	// Polling stops when this channel is closed.
+	Stop chan struct{}
+
+	ErrorCb func(err error)
+}
+
+// Makes a single call.  It returns false if polling should stop, along with
+// any non-transient error.
+func (p *Poller) call(s sesn.Sesn, fn func() (bool, error)) (bool, error) {
+	var err error
+	if !s.IsOpen() {
+		err = s.Open()
+	}
+
+	more := true
+	if err == nil {
+		more, err = fn()
+	}
+	if err == nil {
+		return more, nil
+	}
+
+	if !isTransientErr(s, err) {
+		return false, err
+	}
+	if p.ErrorCb != nil {
+		p.ErrorCb(err)
+	}
+	return true, nil
+}
+
+// Calls fn until it returns false or a non-transient error, Stop is closed,
+// or the Count or Duration limit is reached.  The first call is made
+// immediately.  The error that ended polling, if any, is returned.
+func (p *Poller) Run(s sesn.Sesn, fn func() (bool, error)) error {
+	start := time.Now()
+	next := start
+	for n := 1; ; n++ {
+		more, err := p.call(s, fn)
+		if err != nil {
+			return err
+		}
+		if !more || (p.Count != 0 && n >= p.Count) {
+			return nil
+		}
+
+		next = next.Add(p.Interval)
+		if now := time.Now(); next.Before(now) {
+			next = now
+		}
+		if p.Duration != 0 && next.Sub(start) > p.Duration {
+			return nil
+		}
+
+		select {
+		case <-p.Stop:
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+	}
+}
@@ -0,0 +1,198 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package xact
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
+)
+
+// pollSesn is a session whose open state is controlled by the test.  Only
+// the methods used by Poller are implemented.
+type pollSesn struct {
+	sesn.Sesn
+	open    bool
+	opens   int
+	openErr error
+}
+
+func (s *pollSesn) IsOpen() bool {
+	return s.open
+}
+
+func (s *pollSesn) Open() error {
+	s.opens++
+	if s.openErr != nil {
+		return s.openErr
+	}
+	s.open = true
+	return nil
+}
+
+func TestPoller(t *testing.T) {
+	timeout := nmxutil.NewRspTimeoutError("timeout")
+	fatal := fmt.Errorf("fatal")
+
+	tests := []struct {
+		name  string
+		count int
+
+		// Returns the outcome of each call.
+		fn func(s *pollSesn, n int) (bool, error)
+
+		calls int
+		errs  int
+		opens int
+		err   error
+	}{
+		{"count", 3, func(s *pollSesn, n int) (bool, error) {
+			return true, nil
+		}, 3, 0, 0, nil},
+		{"done", 0, func(s *pollSesn, n int) (bool, error) {
+			return n < 2, nil
+		}, 2, 0, 0, nil},
+		{"transient", 4, func(s *pollSesn, n int) (bool, error) {
+			if n%2 == 1 {
+				return false, timeout
+			}
+			return true, nil
+		}, 4, 2, 0, nil},
+		{"fatal", 0, func(s *pollSesn, n int) (bool, error) {
+			if n == 2 {
+				return false, fatal
+			}
+			return true, nil
+		}, 2, 0, 0, fatal},
+		{"reopen", 3, func(s *pollSesn, n int) (bool, error) {
+			if n == 1 {
+				s.open = false
+				return false, nmxutil.NewSesnClosedError("closed")
+			}
+			return true, nil
+		}, 3, 1, 1, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &pollSesn{open: true}
+			errs := 0
+			p := &Poller{
+				Interval: time.Millisecond,
+				Count:    tt.count,
+				ErrorCb:  func(err error) { errs++ },
+			}
+
+			calls := 0
+			err := p.Run(s, func() (bool, error) {
+				calls++
+				return tt.fn(s, calls)
+			})
+			if err != tt.err {
+				t.Fatalf("Run returned %v; want %v", err, tt.err)
+			}
+			if calls != tt.calls || errs != tt.errs || s.opens != tt.opens {
+				t.Fatalf("calls=%d errors=%d opens=%d; want %d %d %d",
+					calls, errs, s.opens, tt.calls, tt.errs, tt.opens)
+			}
+		})
+	}
+}
+
+func TestPollerOpenFailure(t *testing.T) {
+	// A session that can't be reopened is reported but doesn't end polling,
+	// and the function isn't called until the session is open.
+	s := &pollSesn{openErr: fmt.Errorf("no device")}
+
+	errs := 0
+	p := &Poller{
+		Interval: time.Millisecond,
+		Count:    3,
+		ErrorCb:  func(err error) { errs++ },
+	}
+
+	calls := 0
+	err := p.Run(s, func() (bool, error) {
+		calls++
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %s", err.Error())
+	}
+	if calls != 0 || errs != 3 || s.opens != 3 {
+		t.Fatalf("calls=%d errors=%d opens=%d; want 0 3 3", calls, errs,
+			s.opens)
+	}
+}
+
+func TestPollerStop(t *testing.T) {
+	s := &pollSesn{open: true}
+	p := &Poller{
+		Interval: time.Hour,
+		Stop:     make(chan struct{}),
+	}
+
+	calls := 0
+	done := make(chan error)
+	go func() {
+		done <- p.Run(s, func() (bool, error) {
+			calls++
+			return true, nil
+		})
+	}()
+
+	close(p.Stop)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run failed: %s", err.Error())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("polling did not stop")
+	}
+	if calls != 1 {
+		t.Fatalf("calls=%d; want 1", calls)
+	}
+}
+
+func TestPollerDuration(t *testing.T) {
+	s := &pollSesn{open: true}
+	p := &Poller{
+		Interval: 50 * time.Millisecond,
+		Duration: 120 * time.Millisecond,
+	}
+
+	calls := 0
+	err := p.Run(s, func() (bool, error) {
+		calls++
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %s", err.Error())
+	}
+
+	// Calls at 0, 50 and 100ms.
+	if calls != 3 {
+		t.Fatalf("calls=%d; want 3", calls)
+	}
+}